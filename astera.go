@@ -3,23 +3,159 @@ package astera
 import (
 	"context"
 	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
 )
 
 var (
 	ErrModuleAlreadyExists = errors.New("module already exists")
 	ErrModuleNotFound      = errors.New("module not found")
 	ErrInvalidResource     = errors.New("invalid resource")
+	ErrRateLimited         = errors.New("rate limited")
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+	ErrPinned              = errors.New("module version is pinned")
+	ErrPolicyDenied        = errors.New("denied by policy")
+
+	// ErrModuleGone is returned when upstream answered 410 Gone, it matches ErrModuleNotFound
+	ErrModuleGone error = goneError{}
+)
+
+type goneError struct{}
+
+func (goneError) Error() string {
+	return "module gone"
+}
+
+func (goneError) Is(target error) bool {
+	return target == ErrModuleNotFound
+}
+
+// RateLimitError is returned when a client exceeded its limit, it matches ErrRateLimited
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s: retry after %s", ErrRateLimited, e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// UpstreamUnavailableError is returned without contacting the upstream while its circuit
+// breaker is open, it matches ErrUpstreamUnavailable
+type UpstreamUnavailableError struct {
+	Upstream   string
+	RetryAfter time.Duration
+}
+
+func (e *UpstreamUnavailableError) Error() string {
+	return fmt.Sprintf("%s: %s, retry after %s", ErrUpstreamUnavailable, e.Upstream, e.RetryAfter.Round(time.Second))
+}
+
+func (e *UpstreamUnavailableError) Unwrap() error {
+	return ErrUpstreamUnavailable
+}
+
+// QuarantinedError is returned for a quarantined version, it matches ErrModuleGone so the version
+// is answered with 410 Gone
+type QuarantinedError struct {
+	Quarantine *Quarantine
+}
+
+func (e *QuarantinedError) Error() string {
+	q := e.Quarantine
+
+	modulePath, err := module.UnescapePath(q.Name)
+	if err != nil {
+		modulePath = q.Name
+	}
+
+	version, err := module.UnescapeVersion(q.Version)
+	if err != nil {
+		version = q.Version
+	}
+
+	return fmt.Sprintf("%s@%s is quarantined by %s: %s", modulePath, version, q.By, q.Reason)
+}
+
+func (e *QuarantinedError) Unwrap() error {
+	return ErrModuleGone
+}
+
+// PolicyDeniedError is returned for a module or version a policy rule denies, it matches ErrPolicyDenied
+type PolicyDeniedError struct {
+	Module string
+	// Version is empty when the whole module is denied
+	Version string
+	Rule    string
+	// Reason is optional
+	Reason string
+}
+
+func (e *PolicyDeniedError) Error() string {
+	target := e.Module
+	if e.Version != "" {
+		target += "@" + e.Version
+	}
+
+	if e.Reason != "" {
+		return fmt.Sprintf("%s: %s rule %q: %s", target, ErrPolicyDenied, e.Rule, e.Reason)
+	}
+
+	return fmt.Sprintf("%s: %s rule %q", target, ErrPolicyDenied, e.Rule)
+}
+
+func (e *PolicyDeniedError) Unwrap() error {
+	return ErrPolicyDenied
+}
+
+// Where the module was ingested from
+const (
+	ModuleSourceProxy     = "proxy"
+	ModuleSourceGit       = "git"
+	ModuleSourceImport    = "import"
+	ModuleSourcePublished = "published"
 )
 
 type Module struct {
 	Name string
+	// Source is one of ModuleSource*, empty means ModuleSourceProxy
+	Source string
 
 	Version string
 	ZipHash string
 
 	Info []byte
 	Mod  []byte
-	Zip  []byte
+	// Zip is nil for a partial module, prefetched without its zip
+	Zip []byte
+}
+
+// ModuleVersion describes a stored version without loading its content
+type ModuleVersion struct {
+	Name    string
+	Version string
+	Source  string
+	ZipHash string
+
+	ModSize int64
+	ZipSize int64
+	// CreatedAt is zero for the versions stored before the ingestion time was recorded
+	CreatedAt time.Time
+	// LastAccessAt is zero for the versions never served since the access was recorded
+	LastAccessAt time.Time
+	Hits         int64
+	// Pin is the pin protecting the version, nil when it isn't pinned
+	Pin *Pin
+	// Quarantine is nil when the version is served
+	Quarantine *Quarantine
 }
 
 type Info struct {
@@ -36,6 +172,8 @@ type Origin struct {
 }
 
 type ModuleRepository interface {
+	// InsertModule stores the module or adds the zip to the stored partial module, it returns
+	// ErrModuleAlreadyExists when there was nothing to store
 	InsertModule(module *Module) error
 
 	GetVersionList(name string) ([]string, error)
@@ -44,14 +182,367 @@ type ModuleRepository interface {
 	GetModuleZip(name, version string) ([]byte, error)
 
 	ModuleExists(name string, version string) (bool, error)
+	// HasModuleZip tells if the zip of the version is stored, prefetched versions may have only .info and .mod
+	HasModuleZip(name string, version string) (bool, error)
+
+	// SearchModules returns the module names containing query
+	SearchModules(query string, limit int) ([]string, error)
+	GetModuleVersions(name string) ([]ModuleVersion, error)
+}
+
+// Access is the use of a stored version since the accesses were last recorded
+type Access struct {
+	Name    string
+	Version string
+	Hits    int64
+	At      time.Time
+}
+
+type AccessRepository interface {
+	// RecordAccess adds the hits of the versions and moves their last access forward in a single transaction
+	RecordAccess(accesses []Access) error
+}
+
+// GCRepository evicts the least recently used versions, the last access of a version never served is its ingestion
+type GCRepository interface {
+	// DatabaseSize is the size of the database without its free pages
+	DatabaseSize() (int64, error)
+	// LeastRecentlyUsed returns the evictable versions last accessed before the time, least recently
+	// used first, with withZip only the ones still having their zip. The published versions and the
+	// ones cloned from git are never evictable, the pinned ones are returned with their Pin.
+	LeastRecentlyUsed(withZip bool, accessedBefore time.Time, limit, offset int) ([]ModuleVersion, error)
+	// DropZip removes the zip of the version, it becomes a partial module fetched again on demand.
+	// It fails with ErrPinned for a pinned version, like DeleteModule.
+	DropZip(name, version string) error
+	DeleteModule(name, version string) error
+	// IncrementalVacuum returns the free pages to the file system
+	IncrementalVacuum() error
+}
+
+// ReleaseRepository reads when the stored versions were released
+type ReleaseRepository interface {
+	// ReleaseTimes returns the .info Time of every stored version of the module keyed by version, recorded
+	// when the version was stored, zero for the versions not released upstream (published or cloned from git)
+	// or without a valid time
+	ReleaseTimes(name string) (map[string]time.Time, error)
+	// ReleaseTime returns the .info Time of the stored version the same way, ErrModuleNotFound when it is not stored
+	ReleaseTime(name, version string) (time.Time, error)
+}
+
+// WindowUsage is what the deferred work downloaded in a single occurrence of a fetch window
+type WindowUsage struct {
+	Window string
+	Start  time.Time
+	End    time.Time
+	Bytes  int64
+}
+
+// WindowUsageRepository keeps the fetch window usage across restarts
+type WindowUsageRepository interface {
+	// AddWindowUsage adds the bytes to the occurrence of the window starting at Start, creating it
+	AddWindowUsage(usage WindowUsage) error
+	// WindowUsages returns the latest occurrences, oldest first
+	WindowUsages(limit int) ([]WindowUsage, error)
+}
+
+// MirrorStatus is the outcome of the last mirror sync of a module
+type MirrorStatus struct {
+	Module   string    `json:"module"`
+	Rule     string    `json:"rule"`
+	SyncedAt time.Time `json:"synced_at"`
+	// Upstream is the number of versions upstream lists, Matched the ones selected by the rule
+	Upstream int `json:"upstream"`
+	Matched  int `json:"matched"`
+	// Missing are the matched versions not stored with their zip, Queued the ones newly queued for fetch
+	Missing int    `json:"missing"`
+	Queued  int    `json:"queued"`
+	Error   string `json:"error,omitempty"`
+}
+
+// MirrorStatusRepository keeps the mirror sync outcomes across restarts
+type MirrorStatusRepository interface {
+	// SaveMirrorStatus replaces the status of the module
+	SaveMirrorStatus(status MirrorStatus) error
+	MirrorStatuses() ([]MirrorStatus, error)
+}
+
+// Pin protects module versions from eviction and deletion, either a single version of a module or
+// every version of the modules matching a pattern
+type Pin struct {
+	// Module is a module path, without Version a glob in the GOPRIVATE syntax is allowed too
+	Module string `json:"module"`
+	// Version is empty for every version
+	Version   string    `json:"version,omitempty"`
+	Reason    string    `json:"reason"`
+	Owner     string    `json:"owner"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (p *Pin) Check() error {
+	if p.Reason == "" || p.Owner == "" {
+		return errors.New("a pin needs a reason and an owner")
+	}
+
+	if p.Version == "" {
+		if strings.ContainsAny(p.Module, "*?[\\") {
+			_, err := path.Match(p.Module, "")
+			return err
+		}
+
+		return module.CheckPath(p.Module)
+	}
+
+	if semver.Canonical(p.Version) != p.Version {
+		return fmt.Errorf("invalid version %q, a pinned version must be canonical", p.Version)
+	}
+
+	return module.Check(p.Module, p.Version)
+}
+
+// Match tells if the pin protects the stored (escaped) version
+func (p *Pin) Match(name, version string) bool {
+	modulePath, err := module.UnescapePath(name)
+	if err != nil {
+		// stored unescaped, like the private modules cloned from git
+		modulePath = name
+	}
+
+	if p.Version == "" {
+		return module.MatchPrefixPatterns(p.Module, modulePath)
+	}
+
+	if v, err := module.UnescapeVersion(version); err == nil {
+		version = v
+	}
+
+	return p.Module == modulePath && p.Version == version
+}
+
+type PinRepository interface {
+	// AddPin adds the pin or replaces the reason and owner of the existing one, it sets CreatedAt
+	AddPin(pin *Pin) error
+	// RemovePin reports if the pin existed
+	RemovePin(module, version string) (bool, error)
+	ListPins() ([]Pin, error)
+}
+
+// Quarantine stops serving a known bad version without deleting it, the version is answered with
+// 410 Gone, left out of list and @latest and never fetched again
+type Quarantine struct {
+	// Name and Version are escaped
+	Name      string    `json:"module"`
+	Version   string    `json:"version"`
+	Reason    string    `json:"reason"`
+	By        string    `json:"by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	QuarantineActionAdd     = "quarantine"
+	QuarantineActionRelease = "release"
+)
+
+// QuarantineEvent is an entry of the quarantine audit trail
+type QuarantineEvent struct {
+	Name    string    `json:"module"`
+	Version string    `json:"version"`
+	Action  string    `json:"action"`
+	Reason  string    `json:"reason"`
+	By      string    `json:"by"`
+	At      time.Time `json:"at"`
+}
+
+type QuarantineRepository interface {
+	// Quarantine quarantines the version, or replaces the reason of a quarantined one, and records it in the audit trail
+	Quarantine(q *Quarantine) error
+	// Release serves the version again and records it in the audit trail, it reports if the version was quarantined
+	Release(name, version, by, reason string) (bool, error)
+	// Quarantined returns the quarantined versions of the module
+	Quarantined(name string) ([]Quarantine, error)
+	ListQuarantines() ([]Quarantine, error)
+	// QuarantineAudit returns the audit trail newest first, of every module when name is empty
+	QuarantineAudit(name string, limit int) ([]QuarantineEvent, error)
+}
+
+// NegativeEntry remembers that upstream doesn't have the resource
+type NegativeEntry struct {
+	Gone      bool
+	ExpiresAt time.Time
+}
+
+func (e *NegativeEntry) Err() error {
+	if e.Gone {
+		return ErrModuleGone
+	}
+
+	return ErrModuleNotFound
+}
+
+type NegativeCacheRepository interface {
+	InsertNegative(name, resource string, entry NegativeEntry) error
+	// GetNegative returns nil when there is no entry for the resource or it has expired
+	GetNegative(name, resource string) (*NegativeEntry, error)
+	// PurgeNegative removes the entries of the module or all of them when name is empty
+	PurgeNegative(name string) (int64, error)
+}
+
+// What queued the background fetch
+const (
+	JobKindMiss     = "miss"
+	JobKindPrefetch = "prefetch"
+	JobKindMirror   = "mirror"
+)
+
+const (
+	JobStatePending = "pending"
+	JobStateRunning = "running"
+	JobStateFailed  = "failed"
+)
+
+// Job is a queued background fetch of a module version
+type Job struct {
+	ID      int64
+	Name    string
+	Version string
+	Kind    string
+	State   string
+
+	Attempts  int
+	LastError string
+	// Depth is how far down the dependency graph a prefetch job is from the requested module
+	Depth int
+
+	NextAttempt time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type JobRepository interface {
+	// EnqueueJob adds the job unless the module version is already queued, a failed job is
+	// queued again. It returns if the job was added.
+	EnqueueJob(job *Job) (bool, error)
+	// ClaimJob marks the oldest due pending job not of skipKinds as running, nil when there is none
+	ClaimJob(now time.Time, skipKinds []string) (*Job, error)
+	// FinishJob removes the job of the module version, it has nothing left to do
+	FinishJob(name, version string) error
+	// RetryJob puts the job back to pending with the updated attempts and error
+	RetryJob(id int64, attempts int, nextAttempt time.Time, lastErr string) error
+	// FailJob keeps the job as failed for inspection, it is not retried
+	FailJob(id int64, attempts int, lastErr string) error
+	// ListJobs returns the jobs in the state, all of them when state is empty
+	ListJobs(state string, limit int) ([]Job, error)
+	DeleteJob(id int64) (bool, error)
+	// ResetRunningJobs makes the jobs left running by a previous process pending again
+	ResetRunningJobs() (int64, error)
+}
+
+// ImportRepository stores the modules imported from a local module cache and remembers which
+// versions are done, so an interrupted import resumes where it stopped
+type ImportRepository interface {
+	// InsertImportBatch stores the modules like InsertModule and records them as imported from dir in a single
+	// transaction. The returned errors tell for each module ErrModuleAlreadyExists when it was stored already or why
+	// the database refused it, nil when it was stored. err fails the whole batch, nothing is stored.
+	InsertImportBatch(dir string, modules []*Module) (errs []error, err error)
+	// ImportedVersions returns the versions imported from dir so far, keyed by name@version
+	ImportedVersions(dir string) (map[string]bool, error)
+	// ResetImport forgets the progress of the imports from dir
+	ResetImport(dir string) error
+	// HasModuleZip tells if the version is stored with its zip, a sync doesn't download it again
+	HasModuleZip(name, version string) (bool, error)
+}
+
+// CatalogEntry is a stored module version listed by the /catalog endpoint, the path and version are not escaped
+type CatalogEntry struct {
+	Module  string `json:"module"`
+	Version string `json:"version"`
+}
+
+type CatalogRepository interface {
+	// Catalog returns up to limit stored versions ordered by name and version after the escaped name and version,
+	// the quarantined versions are left out
+	Catalog(afterName, afterVersion string, limit int) ([]ModuleVersion, error)
+}
+
+// RemoteProxy is a GOPROXY the modules are synced from, the module paths and versions are escaped
+type RemoteProxy interface {
+	// FetchCatalog returns a page of the stored module versions and the token of the next page, which
+	// is empty after the last one. The proxy answers ErrModuleNotFound when it has no catalog.
+	FetchCatalog(ctx context.Context, token string, pageSize int) ([]CatalogEntry, string, error)
+	FetchList(ctx context.Context, module string) ([]byte, error)
+	FetchModuleInfo(ctx context.Context, module, version string) ([]byte, error)
+	FetchModuleMod(ctx context.Context, module, version string) ([]byte, error)
+	FetchModuleZip(ctx context.Context, module, version string) ([]byte, error)
+}
+
+type ExportRepository interface {
+	// WalkModules calls fn for every stored module ordered by name and version, leaving out the quarantined
+	// versions, it stops on the first error. With prefixes only the names starting with one of them are walked.
+	WalkModules(prefixes []string, fn func(*Module) error) error
+}
+
+// The directory layouts an import reads
+const (
+	// ImportLayoutDownload is GOMODCACHE/cache/download, which is also the layout of a GOPROXY directory
+	ImportLayoutDownload = "download"
+	// ImportLayoutAthens is the disk storage of Athens, <module>/<version>/{go.mod,source.zip,<version>.info}
+	ImportLayoutAthens = "athens"
+)
+
+type ImportOptions struct {
+	// Layout is one of ImportLayout*, empty means ImportLayoutDownload
+	Layout string
+	// Workers is the number of modules read at once
+	Workers int
+	// BatchSize is the number of versions inserted in a single transaction
+	BatchSize int
+	// DryRun reads and validates the versions without storing anything
+	DryRun bool
+	// Restart ignores the progress of a previous import of the same directory
+	Restart bool
+	// Check refuses a validated version before it is stored, it is reported as failed. Nil stores every valid version.
+	Check func(m *Module) error
+}
+
+// ImportFailure is a version that couldn't be imported, the import continues without it
+type ImportFailure struct {
+	Name    string
+	Version string
+	Err     string
+}
+
+type ImportReport struct {
+	// Dir is the imported directory or the URL of the synced proxy
+	Dir string
+	// Modules is the number of modules read
+	Modules  int
+	Imported int
+	// Skipped are the versions imported by a previous run
+	Skipped int
+	Failed  []ImportFailure
+	// Bytes is the size of the imported zips
+	Bytes   int64
+	DryRun  bool
+	Elapsed time.Duration
 }
 
 type GoProxyService interface {
-	ImportCachedModules(dir string) error
+	// ImportCachedModules imports the module cache (GOMODCACHE/cache/download) at dir
+	ImportCachedModules(ctx context.Context, dir string, options ImportOptions) (*ImportReport, error)
 	Query(context.Context, string) ([]byte, error)
+	// FetchModule fetches and stores the module version unless it is stored already,
+	// without zip only its .info and .mod. The module path and version are escaped.
+	FetchModule(ctx context.Context, module, version string, withZip bool) error
+	// Start starts the background job workers and the mirror, only the server runs them
+	Start()
+	Shutdown(context.Context) error
+	PurgeNegativeCache(module string) (int64, error)
+
+	ListJobs(state string, limit int) ([]Job, error)
+	// CancelJob removes the job and stops it if it is running
+	CancelJob(id int64) error
 }
 
 type VCS interface {
-	Clone(repo string, tag string) (*Module, error)
-	FetchTags(repo string) ([]string, error)
+	Clone(ctx context.Context, repo string, tag string) (*Module, error)
+	FetchTags(ctx context.Context, repo string) ([]string, error)
 }
@@ -0,0 +1,335 @@
+package breaker
+
+import (
+	"astera"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	// Closed lets every request through
+	Closed State = iota
+	// Open fails every request fast until the cooldown passes
+	Open
+	// HalfOpen lets a single probe request through, its outcome closes or reopens the circuit
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+type Config struct {
+	// Threshold is the number of consecutive failures that opens the circuit, zero disables the breakers
+	Threshold int
+	// Cooldown is how long the circuit stays open before a probe request is let through
+	Cooldown time.Duration
+	// Probe asks the upstream if it is back, it is called in the background once the cooldown
+	// passed so the circuit closes without waiting for a client to pay the timeout. When it is
+	// nil the next client request is the probe.
+	Probe func(ctx context.Context, upstream string) error
+}
+
+// Breaker tracks the health of a single upstream. A nil *Breaker lets everything through.
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mx        sync.Mutex
+	state     State
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	lastError string
+
+	probe func(ctx context.Context, upstream string) error
+	// done stops the prober
+	done context.Context
+	// a prober is running until the circuit closes
+	prober bool
+
+	now func() time.Time
+}
+
+// Status is a snapshot of a breaker for the logs and the status endpoints
+type Status struct {
+	Upstream  string    `json:"upstream"`
+	State     State     `json:"state"`
+	Failures  int       `json:"failures"`
+	OpenedAt  time.Time `json:"opened_at,omitzero"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Allow returns nil when a request may go to the upstream, the caller then has to report
+// the outcome with Success, Failure or Cancel. While the circuit is open it returns
+// *astera.UpstreamUnavailableError.
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	switch b.state {
+	case Open:
+		wait := b.cooldown - b.now().Sub(b.openedAt)
+		if wait > 0 {
+			return &astera.UpstreamUnavailableError{Upstream: b.name, RetryAfter: wait}
+		}
+
+		b.state = HalfOpen
+		slog.Info("upstream circuit half-open, probing", "upstream", b.name)
+		fallthrough
+	case HalfOpen:
+		if b.probing {
+			return &astera.UpstreamUnavailableError{Upstream: b.name, RetryAfter: b.cooldown}
+		}
+
+		b.probing = true
+	}
+
+	return nil
+}
+
+// Success closes the circuit, the upstream answered
+func (b *Breaker) Success() {
+	if b == nil {
+		return
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.state != Closed {
+		slog.Info("upstream circuit closed", "upstream", b.name)
+	}
+
+	b.state = Closed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure counts a failed request and opens the circuit after threshold consecutive ones
+// or when the half-open probe failed
+func (b *Breaker) Failure(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.failures++
+	b.lastError = err.Error()
+
+	if b.state == HalfOpen || (b.state == Closed && b.failures >= b.threshold) {
+		slog.Warn("upstream circuit open", "upstream", b.name, "failures", b.failures,
+			"cooldown", b.cooldown, "err", err)
+
+		b.state = Open
+		b.openedAt = b.now()
+
+		if b.probe != nil && !b.prober {
+			b.prober = true
+			go b.runProber()
+		}
+	}
+
+	b.probing = false
+}
+
+// runProber probes the upstream every time the cooldown passed until the circuit is closed
+func (b *Breaker) runProber() {
+	timer := time.NewTimer(b.cooldown)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-b.done.Done():
+			b.mx.Lock()
+			b.prober = false
+			b.mx.Unlock()
+			return
+		case <-timer.C:
+		}
+
+		// a client request may be the probe already
+		if b.Allow() == nil {
+			err := b.probe(b.done, b.name)
+			switch {
+			case b.done.Err() != nil:
+				b.Cancel()
+			case err != nil:
+				b.Failure(err)
+			default:
+				b.Success()
+			}
+		}
+
+		b.mx.Lock()
+		if b.state == Closed {
+			b.prober = false
+			b.mx.Unlock()
+			return
+		}
+
+		wait := b.cooldown
+		if b.state == Open {
+			wait = max(b.cooldown-b.now().Sub(b.openedAt), 0)
+		}
+		b.mx.Unlock()
+
+		timer.Reset(wait)
+	}
+}
+
+// Cancel gives up the request without a verdict, e.g. the client went away
+func (b *Breaker) Cancel() {
+	if b == nil {
+		return
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.probing = false
+}
+
+func (b *Breaker) Status() Status {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	s := Status{
+		Upstream:  b.name,
+		State:     b.state,
+		Failures:  b.failures,
+		LastError: b.lastError,
+	}
+
+	if b.state != Closed {
+		s.OpenedAt = b.openedAt
+	}
+
+	return s
+}
+
+// Set holds a breaker per upstream, created on first use. A nil *Set disables the breakers.
+type Set struct {
+	config Config
+
+	// done stops the probers
+	done context.Context
+	stop context.CancelFunc
+
+	mx       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// NewSet returns nil when config.Threshold is not positive
+func NewSet(config Config) *Set {
+	if config.Threshold <= 0 {
+		return nil
+	}
+
+	done, stop := context.WithCancel(context.Background())
+
+	return &Set{
+		config:   config,
+		done:     done,
+		stop:     stop,
+		breakers: make(map[string]*Breaker),
+	}
+}
+
+// Stop stops the background probers
+func (s *Set) Stop() {
+	if s == nil {
+		return
+	}
+
+	s.stop()
+}
+
+func (s *Set) Get(upstream string) *Breaker {
+	if s == nil {
+		return nil
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	b, ok := s.breakers[upstream]
+	if !ok {
+		b = &Breaker{
+			name:      upstream,
+			threshold: s.config.Threshold,
+			cooldown:  s.config.Cooldown,
+			probe:     s.config.Probe,
+			done:      s.done,
+			now:       time.Now,
+		}
+		s.breakers[upstream] = b
+	}
+
+	return b
+}
+
+// Statuses returns the state of every upstream seen so far sorted by name
+func (s *Set) Statuses() []Status {
+	if s == nil {
+		return nil
+	}
+
+	s.mx.Lock()
+	breakers := make([]*Breaker, 0, len(s.breakers))
+	for _, b := range s.breakers {
+		breakers = append(breakers, b)
+	}
+	s.mx.Unlock()
+
+	statuses := make([]Status, 0, len(breakers))
+	for _, b := range breakers {
+		statuses = append(statuses, b.Status())
+	}
+
+	slices.SortFunc(statuses, func(a, b Status) int { return strings.Compare(a.Upstream, b.Upstream) })
+
+	return statuses
+}
+
+// Check is a health.Check failing while any circuit is not closed
+func (s *Set) Check(ctx context.Context) error {
+	var open []string
+	for _, status := range s.Statuses() {
+		if status.State != Closed {
+			open = append(open, fmt.Sprintf("%s %s since %s: %s", status.Upstream, status.State,
+				status.OpenedAt.Format(time.RFC3339), status.LastError))
+		}
+	}
+
+	if len(open) > 0 {
+		return fmt.Errorf("upstream circuit not closed: %s", strings.Join(open, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package breaker
+
+import (
+	"astera"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	s := NewSet(Config{Threshold: 2, Cooldown: time.Minute})
+	b := s.Get("proxy.golang.org")
+	b.now = func() time.Time { return now }
+
+	errDown := errors.New("connection refused")
+
+	// a success in between resets the consecutive failures
+	require.NoError(t, b.Allow())
+	b.Failure(errDown)
+	require.NoError(t, b.Allow())
+	b.Success()
+	require.NoError(t, b.Allow())
+	b.Failure(errDown)
+	require.Equal(t, Closed, b.Status().State)
+
+	require.NoError(t, b.Allow())
+	b.Failure(errDown)
+	require.Equal(t, Open, b.Status().State)
+	require.Error(t, s.Check(context.Background()))
+
+	// open fails fast
+	err := b.Allow()
+	require.ErrorIs(t, err, astera.ErrUpstreamUnavailable)
+
+	var unavailableErr *astera.UpstreamUnavailableError
+	require.ErrorAs(t, err, &unavailableErr)
+	require.Equal(t, time.Minute, unavailableErr.RetryAfter)
+
+	// after the cooldown a single probe goes through
+	now = now.Add(time.Minute)
+	require.NoError(t, b.Allow())
+	require.Equal(t, HalfOpen, b.Status().State)
+	require.ErrorIs(t, b.Allow(), astera.ErrUpstreamUnavailable)
+
+	// failed probe reopens the circuit
+	b.Failure(errDown)
+	require.Equal(t, Open, b.Status().State)
+	require.ErrorIs(t, b.Allow(), astera.ErrUpstreamUnavailable)
+
+	// cancelled probe lets the next request probe
+	now = now.Add(time.Minute)
+	require.NoError(t, b.Allow())
+	b.Cancel()
+	require.NoError(t, b.Allow())
+
+	b.Success()
+	require.Equal(t, Closed, b.Status().State)
+	require.NoError(t, s.Check(context.Background()))
+
+	var disabled *Set
+	require.Nil(t, disabled.Get("proxy.golang.org"))
+	require.NoError(t, disabled.Get("proxy.golang.org").Allow())
+	require.Nil(t, NewSet(Config{}))
+}
+
+func TestBreakerProber(t *testing.T) {
+	t.Parallel()
+
+	var probes atomic.Int32
+	s := NewSet(Config{Threshold: 1, Cooldown: 10 * time.Millisecond, Probe: func(ctx context.Context, upstream string) error {
+		// the upstream comes back on the second probe
+		if probes.Add(1) == 1 {
+			return errors.New("connection refused")
+		}
+
+		return nil
+	}})
+	defer s.Stop()
+
+	b := s.Get("proxy.golang.org")
+	require.NoError(t, b.Allow())
+	b.Failure(errors.New("connection refused"))
+	require.Equal(t, Open, b.Status().State)
+
+	// no client request is needed to close the circuit
+	require.Eventually(t, func() bool { return b.Status().State == Closed }, time.Second, time.Millisecond)
+	require.Equal(t, int32(2), probes.Load())
+}
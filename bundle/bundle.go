@@ -0,0 +1,430 @@
+package bundle
+
+import (
+	"archive/tar"
+	"astera"
+	"astera/importer"
+	"astera/modset"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/mod/module"
+)
+
+const (
+	format = 1
+
+	manifestName  = "manifest.json"
+	signatureName = "manifest.sig"
+
+	// the biggest module zip the go command accepts
+	maxFileSize = 500 << 20
+)
+
+var ErrInvalidBundle = errors.New("invalid bundle")
+
+// Manifest lists the module versions of the bundle in the order of their files, it is the first
+// entry of the bundle and is followed by its signature when the bundle is signed
+type Manifest struct {
+	Format  int       `json:"format"`
+	Created time.Time `json:"created"`
+	Modules []Entry   `json:"modules"`
+}
+
+// Entry is a module version of the bundle, a version without Zip has only .info and .mod
+type Entry struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	ZipHash string `json:"zip_hash,omitempty"`
+	Info    File   `json:"info"`
+	Mod     File   `json:"mod"`
+	Zip     *File  `json:"zip,omitempty"`
+}
+
+type File struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func newFile(data []byte) File {
+	sum := sha256.Sum256(data)
+	return File{Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}
+}
+
+func (f File) check(data []byte) error {
+	if newFile(data) != f {
+		return errors.New("checksum mismatch")
+	}
+
+	return nil
+}
+
+// Create writes the modules from the repository into a tar.zst bundle. The manifest is signed when
+// key is set. The modules are read twice, to checksum them for the manifest and to write them, so
+// only a single version is held in memory. A quarantined version fails the bundle with a QuarantinedError.
+func Create(w io.Writer, repository astera.ModuleRepository, quarantine astera.QuarantineRepository,
+	modules []modset.Module, key ed25519.PrivateKey,
+) (*Manifest, error) {
+	manifest := &Manifest{Format: format, Created: time.Now().UTC(), Modules: make([]Entry, 0, len(modules))}
+
+	for _, m := range modules {
+		err := checkQuarantine(quarantine, m.Mod)
+		if err != nil {
+			return nil, err
+		}
+
+		files, err := readModule(repository, m.Mod, !m.ModOnly)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := Entry{Path: m.Mod.Path, Version: m.Mod.Version, Info: newFile(files.Info), Mod: newFile(files.Mod)}
+		if files.Zip != nil {
+			zipFile := newFile(files.Zip)
+			entry.Zip = &zipFile
+
+			entry.ZipHash, err = importer.HashZip(files.Zip)
+			if err != nil {
+				return nil, fmt.Errorf("%s@%s: %w", m.Mod.Path, m.Mod.Version, err)
+			}
+		}
+
+		manifest.Modules = append(manifest.Modules, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+
+	tw := tar.NewWriter(zw)
+
+	err = writeFile(tw, manifestName, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != nil {
+		err = writeFile(tw, signatureName, ed25519.Sign(key, data))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, entry := range manifest.Modules {
+		v := module.Version{Path: entry.Path, Version: entry.Version}
+
+		files, err := readModule(repository, v, entry.Zip != nil)
+		if err != nil {
+			return nil, err
+		}
+
+		base, err := entryBase(v)
+		if err != nil {
+			return nil, err
+		}
+
+		err = errors.Join(
+			writeFile(tw, base+".info", files.Info),
+			writeFile(tw, base+".mod", files.Mod),
+		)
+		if err == nil && files.Zip != nil {
+			err = writeFile(tw, base+".zip", files.Zip)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = errors.Join(tw.Close(), zw.Close())
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// readModule reads the version from the repository, the zip only when withZip is set
+// checkQuarantine returns a QuarantinedError for a quarantined version
+func checkQuarantine(quarantine astera.QuarantineRepository, v module.Version) error {
+	name, err := module.EscapePath(v.Path)
+	if err != nil {
+		return err
+	}
+
+	version, err := module.EscapeVersion(v.Version)
+	if err != nil {
+		return err
+	}
+
+	quarantined, err := quarantine.Quarantined(name)
+	if err != nil {
+		return err
+	}
+
+	for i := range quarantined {
+		if quarantined[i].Version == version {
+			return &astera.QuarantinedError{Quarantine: &quarantined[i]}
+		}
+	}
+
+	return nil
+}
+
+func readModule(repository astera.ModuleRepository, v module.Version, withZip bool) (*astera.Module, error) {
+	name, err := module.EscapePath(v.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := module.EscapeVersion(v.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &astera.Module{Name: name, Version: version}
+
+	m.Info, err = repository.GetVersionInfo(name, version)
+	if err == nil {
+		m.Mod, err = repository.GetModFile(name, version)
+	}
+
+	if err == nil && withZip {
+		m.Zip, err = repository.GetModuleZip(name, version)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s@%s: %w", v.Path, v.Version, err)
+	}
+
+	return m, nil
+}
+
+// entryBase is the path of the version files in the bundle without the extension
+func entryBase(v module.Version) (string, error) {
+	name, err := module.EscapePath(v.Path)
+	if err != nil {
+		return "", err
+	}
+
+	version, err := module.EscapeVersion(v.Version)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join("modules", name, "@v", version), nil
+}
+
+func writeFile(tw *tar.Writer, name string, data []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write(data)
+	return err
+}
+
+type ImportReport struct {
+	Manifest *Manifest
+	Signed   bool
+	Imported int
+	// Skipped are the versions already stored
+	Skipped int
+}
+
+// Import verifies the bundle and stores its versions, skipping the ones already stored. With a public
+// key the manifest must be signed with its private key, without one the signature is not checked.
+// Every file is checked against the manifest and every version is validated like an imported one,
+// its zip hash computed again, before it is stored.
+func Import(r io.Reader, repository astera.ModuleRepository, key ed25519.PublicKey) (*ImportReport, error) {
+	zr, err := zstd.NewReader(r, zstd.WithDecoderLowmem(true))
+	if err != nil {
+		return nil, err
+	}
+
+	defer zr.Close()
+
+	br := &reader{tr: tar.NewReader(zr)}
+
+	data, err := br.read(manifestName, maxFileSize)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{}
+
+	signature, err := br.read(signatureName, ed25519.SignatureSize)
+	switch {
+	case err == nil:
+		report.Signed = true
+		if key != nil && !ed25519.Verify(key, data, signature) {
+			return nil, fmt.Errorf("%w: bad signature", ErrInvalidBundle)
+		}
+	case (errors.Is(err, errUnexpectedFile) || errors.Is(err, errTruncated)) && key == nil:
+		// unsigned, the file read instead is the first of the modules
+	case errors.Is(err, errUnexpectedFile) || errors.Is(err, errTruncated):
+		return nil, fmt.Errorf("%w: not signed", ErrInvalidBundle)
+	default:
+		return nil, err
+	}
+
+	manifest := &Manifest{}
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: manifest: %v", ErrInvalidBundle, err)
+	}
+
+	if manifest.Format != format {
+		return nil, fmt.Errorf("%w: unsupported format %d", ErrInvalidBundle, manifest.Format)
+	}
+
+	report.Manifest = manifest
+
+	for _, entry := range manifest.Modules {
+		v := module.Version{Path: entry.Path, Version: entry.Version}
+
+		m, err := br.readModule(v, entry)
+		if err != nil {
+			return report, fmt.Errorf("%s@%s: %w", v.Path, v.Version, err)
+		}
+
+		err = importer.Validate(m)
+		if err != nil {
+			return report, fmt.Errorf("%s@%s: %w: %v", v.Path, v.Version, ErrInvalidBundle, err)
+		}
+
+		stored, err := repository.ModuleExists(m.Name, m.Version)
+		if err == nil && stored && m.Zip != nil {
+			stored, err = repository.HasModuleZip(m.Name, m.Version)
+		}
+
+		if err != nil {
+			return report, err
+		}
+
+		if stored {
+			report.Skipped++
+			continue
+		}
+
+		err = repository.InsertModule(m)
+		if errors.Is(err, astera.ErrModuleAlreadyExists) {
+			report.Skipped++
+			continue
+		}
+
+		if err != nil {
+			return report, fmt.Errorf("%s@%s: %w", v.Path, v.Version, err)
+		}
+
+		report.Imported++
+	}
+
+	return report, nil
+}
+
+var (
+	errUnexpectedFile = fmt.Errorf("%w: unexpected file", ErrInvalidBundle)
+	errTruncated      = fmt.Errorf("%w: truncated", ErrInvalidBundle)
+)
+
+// reader reads the files of the bundle in the order of the manifest
+type reader struct {
+	tr *tar.Reader
+	// the header read ahead when the expected file was missing
+	pending *tar.Header
+}
+
+// read returns the content of the next file, which must be called name and be at most limit bytes
+func (r *reader) read(name string, limit int64) ([]byte, error) {
+	h := r.pending
+	r.pending = nil
+
+	if h == nil {
+		var err error
+		h, err = r.tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w, %s is missing", errTruncated, name)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if h.Name != name {
+		r.pending = h
+		return nil, fmt.Errorf("%w %s, expected %s", errUnexpectedFile, h.Name, name)
+	}
+
+	if h.Size > limit {
+		return nil, fmt.Errorf("%w: %s is too big", ErrInvalidBundle, name)
+	}
+
+	return io.ReadAll(io.LimitReader(r.tr, h.Size))
+}
+
+// readModule reads the files of the version and checks them against the manifest entry
+func (r *reader) readModule(v module.Version, entry Entry) (*astera.Module, error) {
+	if err := module.Check(v.Path, v.Version); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+
+	base, err := entryBase(v)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &astera.Module{Source: astera.ModuleSourceImport, ZipHash: entry.ZipHash}
+	m.Name, _ = module.EscapePath(v.Path)
+	m.Version, _ = module.EscapeVersion(v.Version)
+
+	m.Info, err = r.readChecked(base+".info", entry.Info)
+	if err == nil {
+		m.Mod, err = r.readChecked(base+".mod", entry.Mod)
+	}
+
+	if err == nil && entry.Zip != nil {
+		m.Zip, err = r.readChecked(base+".zip", *entry.Zip)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (r *reader) readChecked(name string, f File) ([]byte, error) {
+	data, err := r.read(name, f.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.check(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBundle, name, err)
+	}
+
+	return data, nil
+}
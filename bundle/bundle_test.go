@@ -0,0 +1,293 @@
+package bundle
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"astera"
+	"astera/mock"
+	"astera/modset"
+	"bytes"
+	"crypto/ed25519"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func moduleZip(t *testing.T, name, version string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create(name + "@" + version + "/go.mod")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("module " + name + "\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	return buf.Bytes()
+}
+
+// memoryRepository keeps the modules by escaped name@version
+func memoryRepository(modules map[string]*astera.Module) *mock.Repository {
+	get := func(name, version string) (*astera.Module, error) {
+		m, ok := modules[name+"@"+version]
+		if !ok {
+			return nil, astera.ErrModuleNotFound
+		}
+
+		return m, nil
+	}
+
+	return &mock.Repository{
+		InsertModuleFn: func(m *astera.Module) error {
+			modules[m.Name+"@"+m.Version] = m
+			return nil
+		},
+		GetVersionInfoFn: func(name, version string) ([]byte, error) {
+			m, err := get(name, version)
+			if err != nil {
+				return nil, err
+			}
+
+			return m.Info, nil
+		},
+		GetModFileFn: func(name, version string) ([]byte, error) {
+			m, err := get(name, version)
+			if err != nil {
+				return nil, err
+			}
+
+			return m.Mod, nil
+		},
+		GetModuleZipFn: func(name, version string) ([]byte, error) {
+			m, err := get(name, version)
+			if err != nil || m.Zip == nil {
+				return nil, astera.ErrModuleNotFound
+			}
+
+			return m.Zip, nil
+		},
+		ModuleExistsFn: func(name, version string) (bool, error) {
+			_, err := get(name, version)
+			return err == nil, nil
+		},
+		HasModuleZipFn: func(name, version string) (bool, error) {
+			m, err := get(name, version)
+			return err == nil && m.Zip != nil, nil
+		},
+	}
+}
+
+// rewrite recompresses the bundle with the files changed by fn, a nil result drops the file
+func rewrite(t *testing.T, data []byte, fn func(name string, data []byte) []byte) []byte {
+	t.Helper()
+
+	zr, err := zstd.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	defer zr.Close()
+
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	require.NoError(t, err)
+
+	tr := tar.NewReader(zr)
+	tw := tar.NewWriter(zw)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+
+		content = fn(h.Name, content)
+		if content == nil {
+			continue
+		}
+
+		require.NoError(t, writeFile(tw, h.Name, content))
+	}
+
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+
+	return buf.Bytes()
+}
+
+func TestBundle(t *testing.T) {
+	t.Parallel()
+
+	source := memoryRepository(map[string]*astera.Module{
+		"github.com/!tmwalaszek/module1@v1.0.0": {
+			Name:    "github.com/!tmwalaszek/module1",
+			Version: "v1.0.0",
+			Info:    []byte(`{"Version":"v1.0.0"}`),
+			Mod:     []byte("module github.com/Tmwalaszek/module1\n"),
+			Zip:     moduleZip(t, "github.com/Tmwalaszek/module1", "v1.0.0"),
+		},
+		"github.com/tmwalaszek/module2@v0.1.0": {
+			Name:    "github.com/tmwalaszek/module2",
+			Version: "v0.1.0",
+			Info:    []byte(`{"Version":"v0.1.0"}`),
+			Mod:     []byte("module github.com/tmwalaszek/module2\n"),
+		},
+	})
+
+	modules := []modset.Module{
+		{Mod: module.Version{Path: "github.com/Tmwalaszek/module1", Version: "v1.0.0"}},
+		{Mod: module.Version{Path: "github.com/tmwalaszek/module2", Version: "v0.1.0"}, ModOnly: true},
+	}
+
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	otherPublic, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	noQuarantine := &mock.QuarantineRepository{
+		QuarantinedFn: func(string) ([]astera.Quarantine, error) { return nil, nil },
+	}
+
+	var signed, unsigned bytes.Buffer
+	manifest, err := Create(&signed, source, noQuarantine, modules, private)
+	require.NoError(t, err)
+	require.Len(t, manifest.Modules, 2)
+	require.NotNil(t, manifest.Modules[0].Zip)
+	require.Regexp(t, `^h1:`, manifest.Modules[0].ZipHash)
+	require.Nil(t, manifest.Modules[1].Zip)
+
+	_, err = Create(&unsigned, source, noQuarantine, modules, nil)
+	require.NoError(t, err)
+
+	quarantined := &mock.QuarantineRepository{
+		QuarantinedFn: func(name string) ([]astera.Quarantine, error) {
+			if name != "github.com/tmwalaszek/module2" {
+				return nil, nil
+			}
+
+			return []astera.Quarantine{{Name: name, Version: "v0.1.0", Reason: "compromised", By: "ops"}}, nil
+		},
+	}
+
+	_, err = Create(io.Discard, source, quarantined, modules, nil)
+	require.ErrorIs(t, err, astera.ErrModuleGone)
+	require.ErrorContains(t, err, "github.com/tmwalaszek/module2@v0.1.0 is quarantined")
+
+	var tt = []struct {
+		name     string
+		bundle   []byte
+		key      ed25519.PublicKey
+		stored   map[string]*astera.Module
+		imported int
+		skipped  int
+		err      string
+	}{
+		{
+			name:     "signed",
+			bundle:   signed.Bytes(),
+			key:      public,
+			imported: 2,
+		},
+		{
+			name:     "unsigned without key",
+			bundle:   unsigned.Bytes(),
+			imported: 2,
+		},
+		{
+			name:   "unsigned with key",
+			bundle: unsigned.Bytes(),
+			key:    public,
+			err:    "not signed",
+		},
+		{
+			name:   "other key",
+			bundle: signed.Bytes(),
+			key:    otherPublic,
+			err:    "bad signature",
+		},
+		{
+			name: "tampered zip",
+			bundle: rewrite(t, signed.Bytes(), func(name string, data []byte) []byte {
+				if name == "modules/github.com/!tmwalaszek/module1/@v/v1.0.0.zip" {
+					data = bytes.Clone(data)
+					data[len(data)-1] ^= 1
+				}
+
+				return data
+			}),
+			key: public,
+			err: "checksum mismatch",
+		},
+		{
+			// the files match the manifest, the zip hash it records doesn't match the zip
+			name: "wrong zip hash",
+			bundle: rewrite(t, unsigned.Bytes(), func(name string, data []byte) []byte {
+				if name == manifestName {
+					data = bytes.Replace(data, []byte(manifest.Modules[0].ZipHash), []byte("h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="), 1)
+				}
+
+				return data
+			}),
+			err: "doesn't match the recorded",
+		},
+		{
+			name: "missing mod",
+			bundle: rewrite(t, signed.Bytes(), func(name string, data []byte) []byte {
+				if name == "modules/github.com/tmwalaszek/module2/@v/v0.1.0.mod" {
+					return nil
+				}
+
+				return data
+			}),
+			key: public,
+			err: "truncated",
+		},
+		{
+			name:   "already stored",
+			bundle: signed.Bytes(),
+			key:    public,
+			stored: map[string]*astera.Module{
+				"github.com/tmwalaszek/module2@v0.1.0": {Name: "github.com/tmwalaszek/module2", Version: "v0.1.0"},
+				// stored without the zip the bundle has
+				"github.com/!tmwalaszek/module1@v1.0.0": {Name: "github.com/!tmwalaszek/module1", Version: "v1.0.0"},
+			},
+			imported: 1,
+			skipped:  1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			stored := tc.stored
+			if stored == nil {
+				stored = map[string]*astera.Module{}
+			}
+
+			report, err := Import(bytes.NewReader(tc.bundle), memoryRepository(stored), tc.key)
+			if tc.err != "" {
+				require.ErrorIs(t, err, ErrInvalidBundle)
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.imported, report.Imported)
+			require.Equal(t, tc.skipped, report.Skipped)
+			require.Equal(t, tc.key != nil, report.Signed)
+
+			m := stored["github.com/!tmwalaszek/module1@v1.0.0"]
+			require.Equal(t, astera.ModuleSourceImport, m.Source)
+			require.Equal(t, manifest.Modules[0].ZipHash, m.ZipHash)
+			require.Equal(t, "module github.com/Tmwalaszek/module1\n", string(m.Mod))
+			require.NotNil(t, m.Zip)
+			require.Nil(t, stored["github.com/tmwalaszek/module2@v0.1.0"].Zip)
+		})
+	}
+}
@@ -1,57 +1,435 @@
 package main
 
 import (
+	"astera"
+	"astera/breaker"
+	"astera/gc"
 	"astera/handler"
+	"astera/health"
+	"astera/limiter"
+	"astera/mirror"
 	"astera/modstore"
+	"astera/policy"
+	"astera/quarantine"
+	"astera/schedule"
 	"astera/sqlite3"
+	"astera/ui"
+	"context"
+	"errors"
+	"expvar"
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"net/http"
-	_ "net/http/pprof"
+	"net/http/pprof"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "publish":
+			runPublish(os.Args[2:])
+			return
+		case "bundle":
+			runBundle(os.Args[2:])
+			return
+		case "prefetch":
+			runPrefetch(os.Args[2:])
+			return
+		case "import":
+			runImport(os.Args[2:])
+			return
+		case "sync":
+			runSync(os.Args[2:])
+			return
+		case "export":
+			runExport(os.Args[2:])
+			return
+		case "gc":
+			runGC(os.Args[2:])
+			return
+		case "pin":
+			runPin(os.Args[2:])
+			return
+		case "quarantine":
+			runQuarantine(os.Args[2:])
+			return
+		}
+	}
+
+	runServer()
+}
+
+func runServer() {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		panic(err)
 	}
 
 	dbName := flag.String("db", "astera.db", "database file")
-	pprofEnable := flag.Bool("pprof", false, "enable pprof")
+	pprofEnable := flag.Bool("pprof", false, "serve pprof on localhost:6060")
 	importLocalCache := flag.Bool("import-local-cache", false, "import local cache")
 	localCacheDir := flag.String("local-cache-dir", homeDir+"/go/pkg/mod/cache/download", "local cache directory")
 	addr := flag.String("addr", ":8080", "listen address")
+	readyMinFreeMB := flag.Uint64("ready-min-free-mb", 256, "minimum free space in the temp directory for /readyz in MB")
+	readyCheckUpstream := flag.Bool("ready-check-upstream", false, "report upstream reachability in /readyz")
+	readHeaderTimeout := flag.Duration("read-header-timeout", 10*time.Second, "time allowed to read request headers")
+	readTimeout := flag.Duration("read-timeout", 1*time.Minute, "time allowed to read the whole request")
+	writeTimeout := flag.Duration("write-timeout", 10*time.Minute, "time allowed to fetch and write the response")
+	idleTimeout := flag.Duration("idle-timeout", 2*time.Minute, "keep-alive connections idle timeout")
+	accessLogPath := flag.String("access-log", "", "write JSON lines access log to this file")
+	accessLogMaxSizeMB := flag.Int64("access-log-max-size-mb", 100, "rotate the access log after it grows over this size in MB")
+	accessLogMaxBackups := flag.Int("access-log-max-backups", 5, "number of rotated access log files to keep")
+	rateLimit := flag.Float64("rate-limit", 0, "requests per second allowed per client, 0 disables the limit")
+	rateBurst := flag.Int("rate-burst", 100, "requests a client can burst over -rate-limit")
+	missRateLimit := flag.Float64("miss-rate-limit", 0, "cache misses (upstream fetches) per second allowed per client, 0 disables the limit")
+	missRateBurst := flag.Int("miss-rate-burst", 20, "cache misses a client can burst over -miss-rate-limit")
+	clientTokensFile := flag.String("client-tokens-file", "", "file of the bearer tokens, one per line, identifying the clients for the rate limits instead of their IP")
+	upstreamRetries := flag.Int("upstream-retries", 4, "how many times a transient upstream failure is retried")
+	upstreamIdleTimeout := flag.Duration("upstream-idle-timeout", 30*time.Second, "abort an upstream transfer that received no data for this long")
+	breakerThreshold := flag.Int("upstream-breaker-threshold", 5, "consecutive upstream failures that open the circuit and fail fast, 0 disables the breaker")
+	breakerCooldown := flag.Duration("upstream-breaker-cooldown", 30*time.Second, "how long the upstream circuit stays open before it is probed")
+	negativeCacheTTL := flag.Duration("negative-cache-ttl", time.Hour, "how long to remember that upstream doesn't have a module, 0 disables it")
+	upstreamMaxConns := flag.Int("upstream-max-conns", 16, "upstream HTTP requests running at once, 0 means no limit")
+	upstreamMaxConnsPerHost := flag.Int("upstream-max-conns-per-host", 8, "upstream HTTP requests running at once to a single host, 0 means no limit")
+	gitMaxProcs := flag.Int("git-max-procs", 4, "git processes running at once, 0 means no limit")
+	gitMaxProcsPerHost := flag.Int("git-max-procs-per-host", 2, "git processes running at once against a single host, 0 means no limit")
+	fetchTimeout := flag.Duration("fetch-timeout", 10*time.Minute, "time allowed to fetch and store a single module, independent of the requests waiting for it")
+	fetchInBackground := flag.Bool("fetch-in-background", false, "finish and store a module fetch even when all the requests waiting for it were cancelled")
+	jobWorkers := flag.Int("job-workers", 2, "background fetch workers, 0 disables the job queue")
+	jobMaxAttempts := flag.Int("job-max-attempts", 5, "attempts of a background fetch before it is marked failed")
+	fetchWindows := flag.String("fetch-windows", "", "comma separated HH:MM-HH:MM local time windows for prefetch and mirror jobs, empty means any time")
+	windowBudgetMB := flag.Int64("window-budget-mb", 0, "MB prefetch and mirror jobs may download per window (per day without windows), 0 means no limit")
+	prefetchDepth := flag.Int("prefetch-depth", 0, "levels of go.mod requirements of a fetched module to prefetch in the background, 0 disables the prefetch")
+	prefetchZip := flag.Bool("prefetch-zip", false, "prefetch the module zips too, not only .info and .mod")
+	fetchSlots := flag.Int("fetch-slots", 16, "upstream fetches running at once, shared fairly between clients, 0 means no limit")
+	uiEnable := flag.Bool("ui", false, "serve the web UI under /ui/, it has no authentication and shows every stored module path")
+	catalogEnable := flag.Bool("catalog", false, "serve the stored module versions under /catalog, the Athens API astera sync lists modules with")
+	adminTokenFile := flag.String("admin-token-file", "", "file holding the bearer token for the /admin/ API and /debug/vars, the env ASTERA_ADMIN_TOKEN otherwise, both are disabled without a token")
+	mirrorConfig := flag.String("mirror-config", "", "JSON file of the modules to keep fully mirrored, see README")
+	gcMaxSizeMB := flag.Int64("gc-max-size-mb", 0, "evict the least recently used versions while the database is over this size in MB, 0 means no limit")
+	gcMaxAge := flag.Duration("gc-max-age", 0, "drop the zips of the versions not accessed for this long, 0 means no limit")
+	gcInterval := flag.Duration("gc-interval", time.Hour, "how often the garbage collector runs")
+	accessFlushInterval := flag.Duration("access-flush-interval", time.Minute, "how often the last access and hits of the served versions are written")
+	policyPath := flag.String("policy", "", "JSON file of the allow and deny rules for the modules served, reloaded when it changes or on SIGHUP, see README")
+	policyWatchInterval := flag.Duration("policy-watch-interval", 5*time.Second, "how often the policy file is checked for changes")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "time to drain in-flight requests and fetches on shutdown")
 
 	flag.Parse()
 
+	// the token is never a flag, the command line is readable by anyone on the host
+	adminToken := os.Getenv("ASTERA_ADMIN_TOKEN")
+	if *adminTokenFile != "" {
+		adminToken, err = readSecret(*adminTokenFile)
+		if err != nil {
+			log.Fatalf("invalid -admin-token-file: %v", err)
+		}
+	}
+
+	var clientTokens []string
+	if *clientTokensFile != "" {
+		clientTokens, err = readTokens(*clientTokensFile)
+		if err != nil {
+			log.Fatalf("invalid -client-tokens-file: %v", err)
+		}
+	}
+
 	db, err := sqlite3.NewDB(*dbName)
 	if err != nil {
 		panic(err)
 	}
 
 	if *pprofEnable {
+		// a mux of its own, http.DefaultServeMux also has the unauthenticated /debug/vars of expvar
+		pprofMux := http.NewServeMux()
+		pprofMux.HandleFunc("/debug/pprof/", pprof.Index)
+		pprofMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		pprofMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		pprofMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		pprofMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
 		go func() {
-			log.Println(http.ListenAndServe("0.0.0.0:6060", nil))
+			log.Println(http.ListenAndServe("localhost:6060", pprofMux))
 		}()
 	}
 
-	m := modstore.NewModuleStore(db)
+	upstreamLimiter := limiter.NewHostLimiter(*upstreamMaxConns, *upstreamMaxConnsPerHost)
+	gitLimiter := limiter.NewHostLimiter(*gitMaxProcs, *gitMaxProcsPerHost)
+	expvar.Publish("upstream_requests", expvar.Func(upstreamLimiter.Stats))
+	expvar.Publish("git_processes", expvar.Func(gitLimiter.Stats))
+
+	breakers := breaker.NewSet(breaker.Config{
+		Threshold: *breakerThreshold,
+		Cooldown:  *breakerCooldown,
+		Probe:     modstore.NewGoProxyClient(modstore.GoProxyClientConfig{}).Probe,
+	})
+
+	windows, err := schedule.ParseWindows(*fetchWindows)
+	if err != nil {
+		log.Fatalf("invalid -fetch-windows: %v", err)
+	}
+
+	jobSchedule, err := schedule.New(schedule.Config{Windows: windows, Budget: *windowBudgetMB << 20, Repository: db})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var jobRepository astera.JobRepository
+	if *jobWorkers > 0 {
+		jobRepository = db
+	}
+
+	upstream := modstore.GoProxyClientConfig{
+		Retries:     *upstreamRetries,
+		IdleTimeout: *upstreamIdleTimeout,
+		Breakers:    breakers,
+		Limiter:     upstreamLimiter,
+	}
+
+	var moduleMirror *mirror.Mirror
+	if *mirrorConfig != "" {
+		if jobRepository == nil {
+			log.Fatal("-mirror-config needs the job queue, -job-workers must be above zero")
+		}
+
+		config, err := mirror.LoadConfig(*mirrorConfig)
+		if err != nil {
+			log.Fatalf("invalid -mirror-config: %v", err)
+		}
+
+		moduleMirror, err = mirror.New(config, modstore.NewGoProxyClient(upstream), db, db, os.Getenv("GOPRIVATE"))
+		if err != nil {
+			log.Fatalf("invalid -mirror-config: %v", err)
+		}
+	}
+
+	var modulePolicy *policy.Engine
+	if *policyPath != "" {
+		modulePolicy, err = policy.Load(*policyPath)
+		if err != nil {
+			log.Fatalf("invalid -policy: %v", err)
+		}
+
+		modulePolicy.Watch(*policyWatchInterval)
+
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		modulePolicy.ReloadOnSignal(hup)
+	}
+
+	quarantines, err := quarantine.New(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// picks up the changes of astera quarantine
+	quarantines.Start(0)
+
+	m := modstore.NewModuleStore(db, modstore.Config{
+		Upstream:        upstream,
+		MissRate:        *missRateLimit,
+		MissBurst:       *missRateBurst,
+		FetchSlots:      *fetchSlots,
+		VCSLimiter:      gitLimiter,
+		NegativeCache:   db,
+		NegativeTTL:     *negativeCacheTTL,
+		FetchTimeout:    *fetchTimeout,
+		BackgroundFetch: *fetchInBackground,
+		Jobs:            jobRepository,
+		JobWorkers:      *jobWorkers,
+		JobMaxAttempts:  *jobMaxAttempts,
+		JobSchedule:     jobSchedule,
+		PrefetchDepth:   *prefetchDepth,
+		PrefetchZip:     *prefetchZip,
+		Imports:         db,
+		Mirror:          moduleMirror,
+		Access:          db,
+		Quarantine:      quarantines,
+		Policy:          modulePolicy,
+		Releases:        db,
+
+		AccessFlushInterval: *accessFlushInterval,
+	})
+	quarantines.Purge = m.PurgeNegativeCache
+	m.Start()
+
+	collector := gc.New(db, gc.Config{
+		MaxSize:  *gcMaxSizeMB << 20,
+		MaxAge:   *gcMaxAge,
+		Interval: *gcInterval,
+		Private:  os.Getenv("GOPRIVATE"),
+	})
+	collector.Start()
 	if *importLocalCache {
-		err = m.ImportCachedModules(*localCacheDir)
+		report, err := m.ImportCachedModules(context.Background(), *localCacheDir, astera.ImportOptions{})
 		if err != nil {
 			panic(err)
 		}
+
+		slog.Info("imported local cache", "dir", report.Dir, "imported", report.Imported, "skipped", report.Skipped,
+			"failed", len(report.Failed), "elapsed", report.Elapsed)
 	}
 
 	h := handler.NewHandler(m)
 
+	checker := health.New(5 * time.Second)
+	checker.Register("database", true, db.Ping)
+	checker.Register("database_writable", true, db.CheckWritable)
+	checker.Register("temp_dir", true, health.DiskSpace(os.TempDir(), *readyMinFreeMB<<20))
+	if breakers != nil {
+		checker.Register("upstream_circuit", false, breakers.Check)
+	}
+	if *readyCheckUpstream {
+		checker.Register("upstream", false, modstore.NewGoProxyClient(modstore.GoProxyClientConfig{}).Ping)
+	}
+
+	healthHandler := handler.NewHealth(checker)
+
+	var accessLog io.Writer
+	if *accessLogPath != "" {
+		rotatingFile, err := handler.NewRotatingFile(*accessLogPath, *accessLogMaxSizeMB<<20, *accessLogMaxBackups)
+		if err != nil {
+			panic(err)
+		}
+
+		defer rotatingFile.Close()
+		accessLog = rotatingFile
+	}
+
+	requestLimiter := limiter.NewKeyedLimiter(*rateLimit, *rateBurst)
+
 	mux := http.NewServeMux()
-	mux.Handle("/", handler.LoggerMiddlerware(h))
+	mux.HandleFunc("/healthz", healthHandler.Liveness)
+	mux.HandleFunc("/readyz", healthHandler.Readiness)
+	if adminToken != "" {
+		// expvar publishes the command line and the memory stats too
+		mux.Handle("/debug/vars", handler.RequireToken(expvar.Handler(), adminToken))
+	}
+	if *uiEnable {
+		mux.Handle("/ui/", handler.LoggerMiddlerware(ui.New(db, os.Getenv("GOPRIVATE")), accessLog))
+	}
+	if *catalogEnable {
+		// unauthenticated, it shares the request rate limit of the clients
+		catalog := handler.RateLimitMiddleware(handler.NewCatalog(db, os.Getenv("GOPRIVATE")), requestLimiter)
+		mux.Handle("/catalog", handler.LoggerMiddlerware(catalog, accessLog))
+	}
+	if adminToken != "" {
+		admin := handler.NewAdmin(db, m, adminToken)
+		admin.ServeSchedule(jobSchedule)
+		if moduleMirror != nil {
+			admin.ServeMirror(moduleMirror)
+		}
+		if collector != nil {
+			admin.ServeGC(collector)
+		}
+		admin.ServePins(db)
+		admin.ServeQuarantine(quarantines)
+		if modulePolicy != nil {
+			admin.ServePolicy(modulePolicy)
+		}
+		mux.Handle("/admin/", handler.LoggerMiddlerware(admin, accessLog))
+	}
+	rateLimited := handler.RateLimitMiddleware(h, requestLimiter)
+	mux.Handle("/", handler.LoggerMiddlerware(handler.ClientTokenMiddleware(rateLimited, clientTokens), accessLog))
 
-	err = http.ListenAndServe(*addr, mux)
-	if err != nil {
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: *readHeaderTimeout,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serveErr:
 		panic(err)
+	case <-ctx.Done():
 	}
+
+	// second signal kills the process immediately
+	stop()
+
+	slog.Info("shutting down", "timeout", *shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	err = srv.Shutdown(shutdownCtx)
+	if err != nil {
+		slog.Error("failed to drain in-flight requests", "err", err)
+		_ = srv.Close()
+	}
+
+	collector.Stop()
+	quarantines.Stop()
+	modulePolicy.Stop()
+	breakers.Stop()
+
+	err = m.Shutdown(shutdownCtx)
+	if err != nil {
+		slog.Error("failed to drain in-flight fetches", "err", err)
+	}
+
+	err = db.Close()
+	if err != nil {
+		slog.Error("failed to close database", "err", err)
+		os.Exit(1)
+	}
+
+	if err = <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("server failed", "err", err)
+	}
+
+	slog.Info("shutdown complete")
+}
+
+// readSecret reads the single token of the file
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+
+	return secret, nil
+}
+
+// readTokens reads one token per line, the empty lines and the # comments are skipped
+func readTokens(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []string
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		tokens = append(tokens, line)
+	}
+
+	return tokens, nil
 }
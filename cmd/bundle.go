@@ -0,0 +1,226 @@
+package main
+
+import (
+	"astera"
+	"astera/bundle"
+	"astera/modstore"
+	"astera/sqlite3"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+func runBundle(args []string) {
+	usage := "Usage: astera bundle create|import|keygen [flags] ...\n"
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "create":
+		runBundleCreate(args[1:])
+	case "import":
+		runBundleImport(args[1:])
+	case "keygen":
+		runBundleKeygen(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func runBundleCreate(args []string) {
+	fs := flag.NewFlagSet("bundle create", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: astera bundle create [flags] -o <bundle.tar.zst> <go.mod|go.sum|go.work|dir>...\n")
+		fs.PrintDefaults()
+	}
+
+	dbName := fs.String("db", "astera.db", "database file, missing modules are fetched into it")
+	output := fs.String("o", "", "bundle file to write")
+	keyFile := fs.String("key", "", "ed25519 private key (PEM) to sign the bundle with, the bundle is unsigned when empty")
+	workers := fs.Int("workers", 8, "modules fetched at once")
+
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 || *output == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var key ed25519.PrivateKey
+	if *keyFile != "" {
+		data, err := os.ReadFile(*keyFile)
+		if err != nil {
+			fatal(err)
+		}
+
+		key, err = bundle.ParsePrivateKey(data)
+		if err != nil {
+			fatal(fmt.Errorf("%s: %w", *keyFile, err))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := sqlite3.NewDB(*dbName)
+	if err != nil {
+		fatal(err)
+	}
+
+	m := modstore.NewModuleStore(db, modstore.Config{
+		Upstream:   modstore.GoProxyClientConfig{Retries: 4, IdleTimeout: 30 * time.Second},
+		FetchSlots: *workers,
+		Quarantine: db,
+	})
+
+	err = createBundle(ctx, m, db, fs.Args(), *output, key, *workers)
+
+	err = errors.Join(err, m.Shutdown(context.Background()), db.Close())
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func createBundle(ctx context.Context, m astera.GoProxyService, db *sqlite3.DB, paths []string, output string,
+	key ed25519.PrivateKey, workers int,
+) error {
+	modules, err := resolveModules(ctx, m, paths, resolveGraph, workers)
+	if err != nil {
+		return err
+	}
+
+	fetched := fetchModules(ctx, m, modules, workers)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if len(fetched) < len(modules) {
+		return fmt.Errorf("%d modules couldn't be fetched, the bundle would be incomplete", len(modules)-len(fetched))
+	}
+
+	// written next to the output and renamed, a failed run leaves no partial bundle behind
+	f, err := os.CreateTemp(filepath.Dir(output), ".bundle-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	manifest, err := bundle.Create(f, db, db, modules, key)
+	err = errors.Join(err, f.Chmod(0o644), f.Close())
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(f.Name(), output)
+	if err != nil {
+		return err
+	}
+
+	signed := "unsigned"
+	if key != nil {
+		signed = "signed"
+	}
+
+	fmt.Printf("wrote %s bundle %s with %d module versions\n", signed, output, len(manifest.Modules))
+
+	return nil
+}
+
+func runBundleImport(args []string) {
+	fs := flag.NewFlagSet("bundle import", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: astera bundle import [flags] <bundle.tar.zst>\n")
+		fs.PrintDefaults()
+	}
+
+	dbName := fs.String("db", "astera.db", "database file")
+	pubFile := fs.String("pub", "", "ed25519 public key (PEM) the bundle must be signed with")
+	unsigned := fs.Bool("unsigned", false, "import without checking the signature, the checksums are still verified")
+
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || (*pubFile == "") == !*unsigned {
+		if fs.NArg() == 1 {
+			fmt.Fprintln(fs.Output(), "exactly one of -pub or -unsigned is required")
+		}
+
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var key ed25519.PublicKey
+	if *pubFile != "" {
+		data, err := os.ReadFile(*pubFile)
+		if err != nil {
+			fatal(err)
+		}
+
+		key, err = bundle.ParsePublicKey(data)
+		if err != nil {
+			fatal(fmt.Errorf("%s: %w", *pubFile, err))
+		}
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+
+	defer f.Close()
+
+	db, err := sqlite3.NewDB(*dbName)
+	if err != nil {
+		fatal(err)
+	}
+
+	report, err := bundle.Import(f, db, key)
+	err = errors.Join(err, db.Close())
+	if report != nil && report.Manifest != nil {
+		fmt.Printf("%s: bundle of %d module versions created %s, imported %d, skipped %d already stored\n",
+			fs.Arg(0), len(report.Manifest.Modules), report.Manifest.Created.Format(time.RFC3339), report.Imported, report.Skipped)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func runBundleKeygen(args []string) {
+	fs := flag.NewFlagSet("bundle keygen", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: astera bundle keygen <name>\n\nwrites the signing key to <name>.key and the public key to <name>.pub\n")
+		fs.PrintDefaults()
+	}
+
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	public, private, err := bundle.GenerateKey()
+	if err != nil {
+		fatal(err)
+	}
+
+	name := fs.Arg(0)
+	err = os.WriteFile(name+".key", private, 0o600)
+	if err == nil {
+		err = os.WriteFile(name+".pub", public, 0o644)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Printf("wrote %s.key and %s.pub\n", name, name)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"astera/exporter"
+	"astera/sqlite3"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: astera export [flags] <dir>\n\n"+
+			"dir gets the module cache download layout, use it with GOPROXY=file://<dir> or as <GOMODCACHE>/cache/download\n")
+		fs.PrintDefaults()
+	}
+
+	dbName := fs.String("db", "astera.db", "database file")
+	modules := fs.String("modules", "", "comma separated module path patterns to export, in the GOPRIVATE syntax, empty exports everything")
+
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	db, err := sqlite3.NewDB(*dbName)
+	if err != nil {
+		fatal(err)
+	}
+
+	report, err := exporter.New(db, exporter.Options{Modules: *modules}).Run(fs.Arg(0))
+	err = errors.Join(err, db.Close())
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Printf("%s: exported %d modules, %d versions (%d MB, %d without zip) in %s\n",
+		report.Dir, report.Modules, report.Versions, report.Bytes>>20, report.Partial, report.Elapsed.Round(time.Millisecond))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"astera/gc"
+	"astera/sqlite3"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func runGC(args []string) {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: astera gc [flags] -max-size-mb <MB>|-max-age <duration>|-convert-vacuum\n")
+		fs.PrintDefaults()
+	}
+
+	dbName := fs.String("db", "astera.db", "database file")
+	maxSizeMB := fs.Int64("max-size-mb", 0, "evict the least recently used versions while the database is over this size in MB")
+	maxAge := fs.Duration("max-age", 0, "drop the zips of the versions not accessed for this long")
+	dryRun := fs.Bool("dry-run", false, "report what would be evicted without changing anything")
+	convertVacuum := fs.Bool("convert-vacuum", false,
+		"switch a database created before the incremental vacuum to it with a full VACUUM, astera must not be running")
+
+	_ = fs.Parse(args)
+
+	config := gc.Config{
+		MaxSize: *maxSizeMB << 20,
+		MaxAge:  *maxAge,
+		Private: os.Getenv("GOPRIVATE"),
+		DryRun:  *dryRun,
+	}
+
+	// the conversion alone needs no limits
+	limited := *maxSizeMB != 0 || *maxAge != 0 || !*convertVacuum
+	if fs.NArg() > 0 || limited && config.Validate() != nil {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := sqlite3.NewDB(*dbName)
+	if err != nil {
+		fatal(err)
+	}
+
+	if *convertVacuum {
+		converted, err := db.ConvertVacuum(ctx)
+		if err != nil {
+			fatal(errors.Join(err, db.Close()))
+		}
+
+		if converted {
+			fmt.Println("converted the database to incremental vacuum")
+		} else {
+			fmt.Println("the database already uses incremental vacuum")
+		}
+	}
+
+	if !limited {
+		if err := db.Close(); err != nil {
+			fatal(err)
+		}
+
+		return
+	}
+
+	report, err := gc.New(db, config).Run(ctx)
+	if report != nil {
+		fmt.Printf("size %d MB -> %d MB, dropped %d zips, deleted %d versions, freed %d MB in %s\n",
+			report.SizeBefore>>20, report.SizeAfter>>20, report.DroppedZips, report.Deleted, report.Freed>>20,
+			report.Elapsed.Round(time.Millisecond))
+		if report.DryRun {
+			fmt.Println("dry run, nothing was evicted")
+		}
+	}
+
+	err = errors.Join(err, db.Close())
+	if err != nil {
+		fatal(err)
+	}
+}
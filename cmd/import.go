@@ -0,0 +1,102 @@
+package main
+
+import (
+	"astera"
+	"astera/importer"
+	"astera/sqlite3"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: astera import [flags] [dir]\n\ndir defaults to $GOMODCACHE/cache/download, a GOPROXY directory has the same layout\n")
+		fs.PrintDefaults()
+	}
+
+	dbName := fs.String("db", "astera.db", "database file")
+	layout := fs.String("layout", astera.ImportLayoutDownload, "directory layout, download (module cache or GOPROXY directory) or athens (Athens disk storage)")
+	workers := fs.Int("workers", 4, "module directories read at once")
+	batchSize := fs.Int("batch", 64, "versions inserted in a single transaction")
+	dryRun := fs.Bool("dry-run", false, "read and validate the cache without storing anything")
+	restart := fs.Bool("restart", false, "import everything again, ignoring the progress of a previous import")
+
+	_ = fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	dir := fs.Arg(0)
+	if dir == "" && *layout == astera.ImportLayoutDownload {
+		dir = defaultModCacheDir()
+	} else if dir == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := sqlite3.NewDB(*dbName)
+	if err != nil {
+		fatal(err)
+	}
+
+	report, err := importer.New(db, astera.ImportOptions{
+		Layout:    *layout,
+		Workers:   *workers,
+		BatchSize: *batchSize,
+		DryRun:    *dryRun,
+		Restart:   *restart,
+	}).Run(ctx, dir)
+	if report != nil {
+		printReport(report)
+	}
+
+	err = errors.Join(err, db.Close())
+	if err != nil {
+		fatal(err)
+	}
+
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+func defaultModCacheDir() string {
+	modCache := os.Getenv("GOMODCACHE")
+	if modCache == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			fatal(err)
+		}
+
+		modCache = filepath.Join(homeDir, "go", "pkg", "mod")
+	}
+
+	return filepath.Join(modCache, "cache", "download")
+}
+
+func printReport(report *astera.ImportReport) {
+	verb := "imported"
+	if report.DryRun {
+		verb = "would import"
+	}
+
+	fmt.Printf("%s: %d modules, %s %d versions (%d MB), skipped %d imported before or stored, %d failed in %s\n",
+		report.Dir, report.Modules, verb, report.Imported, report.Bytes>>20, report.Skipped, len(report.Failed),
+		report.Elapsed.Round(time.Millisecond))
+
+	for _, f := range report.Failed {
+		fmt.Printf("  %s@%s: %s\n", f.Name, f.Version, f.Err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"astera"
+	"astera/sqlite3"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+func runPin(args []string) {
+	usage := "Usage: astera pin add|rm|ls [flags] ...\n"
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "add":
+		runPinAdd(args[1:])
+	case "rm":
+		runPinRemove(args[1:])
+	case "ls":
+		runPinList(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func runPinAdd(args []string) {
+	fs := flag.NewFlagSet("pin add", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: astera pin add [flags] -reason <reason> <module@version|module pattern>...\n")
+		fs.PrintDefaults()
+	}
+
+	dbName := fs.String("db", "astera.db", "database file")
+	reason := fs.String("reason", "", "why the versions must be kept, for example the release branch needing them")
+	owner := fs.String("owner", os.Getenv("USER"), "who to ask before removing the pin")
+
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	pins := make([]*astera.Pin, 0, fs.NArg())
+	for _, arg := range fs.Args() {
+		module, version, _ := strings.Cut(arg, "@")
+
+		pin := &astera.Pin{Module: module, Version: version, Reason: *reason, Owner: *owner}
+		err := pin.Check()
+		if err != nil {
+			fatal(fmt.Errorf("%s: %w", arg, err))
+		}
+
+		pins = append(pins, pin)
+	}
+
+	db, err := sqlite3.NewDB(*dbName)
+	if err != nil {
+		fatal(err)
+	}
+
+	for _, pin := range pins {
+		err = db.AddPin(pin)
+		if err != nil {
+			break
+		}
+	}
+
+	err = errors.Join(err, db.Close())
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func runPinRemove(args []string) {
+	fs := flag.NewFlagSet("pin rm", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: astera pin rm [flags] <module@version|module pattern>...\n")
+		fs.PrintDefaults()
+	}
+
+	dbName := fs.String("db", "astera.db", "database file")
+
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	db, err := sqlite3.NewDB(*dbName)
+	if err != nil {
+		fatal(err)
+	}
+
+	for _, arg := range fs.Args() {
+		module, version, _ := strings.Cut(arg, "@")
+
+		var removed bool
+		removed, err = db.RemovePin(module, version)
+		if err != nil {
+			break
+		}
+
+		if !removed {
+			fmt.Fprintf(os.Stderr, "%s is not pinned\n", arg)
+		}
+	}
+
+	err = errors.Join(err, db.Close())
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func runPinList(args []string) {
+	fs := flag.NewFlagSet("pin ls", flag.ExitOnError)
+	dbName := fs.String("db", "astera.db", "database file")
+
+	_ = fs.Parse(args)
+
+	db, err := sqlite3.NewDB(*dbName)
+	if err != nil {
+		fatal(err)
+	}
+
+	pins, err := db.ListPins()
+	err = errors.Join(err, db.Close())
+	if err != nil {
+		fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODULE\tVERSION\tOWNER\tREASON\tCREATED")
+	for _, pin := range pins {
+		version := pin.Version
+		if version == "" {
+			version = "*"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", pin.Module, version, pin.Owner, pin.Reason, pin.CreatedAt.Format("2006-01-02 15:04"))
+	}
+
+	_ = w.Flush()
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"astera"
+	"astera/modset"
+	"astera/modstore"
+	"astera/sqlite3"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/mod/module"
+)
+
+func runPrefetch(args []string) {
+	fs := flag.NewFlagSet("prefetch", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: astera prefetch [flags] <go.mod|go.sum|go.work|dir>...\n")
+		fs.PrintDefaults()
+	}
+
+	dbName := fs.String("db", "astera.db", "database file")
+	all := fs.Bool("all", false, "fetch the whole MVS build list, reading the go.mod of every requirement, not only the listed modules")
+	workers := fs.Int("workers", 8, "modules fetched at once")
+	upstreamRetries := fs.Int("upstream-retries", 4, "how many times a transient upstream failure is retried")
+	fetchTimeout := fs.Duration("fetch-timeout", 10*time.Minute, "time allowed to fetch and store a single module")
+
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := sqlite3.NewDB(*dbName)
+	if err != nil {
+		fatal(err)
+	}
+
+	m := modstore.NewModuleStore(db, modstore.Config{
+		Upstream: modstore.GoProxyClientConfig{
+			Retries:     *upstreamRetries,
+			IdleTimeout: 30 * time.Second,
+		},
+		FetchSlots:   *workers,
+		FetchTimeout: *fetchTimeout,
+		Quarantine:   db,
+	})
+
+	failed, err := prefetch(ctx, m, fs.Args(), *all, *workers)
+
+	err = errors.Join(err, m.Shutdown(context.Background()), db.Close())
+	if err != nil {
+		fatal(err)
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// prefetch stores the modules of the files in the database, it returns the number of modules that failed
+func prefetch(ctx context.Context, m astera.GoProxyService, paths []string, all bool, workers int) (int, error) {
+	mode := resolveListed
+	if all {
+		mode = resolveBuildList
+	}
+
+	modules, err := resolveModules(ctx, m, paths, mode, workers)
+	if err != nil {
+		return 0, err
+	}
+
+	fetched := fetchModules(ctx, m, modules, workers)
+
+	return len(modules) - len(fetched), ctx.Err()
+}
+
+// resolveMode is which module versions of the files resolveModules returns
+type resolveMode int
+
+const (
+	// the versions the files list
+	resolveListed resolveMode = iota
+	// the MVS build list of the files, for prefetch -all
+	resolveBuildList
+	// the listed versions, the build list and, with only their go.mod, the versions visited to compute
+	// it, everything a bundle needs for the go command to build offline
+	resolveGraph
+)
+
+// resolveModules returns the module versions of the files selected by mode
+func resolveModules(ctx context.Context, m astera.GoProxyService, paths []string, mode resolveMode, workers int) ([]modset.Module, error) {
+	var modules []modset.Module
+	for _, path := range paths {
+		s, err := modset.Load(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if mode != resolveBuildList {
+			modules = append(modules, s.Modules()...)
+		}
+
+		if mode == resolveListed {
+			continue
+		}
+
+		fmt.Printf("resolving the build list of %s\n", path)
+
+		var mx sync.Mutex
+		var visited []module.Version
+		list, err := modset.BuildList(ctx, s, workers, func(ctx context.Context, v module.Version) ([]byte, error) {
+			name, version, err := escape(v)
+			if err != nil {
+				return nil, err
+			}
+
+			err = m.FetchModule(ctx, name, version, false)
+			if err != nil {
+				return nil, err
+			}
+
+			mx.Lock()
+			visited = append(visited, v)
+			mx.Unlock()
+
+			return m.Query(ctx, name+"/@v/"+version+".mod")
+		})
+		if err != nil {
+			fmt.Printf("incomplete build list of %s: %v\n", path, err)
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		for _, v := range list {
+			if target, ok := s.Resolve(v); ok {
+				modules = append(modules, modset.Module{Mod: target})
+			}
+		}
+
+		if mode != resolveGraph {
+			continue
+		}
+
+		// the go command reads the go.mod of every version in the module graph
+		for _, v := range visited {
+			modules = append(modules, modset.Module{Mod: v, ModOnly: true})
+		}
+	}
+
+	return dedupe(modules), nil
+}
+
+// fetchModules stores the modules in the database with progress output, it returns the ones fetched
+func fetchModules(ctx context.Context, m astera.GoProxyService, modules []modset.Module, workers int) []modset.Module {
+	var done atomic.Int64
+	var mx sync.Mutex
+	var failures []string
+	fetched := make([]bool, len(modules))
+
+	sem := make(chan struct{}, max(workers, 1))
+	var wg sync.WaitGroup
+	for i, mod := range modules {
+		if ctx.Err() != nil {
+			break
+		}
+
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+
+			err := fetchModule(ctx, m, mod)
+
+			n := done.Add(1)
+			status := "ok"
+			if err != nil {
+				status = "failed"
+
+				mx.Lock()
+				failures = append(failures, fmt.Sprintf("%s@%s: %v", mod.Mod.Path, mod.Mod.Version, err))
+				mx.Unlock()
+			} else {
+				fetched[i] = true
+			}
+
+			fmt.Printf("[%d/%d] %s %s@%s\n", n, len(modules), status, mod.Mod.Path, mod.Mod.Version)
+		})
+	}
+
+	wg.Wait()
+
+	ok := make([]modset.Module, 0, len(modules))
+	for i, mod := range modules {
+		if fetched[i] {
+			ok = append(ok, mod)
+		}
+	}
+
+	fmt.Printf("fetched %d of %d modules\n", len(ok), len(modules))
+	if len(failures) > 0 {
+		fmt.Printf("%d failed:\n", len(failures))
+		for _, f := range failures {
+			fmt.Printf("  %s\n", f)
+		}
+	}
+
+	return ok
+}
+
+// dedupe drops the versions listed by several files, a version is ModOnly only if all of them say so
+func dedupe(modules []modset.Module) []modset.Module {
+	index := make(map[module.Version]int, len(modules))
+	unique := modules[:0]
+	for _, mod := range modules {
+		if i, ok := index[mod.Mod]; ok {
+			unique[i].ModOnly = unique[i].ModOnly && mod.ModOnly
+			continue
+		}
+
+		index[mod.Mod] = len(unique)
+		unique = append(unique, mod)
+	}
+
+	return unique
+}
+
+func fetchModule(ctx context.Context, m astera.GoProxyService, mod modset.Module) error {
+	name, version, err := escape(mod.Mod)
+	if err != nil {
+		return err
+	}
+
+	return m.FetchModule(ctx, name, version, !mod.ModOnly)
+}
+
+func escape(v module.Version) (string, string, error) {
+	name, err := module.EscapePath(v.Path)
+	if err != nil {
+		return "", "", err
+	}
+
+	version, err := module.EscapeVersion(v.Version)
+	if err != nil {
+		return "", "", err
+	}
+
+	return name, version, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"astera/publish"
+	"astera/sqlite3"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+func runPublish(args []string) {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: astera publish [flags] <dir> <version>\n")
+		fs.PrintDefaults()
+	}
+
+	dbName := fs.String("db", "astera.db", "database file, used when -server is not set")
+	server := fs.String("server", "", "publish through the admin API of a running astera, e.g. http://host:8080")
+	token := fs.String("token", os.Getenv("ASTERA_ADMIN_TOKEN"), "admin token for -server (env ASTERA_ADMIN_TOKEN)")
+	modulePath := fs.String("module", "", "module path, read from go.mod when empty")
+
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	m, err := publish.FromDir(fs.Arg(0), *modulePath, fs.Arg(1))
+	if err != nil {
+		fatal(err)
+	}
+
+	if *server != "" {
+		err = uploadModule(*server, *token, m.Name, m.Version, m.Zip)
+	} else {
+		var db *sqlite3.DB
+		db, err = sqlite3.NewDB(*dbName)
+		if err != nil {
+			fatal(err)
+		}
+
+		err = publish.Publish(db, m)
+		err = errors.Join(err, db.Close())
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Printf("published %s@%s %s\n", m.Name, m.Version, m.ZipHash)
+}
+
+// uploadModule sends the zip to the admin API, name and version are already escaped
+func uploadModule(server, token, name, version string, zip []byte) error {
+	u, err := url.JoinPath(server, "admin", "publish", name, "@v", version)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, u, bytes.NewReader(zip))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/zip")
+
+	client := &http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("publish failed with status code %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"astera"
+	"astera/sqlite3"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/mod/module"
+)
+
+func runQuarantine(args []string) {
+	usage := "Usage: astera quarantine add|rm|ls|log [flags] ...\n"
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "add":
+		runQuarantineChange(args[1:], true)
+	case "rm":
+		runQuarantineChange(args[1:], false)
+	case "ls":
+		runQuarantineList(args[1:])
+	case "log":
+		runQuarantineLog(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// runQuarantineChange quarantines the versions, or releases them when add is false
+func runQuarantineChange(args []string, add bool) {
+	name := "quarantine rm"
+	if add {
+		name = "quarantine add"
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: astera %s [flags] -reason <reason> <module@version>...\n", name)
+		fs.PrintDefaults()
+	}
+
+	dbName := fs.String("db", "astera.db", "database file")
+	reason := fs.String("reason", "", "why, recorded in the audit trail")
+	by := fs.String("by", os.Getenv("USER"), "who asks for it, recorded in the audit trail")
+
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 || *by == "" || (add && *reason == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	type moduleVersion struct{ name, version string }
+
+	versions := make([]moduleVersion, 0, fs.NArg())
+	for _, arg := range fs.Args() {
+		modulePath, version, _ := strings.Cut(arg, "@")
+
+		err := module.Check(modulePath, version)
+		if err != nil {
+			fatal(err)
+		}
+
+		escapedPath, _ := module.EscapePath(modulePath)
+		escapedVersion, _ := module.EscapeVersion(version)
+		versions = append(versions, moduleVersion{escapedPath, escapedVersion})
+	}
+
+	db, err := sqlite3.NewDB(*dbName)
+	if err != nil {
+		fatal(err)
+	}
+
+	for i, v := range versions {
+		if add {
+			err = db.Quarantine(&astera.Quarantine{Name: v.name, Version: v.version, Reason: *reason, By: *by})
+		} else {
+			var released bool
+			released, err = db.Release(v.name, v.version, *by, *reason)
+			if err == nil && !released {
+				fmt.Fprintf(os.Stderr, "%s is not quarantined\n", fs.Arg(i))
+			}
+
+			// a negative entry kept while it was quarantined would still answer 410 Gone
+			if err == nil && released {
+				_, err = db.PurgeNegative(v.name)
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	err = errors.Join(err, db.Close())
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func runQuarantineList(args []string) {
+	fs := flag.NewFlagSet("quarantine ls", flag.ExitOnError)
+	dbName := fs.String("db", "astera.db", "database file")
+
+	_ = fs.Parse(args)
+
+	db, err := sqlite3.NewDB(*dbName)
+	if err != nil {
+		fatal(err)
+	}
+
+	quarantines, err := db.ListQuarantines()
+	err = errors.Join(err, db.Close())
+	if err != nil {
+		fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODULE\tVERSION\tBY\tREASON\tSINCE")
+	for _, q := range quarantines {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", q.Name, q.Version, q.By, q.Reason, q.CreatedAt.Format("2006-01-02 15:04"))
+	}
+
+	_ = w.Flush()
+}
+
+func runQuarantineLog(args []string) {
+	fs := flag.NewFlagSet("quarantine log", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: astera quarantine log [flags] [module]\n")
+		fs.PrintDefaults()
+	}
+
+	dbName := fs.String("db", "astera.db", "database file")
+	limit := fs.Int("n", 100, "number of entries, newest first")
+
+	_ = fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	name, err := module.EscapePath(fs.Arg(0))
+	if fs.NArg() == 0 {
+		name, err = "", nil
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+
+	db, err := sqlite3.NewDB(*dbName)
+	if err != nil {
+		fatal(err)
+	}
+
+	events, err := db.QuarantineAudit(name, *limit)
+	err = errors.Join(err, db.Close())
+	if err != nil {
+		fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AT\tACTION\tMODULE\tVERSION\tBY\tREASON")
+	for _, e := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.At.Format("2006-01-02 15:04:05"), e.Action, e.Name, e.Version, e.By, e.Reason)
+	}
+
+	_ = w.Flush()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"astera"
+	"astera/importer"
+	"astera/modstore"
+	"astera/sqlite3"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func runSync(args []string) {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: astera sync [flags] -from <GOPROXY URL>\n")
+		fs.PrintDefaults()
+	}
+
+	dbName := fs.String("db", "astera.db", "database file")
+	from := fs.String("from", "", "GOPROXY to copy the modules from")
+	modules := fs.String("modules", "", "comma separated module path globs in the GOPRIVATE syntax, wildcards need a proxy serving /catalog (Athens, astera -catalog), empty copies the whole catalog")
+	workers := fs.Int("workers", 4, "modules downloaded at once")
+	batchSize := fs.Int("batch", 64, "versions inserted in a single transaction")
+	dryRun := fs.Bool("dry-run", false, "download and validate the modules without storing anything")
+	restart := fs.Bool("restart", false, "ignore the progress of a previous sync from the same proxy")
+	retries := fs.Int("retries", 4, "retries of a failed request")
+
+	_ = fs.Parse(args)
+	if fs.NArg() > 0 || *from == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := sqlite3.NewDB(*dbName)
+	if err != nil {
+		fatal(err)
+	}
+
+	client := modstore.NewGoProxyClient(modstore.GoProxyClientConfig{URL: *from, Retries: *retries, IdleTimeout: 30 * time.Second})
+
+	report, err := importer.New(db, astera.ImportOptions{
+		Workers:   *workers,
+		BatchSize: *batchSize,
+		DryRun:    *dryRun,
+		Restart:   *restart,
+	}).Sync(ctx, client, *from, *modules)
+	if report != nil {
+		printReport(report)
+	}
+
+	err = errors.Join(err, db.Close())
+	if err != nil {
+		fatal(err)
+	}
+
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
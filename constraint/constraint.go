@@ -0,0 +1,140 @@
+package constraint
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// comparison is a single operator and version, like ">= v1.5.0"
+type comparison struct {
+	op      string
+	version string
+}
+
+func (c comparison) match(version string) bool {
+	cmp := semver.Compare(version, c.version)
+
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+
+	return false
+}
+
+// Constraint is a semver range like ">= v1.5.0, < v2 || v2.3.1". The comparisons separated by
+// commas must all match, the groups separated by || are alternatives. A comparison without an
+// operator means "=", a version without its minor or patch is the .0 one. The build metadata is
+// ignored, so v2.0.0+incompatible matches "= v2.0.0". The zero Constraint matches every version.
+type Constraint struct {
+	source string
+	groups [][]comparison
+}
+
+// operators ordered so the two character ones are tried first
+var operators = []string{">=", "<=", "!=", ">", "<", "="}
+
+func Parse(s string) (Constraint, error) {
+	c := Constraint{source: strings.TrimSpace(s)}
+	if c.source == "" {
+		return c, nil
+	}
+
+	for group := range strings.SplitSeq(c.source, "||") {
+		var comparisons []comparison
+		for part := range strings.SplitSeq(group, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				return Constraint{}, fmt.Errorf("invalid constraint %q: empty comparison", s)
+			}
+
+			op := "="
+			for _, candidate := range operators {
+				if rest, ok := strings.CutPrefix(part, candidate); ok {
+					op = candidate
+					part = strings.TrimSpace(rest)
+					break
+				}
+			}
+
+			version := part
+			if !strings.HasPrefix(version, "v") {
+				version = "v" + version
+			}
+
+			if !semver.IsValid(version) {
+				return Constraint{}, fmt.Errorf("invalid constraint %q: invalid version %q", s, part)
+			}
+
+			comparisons = append(comparisons, comparison{op: op, version: version})
+		}
+
+		c.groups = append(c.groups, comparisons)
+	}
+
+	return c, nil
+}
+
+// Match reports whether the version is in the range, an invalid version never is unless the
+// constraint is empty
+func (c Constraint) Match(version string) bool {
+	if c.IsEmpty() {
+		return true
+	}
+
+	if !semver.IsValid(version) {
+		return false
+	}
+
+	for _, group := range c.groups {
+		matched := true
+		for _, comparison := range group {
+			if !comparison.match(version) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c Constraint) IsEmpty() bool {
+	return len(c.groups) == 0
+}
+
+func (c Constraint) String() string {
+	return c.source
+}
+
+func (c Constraint) MarshalText() ([]byte, error) {
+	return []byte(c.source), nil
+}
+
+// UnmarshalText parses the constraint, so it can be used directly in JSON configs
+func (c *Constraint) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+
+	*c = parsed
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package constraint
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConstraint(t *testing.T) {
+	t.Parallel()
+
+	var tt = []struct {
+		constraint string
+		match      []string
+		noMatch    []string
+		err        bool
+	}{
+		{
+			constraint: "",
+			match:      []string{"v0.1.0", "v2.0.0+incompatible", "invalid"},
+		},
+		{
+			constraint: ">= v1.5.0",
+			match:      []string{"v1.5.0", "v1.10.0", "v3.0.0+incompatible"},
+			noMatch:    []string{"v1.4.9", "v1.5.0-rc.1", "invalid"},
+		},
+		{
+			constraint: ">=v1.5.0, <v2",
+			match:      []string{"v1.5.0", "v1.99.0"},
+			noMatch:    []string{"v2.0.0", "v2.0.0+incompatible", "v1.4.0"},
+		},
+		{
+			constraint: "< 1.2 || 1.4.1 || > v1.8.0, != v1.9.0",
+			match:      []string{"v1.1.9", "v1.4.1", "v1.8.1", "v1.10.0"},
+			noMatch:    []string{"v1.2.0", "v1.4.0", "v1.8.0", "v1.9.0"},
+		},
+		{
+			constraint: ">= v1.5.0,",
+			err:        true,
+		},
+		{
+			constraint: "~> v1.5",
+			err:        true,
+		},
+	}
+
+	for _, tc := range tt {
+		c, err := Parse(tc.constraint)
+		if tc.err {
+			require.Error(t, err, tc.constraint)
+			continue
+		}
+
+		require.NoError(t, err, tc.constraint)
+		require.Equal(t, tc.constraint, c.String())
+
+		for _, version := range tc.match {
+			require.True(t, c.Match(version), "%q should match %s", tc.constraint, version)
+		}
+
+		for _, version := range tc.noMatch {
+			require.False(t, c.Match(version), "%q should not match %s", tc.constraint, version)
+		}
+	}
+}
+
+func TestConstraintJSON(t *testing.T) {
+	t.Parallel()
+
+	var config struct {
+		Include Constraint `json:"include"`
+		Exclude Constraint `json:"exclude"`
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(`{"include": ">= v1.5.0"}`), &config))
+	require.True(t, config.Include.Match("v1.6.0"))
+	require.True(t, config.Exclude.IsEmpty())
+
+	require.Error(t, json.Unmarshal([]byte(`{"include": ">= one"}`), &config))
+}
@@ -0,0 +1,247 @@
+package exporter
+
+import (
+	"astera"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+type Options struct {
+	// Modules is a comma separated list of module path glob patterns in the GOPRIVATE syntax,
+	// empty exports everything
+	Modules string
+}
+
+type Report struct {
+	Dir      string
+	Modules  int
+	Versions int
+	// Partial are the versions stored without their zip, only .info and .mod are written
+	Partial int
+	Bytes   int64
+	Elapsed time.Duration
+}
+
+// Exporter writes the stored modules into a directory in the module cache download layout
+// (GOMODCACHE/cache/download), which is also a GOPROXY=file:// directory. The modules are streamed
+// from the repository one version at a time.
+type Exporter struct {
+	repository astera.ExportRepository
+	options    Options
+}
+
+func New(repository astera.ExportRepository, options Options) *Exporter {
+	return &Exporter{repository: repository, options: options}
+}
+
+func (e *Exporter) Run(dir string) (*Report, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Dir: dir}
+	started := time.Now()
+
+	// the rows come ordered by name, the list of a module is written when the next one starts
+	var current string
+	var versions []string
+
+	writeList := func() error {
+		if current == "" {
+			return nil
+		}
+
+		report.Modules++
+
+		list := strings.Join(versions, "\n")
+		if list != "" {
+			list += "\n"
+		}
+
+		return os.WriteFile(filepath.Join(dir, current, "@v", "list"), []byte(list), 0o644)
+	}
+
+	err = e.repository.WalkModules(prefixes(e.options.Modules), func(m *astera.Module) error {
+		modulePath, version, err := e.check(m)
+		if err != nil {
+			return err
+		}
+
+		if modulePath == "" {
+			// not matching the patterns
+			return nil
+		}
+
+		// the private modules cloned from git are stored unescaped, the layout is always escaped
+		name, _ := module.EscapePath(modulePath)
+		if name != current {
+			err = writeList()
+			if err != nil {
+				return err
+			}
+
+			current = name
+			versions = versions[:0]
+		}
+
+		err = writeVersion(filepath.Join(dir, name, "@v"), version, m)
+		if err != nil {
+			return fmt.Errorf("%s@%s: %w", modulePath, version, err)
+		}
+
+		// the list has only the tagged versions, like the one of a proxy
+		if !module.IsPseudoVersion(version) {
+			versions = append(versions, version)
+		}
+
+		report.Versions++
+		report.Bytes += int64(len(m.Zip))
+		if m.Zip == nil {
+			report.Partial++
+		}
+
+		return nil
+	})
+	if err == nil {
+		err = writeList()
+	}
+
+	report.Elapsed = time.Since(started)
+
+	return report, err
+}
+
+// check validates the name and version of the stored module, they become file paths. It returns
+// an empty path for the modules not matching the patterns.
+func (e *Exporter) check(m *astera.Module) (string, string, error) {
+	modulePath, err := module.UnescapePath(m.Name)
+	if err != nil {
+		// stored unescaped, like the private modules cloned from git
+		modulePath = m.Name
+	}
+
+	version, err := module.UnescapeVersion(m.Version)
+	if err != nil {
+		version = m.Version
+	}
+
+	err = module.Check(modulePath, version)
+	if err != nil {
+		return "", "", fmt.Errorf("stored module %q: %w", m.Name, err)
+	}
+
+	if e.options.Modules != "" && !module.MatchPrefixPatterns(e.options.Modules, modulePath) {
+		return "", "", nil
+	}
+
+	return modulePath, version, nil
+}
+
+// prefixes returns the literal prefixes of the patterns, escaped and as written, to narrow the walk of the
+// repository. None when a pattern starts with a wildcard.
+func prefixes(patterns string) []string {
+	if patterns == "" {
+		return nil
+	}
+
+	var list []string
+	for pattern := range strings.SplitSeq(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		prefix := pattern[:strings.IndexFunc(pattern+"*", isGlobChar)]
+		if prefix == "" {
+			return nil
+		}
+
+		list = append(list, prefix)
+		if escaped := escapePrefix(prefix); escaped != prefix {
+			list = append(list, escaped)
+		}
+	}
+
+	return list
+}
+
+func isGlobChar(r rune) bool {
+	return strings.ContainsRune(`*?[\`, r)
+}
+
+// escapePrefix escapes a part of a module path like module.EscapePath, which only takes whole paths
+func escapePrefix(prefix string) string {
+	var b strings.Builder
+	for _, r := range prefix {
+		if 'A' <= r && r <= 'Z' {
+			b.WriteByte('!')
+			r += 'a' - 'A'
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func writeVersion(dir, version string, m *astera.Module) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	escaped, err := module.EscapeVersion(version)
+	if err != nil {
+		return err
+	}
+
+	base := filepath.Join(dir, escaped)
+
+	info := m.Info
+	if len(info) == 0 {
+		// imported from a cache without .info, the go command needs at least the version
+		info, err = json.Marshal(struct{ Version string }{version})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.WriteFile(base+".info", info, 0o644)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(base+".mod", m.Mod, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if m.Zip == nil {
+		return nil
+	}
+
+	err = os.WriteFile(base+".zip", m.Zip, 0o644)
+	if err != nil {
+		return err
+	}
+
+	// modules fetched from upstream store the VCS hash of the origin, the cache needs the h1: hash
+	zipHash := m.ZipHash
+	if !strings.HasPrefix(zipHash, "h1:") {
+		zipHash, err = dirhash.HashZip(base+".zip", dirhash.Hash1)
+		if err != nil {
+			return errors.Join(fmt.Errorf("invalid zip: %w", err), os.Remove(base+".zip"))
+		}
+	}
+
+	return os.WriteFile(base+".ziphash", []byte(zipHash+"\n"), 0o644)
+}
@@ -0,0 +1,156 @@
+package exporter
+
+import (
+	"archive/zip"
+	"astera"
+	"astera/mock"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+func moduleZip(t *testing.T, name, version string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create(name + "@" + version + "/go.mod")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("module " + name + "\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	return buf.Bytes()
+}
+
+func TestExporter(t *testing.T) {
+	t.Parallel()
+
+	zip1 := moduleZip(t, "github.com/Tmwalaszek/module1", "v1.0.0")
+	zipPath := filepath.Join(t.TempDir(), "module1.zip")
+	require.NoError(t, os.WriteFile(zipPath, zip1, 0o644))
+	hash1, err := dirhash.HashZip(zipPath, dirhash.Hash1)
+	require.NoError(t, err)
+
+	modules := []*astera.Module{
+		{
+			Name:    "github.com/!tmwalaszek/module1",
+			Version: "v1.0.0",
+			Info:    []byte(`{"Version":"v1.0.0"}`),
+			Mod:     []byte("module github.com/Tmwalaszek/module1\n"),
+			Zip:     zip1,
+			// the VCS hash of the origin is replaced with the h1: hash
+			ZipHash: "89cbdd9e7b39eb58896d316a7495597d3aba4371",
+		},
+		{
+			Name:    "github.com/!tmwalaszek/module1",
+			Version: "v1.0.1-0.20250101000000-89cbdd9e7b39",
+			Mod:     []byte("module github.com/Tmwalaszek/module1\n"),
+		},
+		{
+			Name:    "github.com/tmwalaszek/module2",
+			Version: "v0.1.0",
+			Info:    []byte(`{"Version":"v0.1.0"}`),
+			Mod:     []byte("module github.com/tmwalaszek/module2\n"),
+			Zip:     []byte("zip"),
+			ZipHash: "h1:stored=",
+		},
+		{
+			// cloned from git, stored unescaped
+			Name:    "github.com/MyOrg/repo",
+			Version: "v1.0.0",
+			Info:    []byte(`{"Version":"v1.0.0"}`),
+			Mod:     []byte("module github.com/MyOrg/repo\n"),
+		},
+	}
+
+	var walked [][]string
+	repository := &mock.ExportRepository{
+		WalkModulesFn: func(prefixes []string, fn func(*astera.Module) error) error {
+			walked = append(walked, prefixes)
+			for _, m := range modules {
+				err := fn(m)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	}
+
+	var tt = []struct {
+		name     string
+		patterns string
+		files    map[string]string
+		missing  []string
+		versions int
+		// the literal prefixes of the patterns narrowing the walk
+		prefixes []string
+	}{
+		{
+			name: "everything",
+			files: map[string]string{
+				"github.com/!tmwalaszek/module1/@v/list":                                      "v1.0.0\n",
+				"github.com/!tmwalaszek/module1/@v/v1.0.0.info":                               `{"Version":"v1.0.0"}`,
+				"github.com/!tmwalaszek/module1/@v/v1.0.0.mod":                                "module github.com/Tmwalaszek/module1\n",
+				"github.com/!tmwalaszek/module1/@v/v1.0.0.ziphash":                            hash1 + "\n",
+				"github.com/!tmwalaszek/module1/@v/v1.0.1-0.20250101000000-89cbdd9e7b39.info": `{"Version":"v1.0.1-0.20250101000000-89cbdd9e7b39"}`,
+				"github.com/tmwalaszek/module2/@v/list":                                       "v0.1.0\n",
+				"github.com/tmwalaszek/module2/@v/v0.1.0.ziphash":                             "h1:stored=\n",
+				"github.com/tmwalaszek/module2/@v/v0.1.0.zip":                                 "zip",
+				"github.com/!my!org/repo/@v/list":                                             "v1.0.0\n",
+				"github.com/!my!org/repo/@v/v1.0.0.mod":                                       "module github.com/MyOrg/repo\n",
+			},
+			missing:  []string{"github.com/!tmwalaszek/module1/@v/v1.0.1-0.20250101000000-89cbdd9e7b39.zip"},
+			versions: 4,
+		},
+		{
+			name:     "pattern",
+			patterns: "github.com/tmwalaszek/*",
+			files: map[string]string{
+				"github.com/tmwalaszek/module2/@v/list": "v0.1.0\n",
+			},
+			missing:  []string{"github.com/!tmwalaszek", "github.com/!my!org"},
+			versions: 1,
+			prefixes: []string{"github.com/tmwalaszek/"},
+		},
+		{
+			name:     "unescaped pattern",
+			patterns: "github.com/MyOrg",
+			files: map[string]string{
+				"github.com/!my!org/repo/@v/list": "v1.0.0\n",
+			},
+			missing:  []string{"github.com/tmwalaszek"},
+			versions: 1,
+			prefixes: []string{"github.com/MyOrg", "github.com/!my!org"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			walked = nil
+			dir := t.TempDir()
+
+			report, err := New(repository, Options{Modules: tc.patterns}).Run(dir)
+			require.NoError(t, err)
+			require.Equal(t, tc.versions, report.Versions)
+			require.Equal(t, [][]string{tc.prefixes}, walked)
+
+			for name, content := range tc.files {
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				require.NoError(t, err, name)
+				require.Equal(t, content, string(data), name)
+			}
+
+			for _, name := range tc.missing {
+				require.NoFileExists(t, filepath.Join(dir, name))
+				require.NoDirExists(t, filepath.Join(dir, name))
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package gc
+
+import (
+	"astera"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/module"
+)
+
+const (
+	defaultInterval = time.Hour
+
+	// candidates read from the repository at once
+	batchSize = 200
+)
+
+type Config struct {
+	// MaxSize is the database size the collector keeps below, zero means no limit
+	MaxSize int64
+	// MaxAge drops the zips of the versions not accessed for this long, zero means no limit
+	MaxAge time.Duration
+	// Interval is how often the collector runs, an hour when zero
+	Interval time.Duration
+	// Private are GOPRIVATE patterns of modules that are never evicted, upstream can't give them back
+	Private string
+	// DryRun reports what would be evicted without changing anything
+	DryRun bool
+}
+
+// Validate checks the limits, a collector needs at least one of them
+func (c Config) Validate() error {
+	if c.MaxSize < 0 || c.MaxAge < 0 {
+		return errors.New("negative gc limit")
+	}
+
+	if c.MaxSize == 0 && c.MaxAge == 0 {
+		return errors.New("no gc limit, set a maximum size or age")
+	}
+
+	return nil
+}
+
+type Report struct {
+	SizeBefore  int64 `json:"size_before"`
+	SizeAfter   int64 `json:"size_after"`
+	DroppedZips int   `json:"dropped_zips"`
+	Deleted     int   `json:"deleted"`
+	// Freed is the size of the evicted zips and go.mod files
+	Freed   int64         `json:"freed"`
+	DryRun  bool          `json:"dry_run"`
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+// Collector keeps the database within its size and age limits. It evicts the least recently used
+// versions, first only their zips, which leaves partial modules whose zips are fetched again on
+// demand, and whole versions once no zip is left to drop. Published versions, versions cloned from
+// git, pinned versions and private modules are never evicted. Every run ends with an incremental
+// vacuum returning the freed pages to the file system. A nil *Collector does nothing.
+type Collector struct {
+	repository astera.GCRepository
+	config     Config
+
+	// a single run at a time
+	mx sync.Mutex
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New returns nil when there are no limits to enforce
+func New(repository astera.GCRepository, config Config) *Collector {
+	if config.MaxSize <= 0 && config.MaxAge <= 0 {
+		return nil
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = defaultInterval
+	}
+
+	return &Collector{repository: repository, config: config}
+}
+
+// Start runs the collector every interval until Stop, the first run is right away
+func (c *Collector) Start() {
+	if c == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+
+	go func() {
+		defer close(c.done)
+
+		for {
+			report, err := c.Run(ctx)
+			if err != nil {
+				slog.Error("garbage collection failed", "err", err)
+			} else if report.DroppedZips > 0 || report.Deleted > 0 {
+				slog.Info("garbage collection", "size_before", report.SizeBefore, "size_after", report.SizeAfter,
+					"dropped_zips", report.DroppedZips, "deleted", report.Deleted, "freed", report.Freed, "elapsed", report.Elapsed)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(c.config.Interval):
+			}
+		}
+	}()
+}
+
+// Stop waits for the run in progress, which stops after its current eviction
+func (c *Collector) Stop() {
+	if c == nil || c.cancel == nil {
+		return
+	}
+
+	c.cancel()
+	<-c.done
+}
+
+// run is the state of a single run
+type run struct {
+	report *Report
+	// the versions evicted by a dry run, which stay in the repository
+	dryRunZips    map[string]bool
+	dryRunDeleted map[string]bool
+}
+
+// Run evicts the versions over the limits once
+func (c *Collector) Run(ctx context.Context) (*Report, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	started := time.Now()
+	r := &run{
+		report:        &Report{DryRun: c.config.DryRun},
+		dryRunZips:    make(map[string]bool),
+		dryRunDeleted: make(map[string]bool),
+	}
+
+	size, err := c.repository.DatabaseSize()
+	if err != nil {
+		return nil, err
+	}
+
+	r.report.SizeBefore = size
+
+	if c.config.MaxAge > 0 {
+		// stale versions lose their zip whatever the size
+		err = c.evict(ctx, r, true, started.Add(-c.config.MaxAge), func() (bool, error) { return true, nil })
+		if err != nil {
+			return r.report, err
+		}
+	}
+
+	overSize := func() (bool, error) {
+		if c.config.DryRun {
+			return size-r.report.Freed > c.config.MaxSize, nil
+		}
+
+		size, err := c.repository.DatabaseSize()
+		return size > c.config.MaxSize, err
+	}
+
+	if c.config.MaxSize > 0 {
+		for _, withZip := range []bool{true, false} {
+			err = c.evict(ctx, r, withZip, started, overSize)
+			if err != nil {
+				return r.report, err
+			}
+		}
+	}
+
+	if !c.config.DryRun && (r.report.DroppedZips > 0 || r.report.Deleted > 0) {
+		err = c.repository.IncrementalVacuum()
+		if err != nil {
+			return r.report, err
+		}
+	}
+
+	r.report.SizeAfter, err = c.repository.DatabaseSize()
+	if c.config.DryRun {
+		r.report.SizeAfter = max(r.report.SizeBefore-r.report.Freed, 0)
+	}
+
+	r.report.Elapsed = time.Since(started)
+
+	return r.report, err
+}
+
+// evict drops the zips (withZip) or deletes the versions accessed before the time, least recently
+// used first, while more is true
+func (c *Collector) evict(ctx context.Context, r *run, withZip bool, accessedBefore time.Time, more func() (bool, error)) error {
+	// the versions passed over stay candidates, they are skipped by the offset
+	offset := 0
+
+	for ctx.Err() == nil {
+		candidates, err := c.repository.LeastRecentlyUsed(withZip, accessedBefore, batchSize, offset)
+		if err != nil {
+			return err
+		}
+
+		if len(candidates) == 0 {
+			return nil
+		}
+
+		for _, v := range candidates {
+			ok, err := more()
+			if err != nil || !ok || ctx.Err() != nil {
+				return err
+			}
+
+			key := v.Name + "@" + v.Version
+			protected := v.Pin != nil || c.private(v.Name)
+			if protected || c.config.DryRun {
+				offset++
+			}
+
+			if protected || r.dryRunDeleted[key] || (withZip && r.dryRunZips[key]) {
+				continue
+			}
+
+			freed := v.ZipSize
+			if r.dryRunZips[key] {
+				freed = 0
+			}
+
+			if withZip {
+				r.dryRunZips[key] = c.config.DryRun
+				if !c.config.DryRun {
+					err = c.repository.DropZip(v.Name, v.Version)
+				}
+
+				r.report.DroppedZips++
+			} else {
+				r.dryRunDeleted[key] = c.config.DryRun
+				if !c.config.DryRun {
+					err = c.repository.DeleteModule(v.Name, v.Version)
+				}
+
+				r.report.Deleted++
+				freed += v.ModSize
+			}
+
+			if err != nil {
+				return err
+			}
+
+			r.report.Freed += freed
+		}
+	}
+
+	return nil
+}
+
+func (c *Collector) private(name string) bool {
+	if c.config.Private == "" {
+		return false
+	}
+
+	modulePath, err := module.UnescapePath(name)
+	if err != nil {
+		// stored unescaped, like the private modules cloned from git
+		modulePath = name
+	}
+
+	return module.MatchPrefixPatterns(c.config.Private, modulePath)
+}
@@ -0,0 +1,180 @@
+package gc
+
+import (
+	"astera"
+	"astera/mock"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryRepository keeps the versions least recently used first
+func memoryRepository(versions []astera.ModuleVersion) (*mock.GCRepository, *[]astera.ModuleVersion, *int) {
+	vacuums := 0
+
+	find := func(name, version string) int {
+		return slices.IndexFunc(versions, func(v astera.ModuleVersion) bool {
+			return v.Name == name && v.Version == version
+		})
+	}
+
+	repository := &mock.GCRepository{
+		DatabaseSizeFn: func() (int64, error) {
+			var size int64
+			for _, v := range versions {
+				size += v.ModSize + v.ZipSize
+			}
+
+			return size, nil
+		},
+		LeastRecentlyUsedFn: func(withZip bool, accessedBefore time.Time, limit, offset int) ([]astera.ModuleVersion, error) {
+			var candidates []astera.ModuleVersion
+			for _, v := range versions {
+				if (!withZip || v.ZipSize > 0) && v.LastAccessAt.Before(accessedBefore) {
+					candidates = append(candidates, v)
+				}
+			}
+
+			if offset >= len(candidates) {
+				return nil, nil
+			}
+
+			return candidates[offset:min(offset+limit, len(candidates))], nil
+		},
+		DropZipFn: func(name, version string) error {
+			versions[find(name, version)].ZipSize = 0
+			return nil
+		},
+		DeleteModuleFn: func(name, version string) error {
+			versions = slices.Delete(versions, find(name, version), find(name, version)+1)
+			return nil
+		},
+		IncrementalVacuumFn: func() error {
+			vacuums++
+			return nil
+		},
+	}
+
+	return repository, &versions, &vacuums
+}
+
+func TestCollector(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	stored := func() []astera.ModuleVersion {
+		return []astera.ModuleVersion{
+			{Name: "github.com/tmwalaszek/module1", Version: "v1.0.0", ModSize: 10, ZipSize: 100, LastAccessAt: now.Add(-72 * time.Hour)},
+			{Name: "github.com/ourorg/private", Version: "v1.0.0", ModSize: 10, ZipSize: 100, LastAccessAt: now.Add(-48 * time.Hour)},
+			{Name: "github.com/tmwalaszek/module2", Version: "v1.0.0", ModSize: 10, ZipSize: 100, LastAccessAt: now.Add(-24 * time.Hour)},
+			{Name: "github.com/tmwalaszek/pinned", Version: "v1.0.0", ModSize: 10, ZipSize: 100, LastAccessAt: now.Add(-12 * time.Hour), Pin: &astera.Pin{}},
+			{Name: "github.com/tmwalaszek/module3", Version: "v1.0.0", ModSize: 10, ZipSize: 100, LastAccessAt: now.Add(-time.Minute)},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		config    Config
+		dropped   int
+		deleted   int
+		freed     int64
+		sizeAfter int64
+		remaining []string
+		withZips  []string
+		vacuumed  bool
+	}{
+		{
+			name:      "max age drops stale zips",
+			config:    Config{MaxAge: 36 * time.Hour, Private: "github.com/ourorg"},
+			dropped:   1,
+			freed:     100,
+			sizeAfter: 450,
+			remaining: []string{"github.com/tmwalaszek/module1", "github.com/ourorg/private", "github.com/tmwalaszek/module2", "github.com/tmwalaszek/pinned", "github.com/tmwalaszek/module3"},
+			withZips:  []string{"github.com/ourorg/private", "github.com/tmwalaszek/module2", "github.com/tmwalaszek/pinned", "github.com/tmwalaszek/module3"},
+			vacuumed:  true,
+		},
+		{
+			name:      "max size drops zips first",
+			config:    Config{MaxSize: 350},
+			dropped:   2,
+			freed:     200,
+			sizeAfter: 350,
+			remaining: []string{"github.com/tmwalaszek/module1", "github.com/ourorg/private", "github.com/tmwalaszek/module2", "github.com/tmwalaszek/pinned", "github.com/tmwalaszek/module3"},
+			withZips:  []string{"github.com/tmwalaszek/module2", "github.com/tmwalaszek/pinned", "github.com/tmwalaszek/module3"},
+			vacuumed:  true,
+		},
+		{
+			name:      "max size deletes versions when no zip is left",
+			config:    Config{MaxSize: 240, Private: "github.com/ourorg"},
+			dropped:   3,
+			deleted:   1,
+			freed:     310,
+			sizeAfter: 240,
+			remaining: []string{"github.com/ourorg/private", "github.com/tmwalaszek/module2", "github.com/tmwalaszek/pinned", "github.com/tmwalaszek/module3"},
+			withZips:  []string{"github.com/ourorg/private", "github.com/tmwalaszek/pinned"},
+			vacuumed:  true,
+		},
+		{
+			name:      "dry run changes nothing",
+			config:    Config{MaxSize: 240, Private: "github.com/ourorg", DryRun: true},
+			dropped:   3,
+			deleted:   1,
+			freed:     310,
+			sizeAfter: 240,
+			remaining: []string{"github.com/tmwalaszek/module1", "github.com/ourorg/private", "github.com/tmwalaszek/module2", "github.com/tmwalaszek/pinned", "github.com/tmwalaszek/module3"},
+			withZips:  []string{"github.com/tmwalaszek/module1", "github.com/ourorg/private", "github.com/tmwalaszek/module2", "github.com/tmwalaszek/pinned", "github.com/tmwalaszek/module3"},
+		},
+		{
+			name:      "within the limits",
+			config:    Config{MaxSize: 1000, MaxAge: 100 * time.Hour},
+			sizeAfter: 550,
+			remaining: []string{"github.com/tmwalaszek/module1", "github.com/ourorg/private", "github.com/tmwalaszek/module2", "github.com/tmwalaszek/pinned", "github.com/tmwalaszek/module3"},
+			withZips:  []string{"github.com/tmwalaszek/module1", "github.com/ourorg/private", "github.com/tmwalaszek/module2", "github.com/tmwalaszek/pinned", "github.com/tmwalaszek/module3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			repository, versions, vacuums := memoryRepository(stored())
+
+			report, err := New(repository, tt.config).Run(context.Background())
+			require.NoError(t, err)
+
+			require.Equal(t, int64(550), report.SizeBefore)
+			require.Equal(t, tt.sizeAfter, report.SizeAfter)
+			require.Equal(t, tt.dropped, report.DroppedZips)
+			require.Equal(t, tt.deleted, report.Deleted)
+			require.Equal(t, tt.freed, report.Freed)
+			require.Equal(t, tt.vacuumed, *vacuums > 0)
+
+			var remaining, withZips []string
+			for _, v := range *versions {
+				remaining = append(remaining, v.Name)
+				if v.ZipSize > 0 {
+					withZips = append(withZips, v.Name)
+				}
+			}
+
+			require.Equal(t, tt.remaining, remaining)
+			require.Equal(t, tt.withZips, withZips)
+		})
+	}
+
+	require.Nil(t, New(nil, Config{}))
+	New(nil, Config{}).Start()
+	New(nil, Config{}).Stop()
+}
+
+func TestConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, Config{MaxSize: 1 << 30}.Validate())
+	require.NoError(t, Config{MaxAge: time.Hour}.Validate())
+	require.ErrorContains(t, Config{}.Validate(), "no gc limit")
+	require.ErrorContains(t, Config{MaxSize: -1, MaxAge: time.Hour}.Validate(), "negative")
+}
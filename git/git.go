@@ -2,9 +2,12 @@ package git
 
 import (
 	"astera"
+	"astera/limiter"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
 	"path"
@@ -18,6 +21,8 @@ import (
 
 type Git struct {
 	GtiBinary string
+	// Limiter bounds the git processes running at once in total and per host, nil means no limit
+	Limiter *limiter.HostLimiter
 
 	tempDir string
 }
@@ -26,10 +31,18 @@ func New() *Git {
 	return &Git{GtiBinary: "git"}
 }
 
-func (g *Git) FetchTags(repo string) ([]string, error) {
+func (g *Git) FetchTags(ctx context.Context, repo string) ([]string, error) {
 	repoURL := g.AddPrefixToRepo(repo)
 
-	cmd := exec.Command(
+	release, err := g.acquire(ctx, repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	cmd := exec.CommandContext(
+		ctx,
 		g.GtiBinary,
 		"ls-remote",
 		"--tags",
@@ -64,9 +77,16 @@ func (g *Git) FetchTags(repo string) ([]string, error) {
 	return tags, nil
 }
 
-func (g *Git) Clone(repo, tag string) (*astera.Module, error) {
+func (g *Git) Clone(ctx context.Context, repo, tag string) (*astera.Module, error) {
 	repoURL := g.AddPrefixToRepo(repo)
 
+	release, err := g.acquire(ctx, repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
 	tempDir, err := os.MkdirTemp(g.tempDir, "module-")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp dir: %w", err)
@@ -74,7 +94,8 @@ func (g *Git) Clone(repo, tag string) (*astera.Module, error) {
 
 	defer os.RemoveAll(tempDir)
 
-	cmd := exec.Command(
+	cmd := exec.CommandContext(
+		ctx,
 		g.GtiBinary,
 		"clone",
 		"--depth", "1",
@@ -88,7 +109,8 @@ func (g *Git) Clone(repo, tag string) (*astera.Module, error) {
 		return nil, fmt.Errorf("failed to clone repo: %w\n%s", cmdErr, out)
 	}
 
-	cmd = exec.Command(
+	cmd = exec.CommandContext(
+		ctx,
 		g.GtiBinary,
 		"-C",
 		tempDir,
@@ -106,7 +128,8 @@ func (g *Git) Clone(repo, tag string) (*astera.Module, error) {
 
 	timeOutput = bytes.TrimSuffix(timeOutput, []byte("\n"))
 
-	cmd = exec.Command(
+	cmd = exec.CommandContext(
+		ctx,
 		g.GtiBinary,
 		"-C",
 		tempDir,
@@ -158,6 +181,7 @@ func (g *Git) Clone(repo, tag string) (*astera.Module, error) {
 
 	return &astera.Module{
 		Name:    repo,
+		Source:  astera.ModuleSourceGit,
 		Version: tag,
 		Info:    infoBody,
 		Zip:     zipped,
@@ -166,6 +190,16 @@ func (g *Git) Clone(repo, tag string) (*astera.Module, error) {
 	}, nil
 }
 
+// acquire waits for the limiter slot of the repository host
+func (g *Git) acquire(ctx context.Context, repoURL string) (func(), error) {
+	host := repoURL
+	if u, err := url.Parse(repoURL); err == nil {
+		host = u.Host
+	}
+
+	return g.Limiter.Acquire(ctx, host)
+}
+
 func stripModuleMajorSuffix(p string) string {
 	p = strings.TrimSpace(p)
 	if p == "" {
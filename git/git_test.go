@@ -1,6 +1,7 @@
 package git
 
 import (
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -35,7 +36,7 @@ func TestGitClone(t *testing.T) {
 	// todo(tmw) - make this errors more specific
 	for _, tc := range tt {
 		t.Run(fmt.Sprintf("repo %s tag %s", tc.repo, tc.tag), func(t *testing.T) {
-			m, err := g.Clone(tc.repo, tc.tag)
+			m, err := g.Clone(context.Background(), tc.repo, tc.tag)
 			if tc.err != nil {
 				require.Error(t, err)
 				return
@@ -72,7 +73,7 @@ func TestGitFetchTags(t *testing.T) {
 
 	for _, tc := range tt {
 		t.Run(tc.repo, func(t *testing.T) {
-			tags, err := g.FetchTags(tc.repo)
+			tags, err := g.FetchTags(context.Background(), tc.repo)
 			if tc.err != nil {
 				require.EqualError(t, err, tc.err.Error())
 				return
@@ -4,6 +4,8 @@ go 1.25.1
 
 require (
 	github.com/golang-migrate/migrate/v4 v4.19.1
+	github.com/klauspost/compress v1.18.0
+	github.com/mattn/go-sqlite3 v1.14.32
 	github.com/stretchr/testify v1.11.0
 	github.com/tmwalaszek/weakcache v1.2.0
 	golang.org/x/mod v0.31.0
@@ -11,7 +13,6 @@ require (
 
 require (
 	github.com/davecgh/go-spew v1.1.2-0.20180830191138-d8f796af33cc // indirect
-	github.com/mattn/go-sqlite3 v1.14.32 // indirect
 	github.com/pmezard/go-difflib v1.0.1-0.20181226105442-5d4384ee4fb2 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
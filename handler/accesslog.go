@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"astera"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+type accessLogEntry struct {
+	Time       time.Time          `json:"time"`
+	RequestID  string             `json:"request_id"`
+	Method     string             `json:"method"`
+	Path       string             `json:"path"`
+	Status     int                `json:"status"`
+	Bytes      int64              `json:"bytes"`
+	Cache      astera.CacheStatus `json:"cache,omitempty"`
+	Source     string             `json:"source,omitempty"`
+	Upstream   string             `json:"upstream,omitempty"`
+	RemoteAddr string             `json:"remote_addr"`
+	Client     string             `json:"client"`
+	UserAgent  string             `json:"user_agent,omitempty"`
+	ElapsedMs  float64            `json:"elapsed_ms"`
+}
+
+func writeAccessLog(w io.Writer, entry *accessLogEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		slog.Error("failed to marshal access log entry", "err", err)
+		return
+	}
+
+	// one Write per entry so lines from concurrent requests never interleave
+	_, err = w.Write(append(line, '\n'))
+	if err != nil {
+		slog.Error("failed to write access log", "err", err)
+	}
+}
+
+// RotatingFile is an append only file rotated when it grows over maxSize bytes.
+// Rotated files are named path.1 (the newest) up to path.maxBackups.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mx   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	r.file = f
+	r.size = info.Size()
+
+	return nil
+}
+
+// rotate renames the open file before closing it, the writes go on to the current file when it fails
+func (r *RotatingFile) rotate() error {
+	var err error
+	if r.maxBackups > 0 {
+		for i := r.maxBackups - 1; i > 0; i-- {
+			err = os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		err = os.Rename(r.path, r.path+".1")
+	} else {
+		err = os.Remove(r.path)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// the rotated file stays in use until the new one is open
+	rotated := r.file
+
+	err = r.open()
+	if err != nil {
+		return err
+	}
+
+	err = rotated.Close()
+	if err != nil {
+		slog.Error("failed to close the rotated access log", "path", r.path, "err", err)
+	}
+
+	return nil
+}
+
+func (r *RotatingFile) Write(b []byte) (int, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(b)) > r.maxSize {
+		err := r.rotate()
+		if err != nil {
+			// retried on the next write
+			slog.Error("failed to rotate the access log", "path", r.path, "err", err)
+		}
+	}
+
+	n, err := r.file.Write(b)
+	r.size += int64(n)
+
+	return n, err
+}
+
+func (r *RotatingFile) Close() error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	return r.file.Close()
+}
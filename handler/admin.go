@@ -0,0 +1,486 @@
+package handler
+
+import (
+	"astera"
+	"astera/gc"
+	"astera/mirror"
+	"astera/policy"
+	"astera/publish"
+	"astera/schedule"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	xmod "golang.org/x/mod/module"
+	xzip "golang.org/x/mod/zip"
+)
+
+// Admin serves the /admin/ API, every request has to carry the admin token
+type Admin struct {
+	repository astera.ModuleRepository
+	service    astera.GoProxyService
+	token      string
+
+	mux *http.ServeMux
+}
+
+func NewAdmin(repository astera.ModuleRepository, service astera.GoProxyService, token string) *Admin {
+	a := &Admin{
+		repository: repository,
+		service:    service,
+		token:      token,
+		mux:        http.NewServeMux(),
+	}
+
+	a.mux.HandleFunc("PUT /admin/publish/{path...}", a.publish)
+	a.mux.HandleFunc("POST /admin/publish/{path...}", a.publish)
+	a.mux.HandleFunc("DELETE /admin/negative-cache", a.purgeNegativeCache)
+	a.mux.HandleFunc("GET /admin/jobs", a.listJobs)
+	a.mux.HandleFunc("DELETE /admin/jobs/{id}", a.cancelJob)
+
+	return a
+}
+
+// ServeSchedule adds GET /admin/schedule reporting the fetch windows and their byte usage
+func (a *Admin) ServeSchedule(s *schedule.Schedule) {
+	a.mux.HandleFunc("GET /admin/schedule", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Report())
+	})
+}
+
+// ServeMirror adds GET /admin/mirror reporting the last sync of the mirrored modules
+func (a *Admin) ServeMirror(m *mirror.Mirror) {
+	a.mux.HandleFunc("GET /admin/mirror", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, m.Report())
+	})
+}
+
+// maxJSONBodySize caps the JSON body of the admin requests
+const maxJSONBodySize = 64 << 10
+
+// ServePins adds GET, POST and DELETE /admin/pins managing the versions protected from eviction and deletion
+func (a *Admin) ServePins(pins astera.PinRepository) {
+	a.mux.HandleFunc("GET /admin/pins", func(w http.ResponseWriter, r *http.Request) {
+		list, err := pins.ListPins()
+		if err != nil {
+			writeAdminError(w, r, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, list)
+	})
+
+	a.mux.HandleFunc("POST /admin/pins", func(w http.ResponseWriter, r *http.Request) {
+		pin := &astera.Pin{}
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodySize)).Decode(pin)
+		if err == nil {
+			err = pin.Check()
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = pins.AddPin(pin)
+		if err != nil {
+			writeAdminError(w, r, err)
+			return
+		}
+
+		slog.Info("pin added", "module", pin.Module, "version", pin.Version, "owner", pin.Owner, "reason", pin.Reason)
+		writeJSON(w, http.StatusCreated, pin)
+	})
+
+	// ?module= is the pinned path or pattern, ?version= is empty for a module pin
+	a.mux.HandleFunc("DELETE /admin/pins", func(w http.ResponseWriter, r *http.Request) {
+		module, version := r.URL.Query().Get("module"), r.URL.Query().Get("version")
+
+		removed, err := pins.RemovePin(module, version)
+		if err != nil {
+			writeAdminError(w, r, err)
+			return
+		}
+
+		if !removed {
+			http.Error(w, "pin not found", http.StatusNotFound)
+			return
+		}
+
+		slog.Info("pin removed", "module", module, "version", version)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type quarantineRequest struct {
+	Reason string `json:"reason"`
+	By     string `json:"by"`
+}
+
+// ServeQuarantine adds /admin/quarantine: GET lists the quarantined versions, PUT and DELETE on
+// <module>/@v/<version> quarantine and release a version and GET audit returns the audit trail
+func (a *Admin) ServeQuarantine(quarantines astera.QuarantineRepository) {
+	a.mux.HandleFunc("GET /admin/quarantine", func(w http.ResponseWriter, r *http.Request) {
+		list, err := quarantines.ListQuarantines()
+		if err != nil {
+			writeAdminError(w, r, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, list)
+	})
+
+	a.mux.HandleFunc("GET /admin/quarantine/audit", func(w http.ResponseWriter, r *http.Request) {
+		var name string
+		if module := r.URL.Query().Get("module"); module != "" {
+			var err error
+			name, err = xmod.EscapePath(module)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		limit := defaultJobsLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "invalid limit "+v, http.StatusBadRequest)
+				return
+			}
+
+			limit = n
+		}
+
+		events, err := quarantines.QuarantineAudit(name, limit)
+		if err != nil {
+			writeAdminError(w, r, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, events)
+	})
+
+	a.mux.HandleFunc("PUT /admin/quarantine/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		name, version, err := escapedModuleVersion(r.PathValue("path"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		req := &quarantineRequest{}
+		err = json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodySize)).Decode(req)
+		if err == nil && (req.Reason == "" || req.By == "") {
+			err = errors.New("a quarantine needs a reason and who asks for it")
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		q := &astera.Quarantine{Name: name, Version: version, Reason: req.Reason, By: req.By}
+		err = quarantines.Quarantine(q)
+		if err != nil {
+			writeAdminError(w, r, err)
+			return
+		}
+
+		slog.Warn("version quarantined", "module", name, "version", version, "by", req.By, "reason", req.Reason)
+		writeJSON(w, http.StatusOK, q)
+	})
+
+	// ?by= and ?reason= are recorded in the audit trail
+	a.mux.HandleFunc("DELETE /admin/quarantine/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		name, version, err := escapedModuleVersion(r.PathValue("path"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		by, reason := r.URL.Query().Get("by"), r.URL.Query().Get("reason")
+		if by == "" {
+			http.Error(w, "missing by", http.StatusBadRequest)
+			return
+		}
+
+		released, err := quarantines.Release(name, version, by, reason)
+		if err != nil {
+			writeAdminError(w, r, err)
+			return
+		}
+
+		if !released {
+			http.Error(w, "version is not quarantined", http.StatusNotFound)
+			return
+		}
+
+		slog.Info("version released from quarantine", "module", name, "version", version, "by", by, "reason", reason)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// ServePolicy adds GET /admin/policy reporting the policy in use and POST /admin/policy/reload
+// reloading the policy file
+func (a *Admin) ServePolicy(e *policy.Engine) {
+	a.mux.HandleFunc("GET /admin/policy", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, e.Report())
+	})
+
+	a.mux.HandleFunc("POST /admin/policy/reload", func(w http.ResponseWriter, r *http.Request) {
+		err := e.Reload()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		slog.Info("policy reloaded", "rules", len(e.Report().Policy.Rules))
+		writeJSON(w, http.StatusOK, e.Report())
+	})
+}
+
+// ServeGC adds POST /admin/gc running the garbage collector right away and reporting what it evicted
+func (a *Admin) ServeGC(c *gc.Collector) {
+	a.mux.HandleFunc("POST /admin/gc", func(w http.ResponseWriter, r *http.Request) {
+		report, err := c.Run(r.Context())
+		if err != nil {
+			writeAdminError(w, r, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, report)
+	})
+}
+
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, a.token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	a.mux.ServeHTTP(w, r)
+}
+
+// RequireToken serves only the requests carrying the bearer token, nothing when it is empty
+func RequireToken(next http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func authorized(r *http.Request, token string) bool {
+	got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+type publishResponse struct {
+	Module  string `json:"module"`
+	Version string `json:"version"`
+	ZipHash string `json:"zip_hash"`
+}
+
+// publish accepts the module zip as the PUT body or as the "zip" field of a multipart form
+func (a *Admin) publish(w http.ResponseWriter, r *http.Request) {
+	modulePath, version, err := parseModuleVersion(r.PathValue("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, xzip.MaxZipFile+1<<20)
+
+	var body io.Reader = r.Body
+	if r.Method == http.MethodPost {
+		file, _, err := r.FormFile("zip")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		defer file.Close()
+		body = file
+	}
+
+	m, err := publish.FromZip(modulePath, version, body)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+
+	err = publish.Publish(a.repository, m)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+
+	slog.Info("module published", "module", modulePath, "version", version, "zip_hash", m.ZipHash)
+	writeJSON(w, http.StatusCreated, &publishResponse{Module: modulePath, Version: version, ZipHash: m.ZipHash})
+}
+
+type purgeResponse struct {
+	Purged int64 `json:"purged"`
+}
+
+// purgeNegativeCache drops the not found entries of the escaped ?module= or all of them
+func (a *Admin) purgeNegativeCache(w http.ResponseWriter, r *http.Request) {
+	module := r.URL.Query().Get("module")
+	if module != "" {
+		if _, err := xmod.UnescapePath(module); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	purged, err := a.service.PurgeNegativeCache(module)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+
+	slog.Info("negative cache purged", "module", module, "purged", purged)
+	writeJSON(w, http.StatusOK, &purgeResponse{Purged: purged})
+}
+
+const defaultJobsLimit = 100
+
+type jobResponse struct {
+	ID          int64     `json:"id"`
+	Module      string    `json:"module"`
+	Version     string    `json:"version"`
+	Kind        string    `json:"kind"`
+	State       string    `json:"state"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	NextAttempt time.Time `json:"next_attempt"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// listJobs returns the queued jobs, ?state= filters them and ?limit= caps the number
+func (a *Admin) listJobs(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	switch state {
+	case "", astera.JobStatePending, astera.JobStateRunning, astera.JobStateFailed:
+	default:
+		http.Error(w, "invalid state "+state, http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultJobsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			http.Error(w, "invalid limit "+v, http.StatusBadRequest)
+			return
+		}
+	}
+
+	jobs, err := a.service.ListJobs(state, limit)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+
+	resp := make([]jobResponse, 0, len(jobs))
+	for _, job := range jobs {
+		resp = append(resp, jobResponse{
+			ID:          job.ID,
+			Module:      job.Name,
+			Version:     job.Version,
+			Kind:        job.Kind,
+			State:       job.State,
+			Attempts:    job.Attempts,
+			LastError:   job.LastError,
+			NextAttempt: job.NextAttempt,
+			CreatedAt:   job.CreatedAt,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// cancelJob removes the job, a running one is stopped
+func (a *Admin) cancelJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+
+	err = a.service.CancelJob(id)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+
+	slog.Info("job cancelled", "job", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// escapedModuleVersion validates the escaped <module>/@v/<version> path and returns it escaped
+func escapedModuleVersion(p string) (string, string, error) {
+	modulePath, version, err := parseModuleVersion(p)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = xmod.Check(modulePath, version)
+	if err != nil {
+		return "", "", err
+	}
+
+	name, _ := xmod.EscapePath(modulePath)
+	version, _ = xmod.EscapeVersion(version)
+
+	return name, version, nil
+}
+
+// parseModuleVersion splits the escaped <module>/@v/<version> path
+func parseModuleVersion(p string) (string, string, error) {
+	escapedPath, escapedVersion, ok := strings.Cut(p, "/@v/")
+	if !ok {
+		return "", "", astera.ErrInvalidResource
+	}
+
+	modulePath, err := xmod.UnescapePath(escapedPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	version, err := xmod.UnescapeVersion(escapedVersion)
+	if err != nil {
+		return "", "", err
+	}
+
+	return modulePath, version, nil
+}
+
+func writeAdminError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, astera.ErrInvalidResource):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, astera.ErrModuleAlreadyExists), errors.Is(err, astera.ErrPinned):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, astera.ErrModuleNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.As(err, &maxBytesErr):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	default:
+		slog.Error("admin request failed", "path", r.URL.Path,
+			"request_id", astera.RequestInfoFromContext(r.Context()).RequestID(), "err", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"astera"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	xmod "golang.org/x/mod/module"
+)
+
+const (
+	defaultCatalogPageSize = 1000
+	maxCatalogPageSize     = 10000
+)
+
+// Catalog serves GET /catalog, the Athens API listing the stored module versions page by page. It is
+// not authenticated, the private modules (GOPRIVATE or cloned from git) and the published ones are left out.
+type Catalog struct {
+	repository astera.CatalogRepository
+	goPrivate  string
+}
+
+func NewCatalog(repository astera.CatalogRepository, goPrivate string) *Catalog {
+	return &Catalog{repository: repository, goPrivate: goPrivate}
+}
+
+type catalogResponse struct {
+	Modules []astera.CatalogEntry `json:"modules"`
+	Next    string                `json:"next,omitempty"`
+}
+
+func (c *Catalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pageSize := defaultCatalogPageSize
+	if v := r.URL.Query().Get("pagesize"); v != "" {
+		var err error
+		pageSize, err = strconv.Atoi(v)
+		if err != nil || pageSize < 1 {
+			http.Error(w, "invalid pagesize "+v, http.StatusBadRequest)
+			return
+		}
+
+		pageSize = min(pageSize, maxCatalogPageSize)
+	}
+
+	// the token is the escaped name@version of the last entry of the previous page
+	afterName, afterVersion, _ := strings.Cut(r.URL.Query().Get("token"), "@")
+
+	versions, err := c.repository.Catalog(afterName, afterVersion, pageSize)
+	if err != nil {
+		slog.Error("failed to read the catalog", "err", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := catalogResponse{Modules: make([]astera.CatalogEntry, 0, len(versions))}
+	for _, v := range versions {
+		modulePath, err := xmod.UnescapePath(v.Name)
+		if err != nil {
+			continue
+		}
+
+		version, err := xmod.UnescapeVersion(v.Version)
+		if err != nil {
+			continue
+		}
+
+		if v.Source == astera.ModuleSourceGit || v.Source == astera.ModuleSourcePublished ||
+			xmod.MatchPrefixPatterns(c.goPrivate, modulePath) {
+			continue
+		}
+
+		resp.Modules = append(resp.Modules, astera.CatalogEntry{Module: modulePath, Version: version})
+	}
+
+	// a page may come out short, the next one starts after the last version read
+	if len(versions) == pageSize {
+		last := versions[len(versions)-1]
+		resp.Next = last.Name + "@" + last.Version
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -2,14 +2,26 @@ package handler
 
 import (
 	"astera"
+	"astera/limiter"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"io"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
 	sumDbPath = "/sumdb/sum.golang.org/supported"
+
+	requestIDHeader = "X-Request-Id"
+	cacheHeader     = "X-Astera-Cache"
 )
 
 type Handler struct {
@@ -19,10 +31,11 @@ type Handler struct {
 type loggingResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int64
 }
 
 func newLoggingResponseWriter(w http.ResponseWriter) *loggingResponseWriter {
-	return &loggingResponseWriter{w, 0}
+	return &loggingResponseWriter{w, 0, 0}
 }
 
 func (l *loggingResponseWriter) WriteHeader(code int) {
@@ -30,20 +43,130 @@ func (l *loggingResponseWriter) WriteHeader(code int) {
 	l.ResponseWriter.WriteHeader(code)
 }
 
-func LoggerMiddlerware(next http.Handler) http.Handler {
+func (l *loggingResponseWriter) Write(b []byte) (int, error) {
+	if l.statusCode == 0 {
+		l.statusCode = http.StatusOK
+	}
+
+	n, err := l.ResponseWriter.Write(b)
+	l.bytes += int64(n)
+
+	return n, err
+}
+
+// LoggerMiddlerware tags every request with an ID and logs it once served. When accessLog
+// is not nil each request is also written to it as a JSON line.
+func LoggerMiddlerware(next http.Handler, accessLog io.Writer) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		before := time.Now()
+
+		reqInfo := &astera.RequestInfo{ID: requestID(r), Client: clientID(r)}
+		w.Header().Set(requestIDHeader, reqInfo.ID)
+		r = r.WithContext(astera.WithRequestInfo(r.Context(), reqInfo))
+
 		lw := newLoggingResponseWriter(w)
 		next.ServeHTTP(lw, r)
 		elapsed := time.Since(before)
+
+		cache, source, upstream := reqInfo.Source()
 		slog.Info("Received HTTP Request", "Method", r.Method,
 			"Path", r.URL.Path,
 			"Status", lw.statusCode,
 			"RemoteAddr", r.RemoteAddr,
 			"RequestURI", r.RequestURI,
+			"RequestID", reqInfo.ID,
+			"Client", reqInfo.Client,
+			"Bytes", lw.bytes,
+			"Cache", cache,
+			"Source", source,
+			"Upstream", upstream,
 			"Elapsed", elapsed)
+
+		if accessLog == nil {
+			return
+		}
+
+		writeAccessLog(accessLog, &accessLogEntry{
+			Time:       before.UTC(),
+			RequestID:  reqInfo.ID,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Status:     lw.statusCode,
+			Bytes:      lw.bytes,
+			Cache:      cache,
+			Source:     source,
+			Upstream:   upstream,
+			RemoteAddr: r.RemoteAddr,
+			Client:     reqInfo.Client,
+			UserAgent:  r.UserAgent(),
+			ElapsedMs:  float64(elapsed.Microseconds()) / 1000,
+		})
+	})
+
+}
+
+// requestID reuses the ID set by a reverse proxy in front of astera or generates a new one
+func requestID(r *http.Request) string {
+	id := r.Header.Get(requestIDHeader)
+	if id != "" && len(id) <= 128 && !strings.ContainsFunc(id, func(c rune) bool { return c < 0x21 || c > 0x7e }) {
+		return id
+	}
+
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// clientID identifies the client by its IP, ClientTokenMiddleware identifies the clients with a known token
+func clientID(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// ClientTokenMiddleware identifies the clients sending one of the tokens as their bearer token by
+// the token instead of their IP, so the clients sharing an IP get their own limits. Any other token
+// is ignored, a client can't get around its limits by sending a new token on every request. It must
+// be wrapped by LoggerMiddlerware. The token is hashed so it never ends up in the logs.
+func ClientTokenMiddleware(next http.Handler, tokens []string) http.Handler {
+	known := make(map[[sha256.Size]byte]bool, len(tokens))
+	for _, token := range tokens {
+		known[sha256.Sum256([]byte(token))] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+			sum := sha256.Sum256([]byte(token))
+			if reqInfo := astera.RequestInfoFromContext(r.Context()); reqInfo != nil && known[sum] {
+				reqInfo.Client = "token:" + hex.EncodeToString(sum[:8])
+			}
+		}
+
+		next.ServeHTTP(w, r)
 	})
+}
+
+// RateLimitMiddleware limits the number of requests per client, the clients over the limit get
+// 429 with Retry-After. It must be wrapped by LoggerMiddlerware which identifies the client.
+func RateLimitMiddleware(next http.Handler, l *limiter.KeyedLimiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := astera.RequestInfoFromContext(r.Context()).ClientID()
+		if ok, retryAfter := l.Allow(client); !ok {
+			tooManyRequests(w, retryAfter)
+			return
+		}
 
+		next.ServeHTTP(w, r)
+	})
+}
+
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, astera.ErrRateLimited.Error(), http.StatusTooManyRequests)
 }
 
 func NewHandler(cache astera.GoProxyService) *Handler {
@@ -57,14 +180,51 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	reqInfo := astera.RequestInfoFromContext(r.Context())
+
 	resp, err := h.cache.Query(r.Context(), r.URL.Path)
+	if cache, _, _ := reqInfo.Source(); cache != "" {
+		w.Header().Set(cacheHeader, string(cache))
+	}
+
 	if err != nil {
+		// the go command shows the body of a failed response, it explains the quarantine or names the policy rule
+		var quarantinedErr *astera.QuarantinedError
+		if errors.As(err, &quarantinedErr) {
+			http.Error(w, quarantinedErr.Error(), http.StatusGone)
+			return
+		}
+
+		var deniedErr *astera.PolicyDeniedError
+		if errors.As(err, &deniedErr) {
+			http.Error(w, deniedErr.Error(), http.StatusForbidden)
+			return
+		}
+
+		if errors.Is(err, astera.ErrModuleGone) {
+			http.Error(w, astera.ErrModuleGone.Error(), http.StatusGone)
+			return
+		}
+
 		if errors.Is(err, astera.ErrModuleNotFound) {
 			http.Error(w, astera.ErrModuleNotFound.Error(), http.StatusNotFound)
 			return
 		}
 
-		slog.Error("query failed", "path", r.URL.Path, "err", err)
+		var rateLimitErr *astera.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			tooManyRequests(w, rateLimitErr.RetryAfter)
+			return
+		}
+
+		var unavailableErr *astera.UpstreamUnavailableError
+		if errors.As(err, &unavailableErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(unavailableErr.RetryAfter.Seconds()))))
+			http.Error(w, unavailableErr.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		slog.Error("query failed", "path", r.URL.Path, "request_id", reqInfo.RequestID(), "err", err)
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -72,6 +232,6 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(resp)
 	if err != nil {
-		slog.Error("failed to write response body", "path", r.URL.Path, "err", err)
+		slog.Error("failed to write response body", "path", r.URL.Path, "request_id", reqInfo.RequestID(), "err", err)
 	}
 }
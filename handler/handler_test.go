@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"astera"
+	"astera/mock"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggerMiddlerware(t *testing.T) {
+	t.Parallel()
+
+	cache := &mock.GoProxyCache{
+		QueryFn: func(ctx context.Context, query string) ([]byte, error) {
+			astera.RequestInfoFromContext(ctx).SetSource(astera.CacheMiss, astera.SourceUpstream, "https://proxy.golang.org")
+			return []byte("module github.com/tmwalaszek/module1\n"), nil
+		},
+	}
+
+	var tt = []struct {
+		name      string
+		requestID string
+	}{
+		{
+			name: "generated request id",
+		},
+		{
+			name:      "forwarded request id",
+			requestID: "abc-123",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			accessLog := &bytes.Buffer{}
+			h := LoggerMiddlerware(NewHandler(cache), accessLog)
+
+			req := httptest.NewRequest(http.MethodGet, "/github.com/tmwalaszek/module1/@v/v1.0.0.mod", nil)
+			if tc.requestID != "" {
+				req.Header.Set(requestIDHeader, tc.requestID)
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+			require.Equal(t, "miss", rec.Header().Get(cacheHeader))
+
+			id := rec.Header().Get(requestIDHeader)
+			require.NotEmpty(t, id)
+			if tc.requestID != "" {
+				require.Equal(t, tc.requestID, id)
+			}
+
+			var entry accessLogEntry
+			require.NoError(t, json.Unmarshal(accessLog.Bytes(), &entry))
+			require.Equal(t, id, entry.RequestID)
+			require.Equal(t, int64(rec.Body.Len()), entry.Bytes)
+			require.Equal(t, astera.CacheMiss, entry.Cache)
+			require.Equal(t, "https://proxy.golang.org", entry.Upstream)
+		})
+	}
+}
+
+func TestClientTokenMiddleware(t *testing.T) {
+	t.Parallel()
+
+	var client string
+	h := LoggerMiddlerware(ClientTokenMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client = astera.RequestInfoFromContext(r.Context()).ClientID()
+	}), []string{"ci-secret"}), nil)
+
+	var tt = []struct {
+		name   string
+		token  string
+		client string
+	}{
+		{name: "no token", client: "192.0.2.1"},
+		{name: "unknown token", token: "made-up", client: "192.0.2.1"},
+		{name: "known token", token: "ci-secret", client: "token:"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/github.com/tmwalaszek/module1/@v/list", nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			require.True(t, strings.HasPrefix(client, tc.client), client)
+			require.NotContains(t, client, "ci-secret")
+		})
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	t.Parallel()
+
+	logPath := filepath.Join(t.TempDir(), "access.log")
+	f, err := NewRotatingFile(logPath, 10, 2)
+	require.NoError(t, err)
+
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n", "line-4\n"} {
+		_, err = f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.Close())
+
+	var tt = []struct {
+		file    string
+		content string
+	}{
+		{file: logPath, content: "line-4\n"},
+		{file: logPath + ".1", content: "line-3\n"},
+		{file: logPath + ".2", content: "line-2\n"},
+	}
+
+	for _, tc := range tt {
+		b, err := os.ReadFile(tc.file)
+		require.NoError(t, err)
+		require.Equal(t, tc.content, string(b))
+	}
+
+	_, err = os.Stat(logPath + ".3")
+	require.True(t, os.IsNotExist(err))
+
+	// a failed rotation keeps writing to the current file and is retried on the next write
+	blocked := filepath.Join(t.TempDir(), "blocked.log")
+	require.NoError(t, os.MkdirAll(filepath.Join(blocked+".1", "dir"), 0o755))
+
+	f, err = NewRotatingFile(blocked, 10, 1)
+	require.NoError(t, err)
+
+	for _, line := range []string{"line-1\n", "line-2\n"} {
+		_, err = f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	b, err := os.ReadFile(blocked)
+	require.NoError(t, err)
+	require.Equal(t, "line-1\nline-2\n", string(b))
+
+	require.NoError(t, os.RemoveAll(blocked+".1"))
+	_, err = f.Write([]byte("line-3\n"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	b, err = os.ReadFile(blocked)
+	require.NoError(t, err)
+	require.Equal(t, "line-3\n", string(b))
+}
+
+func TestCatalog(t *testing.T) {
+	t.Parallel()
+
+	stored := []astera.ModuleVersion{
+		{Name: "github.com/!tmwalaszek/module1", Version: "v1.0.0"},
+		{Name: "github.com/!tmwalaszek/module1", Version: "v1.1.0"},
+		{Name: "github.com/tmwalaszek/module2", Version: "v0.1.0"},
+		{Name: "github.com/tmwalaszek/module3", Version: "v1.0.0", Source: astera.ModuleSourcePublished},
+		{Name: "github.com/tmwalaszek/module4", Version: "v1.0.0", Source: astera.ModuleSourceGit},
+		{Name: "github.com/tmwalaszek/private", Version: "v1.0.0", Source: astera.ModuleSourceImport},
+	}
+
+	c := NewCatalog(&mock.CatalogRepository{
+		CatalogFn: func(afterName, afterVersion string, limit int) ([]astera.ModuleVersion, error) {
+			var page []astera.ModuleVersion
+			for _, v := range stored {
+				if (v.Name > afterName || v.Name == afterName && v.Version > afterVersion) && len(page) < limit {
+					page = append(page, v)
+				}
+			}
+
+			return page, nil
+		},
+	}, "github.com/tmwalaszek/private")
+
+	var tt = []struct {
+		query   string
+		code    int
+		modules []astera.CatalogEntry
+		next    string
+	}{
+		{
+			query: "pagesize=2",
+			code:  http.StatusOK,
+			modules: []astera.CatalogEntry{
+				{Module: "github.com/Tmwalaszek/module1", Version: "v1.0.0"},
+				{Module: "github.com/Tmwalaszek/module1", Version: "v1.1.0"},
+			},
+			next: "github.com/!tmwalaszek/module1@v1.1.0",
+		},
+		{
+			query:   "pagesize=2&token=github.com/!tmwalaszek/module1@v1.1.0",
+			code:    http.StatusOK,
+			modules: []astera.CatalogEntry{{Module: "github.com/tmwalaszek/module2", Version: "v0.1.0"}},
+			next:    "github.com/tmwalaszek/module3@v1.0.0",
+		},
+		{
+			// private and published versions are left out
+			query:   "token=github.com/tmwalaszek/module2@v0.1.0",
+			code:    http.StatusOK,
+			modules: []astera.CatalogEntry{},
+		},
+		{
+			query: "pagesize=0",
+			code:  http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tt {
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/catalog?"+tc.query, nil))
+		require.Equal(t, tc.code, rec.Code, tc.query)
+
+		if tc.code != http.StatusOK {
+			continue
+		}
+
+		var resp catalogResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Equal(t, tc.modules, resp.Modules, tc.query)
+		require.Equal(t, tc.next, resp.Next, tc.query)
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	t.Parallel()
+
+	var tt = []struct {
+		name       string
+		configured string
+		sent       string
+		code       int
+	}{
+		{name: "valid token", configured: "secret", sent: "secret", code: http.StatusOK},
+		{name: "wrong token", configured: "secret", sent: "guess", code: http.StatusUnauthorized},
+		{name: "no token", configured: "secret", code: http.StatusUnauthorized},
+		{name: "not configured", sent: "", code: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			h := RequireToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), tc.configured)
+
+			req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.sent)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			require.Equal(t, tc.code, rec.Code)
+		})
+	}
+}
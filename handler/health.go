@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"astera/health"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+type Health struct {
+	checker *health.Checker
+}
+
+func NewHealth(checker *health.Checker) *Health {
+	return &Health{checker: checker}
+}
+
+// Liveness answers as long as the process is able to serve HTTP
+func (h *Health) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, health.Report{Status: health.StatusOK})
+}
+
+// Readiness runs all registered checks and fails only if a critical one fails
+func (h *Health) Readiness(w http.ResponseWriter, r *http.Request) {
+	report := h.checker.Run(r.Context())
+
+	code := http.StatusOK
+	if report.Status != health.StatusOK {
+		code = http.StatusServiceUnavailable
+		slog.Warn("readiness check failed", "checks", report.Checks)
+	}
+
+	writeJSON(w, code, report)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		slog.Error("failed to write response body", "err", err)
+	}
+}
@@ -0,0 +1,108 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Check returns nil when the probed dependency is healthy.
+type Check func(ctx context.Context) error
+
+type check struct {
+	name     string
+	critical bool
+	fn       Check
+}
+
+type Result struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+	Elapsed  string `json:"elapsed"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checker runs the registered checks concurrently. Only failing critical checks
+// make the whole report fail, the non critical ones (like upstream reachability)
+// are reported for information only.
+type Checker struct {
+	checks  []check
+	timeout time.Duration
+}
+
+func New(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+func (c *Checker) Register(name string, critical bool, fn Check) {
+	c.checks = append(c.checks, check{name: name, critical: critical, fn: fn})
+}
+
+func (c *Checker) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := Report{
+		Status: StatusOK,
+		Checks: make(map[string]Result, len(c.checks)),
+	}
+
+	var mx sync.Mutex
+	var wg sync.WaitGroup
+	for _, ch := range c.checks {
+		wg.Go(func() {
+			before := time.Now()
+			err := ch.fn(ctx)
+
+			result := Result{
+				Status:   StatusOK,
+				Critical: ch.critical,
+				Elapsed:  time.Since(before).String(),
+			}
+
+			if err != nil {
+				result.Status = StatusFail
+				result.Error = err.Error()
+			}
+
+			mx.Lock()
+			defer mx.Unlock()
+
+			report.Checks[ch.name] = result
+			if err != nil && ch.critical {
+				report.Status = StatusFail
+			}
+		})
+	}
+
+	wg.Wait()
+
+	return report
+}
+
+// DiskSpace fails when the filesystem holding dir has less than minFree bytes available.
+func DiskSpace(dir string, minFree uint64) Check {
+	return func(ctx context.Context) error {
+		free, err := freeSpace(dir)
+		if err != nil {
+			return err
+		}
+
+		if free < minFree {
+			return fmt.Errorf("%s has %d bytes free, need at least %d", dir, free, minFree)
+		}
+
+		return nil
+	}
+}
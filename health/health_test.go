@@ -0,0 +1,66 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckerRun(t *testing.T) {
+	t.Parallel()
+
+	okCheck := func(ctx context.Context) error { return nil }
+	failCheck := func(ctx context.Context) error { return errors.New("boom") }
+
+	var tt = []struct {
+		name     string
+		critical bool
+		check    Check
+		status   string
+	}{
+		{
+			name:     "critical ok",
+			critical: true,
+			check:    okCheck,
+			status:   StatusOK,
+		},
+		{
+			name:     "optional failing",
+			critical: false,
+			check:    failCheck,
+			status:   StatusOK,
+		},
+		{
+			name:     "critical failing",
+			critical: true,
+			check:    failCheck,
+			status:   StatusFail,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := New(time.Second)
+			c.Register("database", true, okCheck)
+			c.Register(tc.name, tc.critical, tc.check)
+
+			report := c.Run(context.Background())
+			require.Equal(t, tc.status, report.Status)
+			require.Len(t, report.Checks, 2)
+			require.Equal(t, StatusOK, report.Checks["database"].Status)
+		})
+	}
+}
+
+func TestDiskSpace(t *testing.T) {
+	t.Parallel()
+
+	err := DiskSpace(t.TempDir(), 1)(context.Background())
+	require.NoError(t, err)
+
+	err = DiskSpace(t.TempDir(), 1<<62)(context.Background())
+	require.Error(t, err)
+}
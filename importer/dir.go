@@ -0,0 +1,223 @@
+package importer
+
+import (
+	"astera"
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// downloadDir is a module cache (GOMODCACHE/cache/download) or a GOPROXY directory, both keep the
+// escaped module paths and versions as <module>/@v/<version>.{info,mod,zip,ziphash}
+type downloadDir struct {
+	root string
+}
+
+// walk sends the @v directories
+func (d *downloadDir) walk(ctx context.Context, tasks chan<- task) error {
+	return walkDirs(ctx, d.root, tasks, func(path string, entry fs.DirEntry) (*task, error) {
+		// the checksum database cache has no modules
+		if entry.Name() == "sumdb" && filepath.Dir(path) == d.root {
+			return nil, filepath.SkipDir
+		}
+
+		if entry.Name() != "@v" {
+			return nil, nil
+		}
+
+		rel, err := filepath.Rel(d.root, filepath.Dir(path))
+		if err != nil {
+			return nil, err
+		}
+
+		return &task{name: filepath.ToSlash(rel), dir: path}, filepath.SkipDir
+	})
+}
+
+func (d *downloadDir) versions(_ context.Context, t task) ([]string, error) {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, entry := range entries {
+		version, ok := strings.CutSuffix(entry.Name(), ".mod")
+		if ok && !entry.IsDir() {
+			versions = append(versions, version)
+		}
+	}
+
+	return versions, nil
+}
+
+// readVersion reads the version files, .info and .zip are optional
+func (d *downloadDir) readVersion(_ context.Context, t task, version string) (*astera.Module, error) {
+	base := filepath.Join(t.dir, version)
+
+	mod, err := os.ReadFile(base + ".mod")
+	if err != nil {
+		return nil, err
+	}
+
+	m := &astera.Module{Name: t.name, Version: version, Mod: mod}
+
+	m.Info, err = readOptional(base + ".info")
+	if err != nil {
+		return nil, err
+	}
+
+	m.Zip, err = readOptional(base + ".zip")
+	if err != nil || m.Zip == nil {
+		return m, err
+	}
+
+	zipHash, err := readOptional(base + ".ziphash")
+	if err != nil {
+		return nil, err
+	}
+
+	m.ZipHash = strings.TrimSpace(string(zipHash))
+
+	return m, nil
+}
+
+// athensDir is the disk storage of Athens, <module>/<version>/{go.mod,source.zip,<version>.info}.
+// Athens keeps the module paths and versions as they are, astera stores them escaped.
+type athensDir struct {
+	root string
+}
+
+// walk sends the module directories, the parents of the directories holding a go.mod
+func (d *athensDir) walk(ctx context.Context, tasks chan<- task) error {
+	sent := make(map[string]bool)
+
+	return walkDirs(ctx, d.root, tasks, func(path string, entry fs.DirEntry) (*task, error) {
+		if path == d.root {
+			return nil, nil
+		}
+
+		if _, err := os.Stat(filepath.Join(path, "go.mod")); err != nil {
+			return nil, nil
+		}
+
+		moduleDir := filepath.Dir(path)
+		if sent[moduleDir] {
+			return nil, filepath.SkipDir
+		}
+
+		sent[moduleDir] = true
+
+		rel, err := filepath.Rel(d.root, moduleDir)
+		if err != nil {
+			return nil, err
+		}
+
+		return &task{name: escaped(filepath.ToSlash(rel), module.UnescapePath, module.EscapePath), dir: moduleDir}, filepath.SkipDir
+	})
+}
+
+func (d *athensDir) versions(_ context.Context, t task) ([]string, error) {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		if _, err := os.Stat(filepath.Join(t.dir, entry.Name(), "go.mod")); err != nil {
+			continue
+		}
+
+		versions = append(versions, escaped(entry.Name(), module.UnescapeVersion, module.EscapeVersion))
+	}
+
+	return versions, nil
+}
+
+// readVersion reads go.mod, source.zip and <version>.info, only go.mod is required
+func (d *athensDir) readVersion(_ context.Context, t task, version string) (*astera.Module, error) {
+	raw, err := module.UnescapeVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(t.dir, raw)
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		raw = version
+		dir = filepath.Join(t.dir, raw)
+	}
+
+	mod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &astera.Module{Name: t.name, Version: version, Mod: mod}
+
+	m.Info, err = readOptional(filepath.Join(dir, raw+".info"))
+	if err != nil {
+		return nil, err
+	}
+
+	m.Zip, err = readOptional(filepath.Join(dir, "source.zip"))
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// escaped returns s in the escaped form, s may be escaped already. A value that is neither
+// is returned as it is and fails the validation.
+func escaped(s string, unescape, escape func(string) (string, error)) string {
+	if _, err := unescape(s); err == nil {
+		return s
+	}
+
+	if e, err := escape(s); err == nil {
+		return e
+	}
+
+	return s
+}
+
+// walkDirs sends the tasks fn makes of the directories under root, fn may return filepath.SkipDir
+// together with the task
+func walkDirs(ctx context.Context, root string, tasks chan<- task, fn func(path string, entry fs.DirEntry) (*task, error)) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+
+			slog.Warn("skipping unreadable directory", "path", path, "err", err)
+			return nil
+		}
+
+		if !entry.IsDir() {
+			return nil
+		}
+
+		t, err := fn(path, entry)
+		if t != nil {
+			select {
+			case tasks <- *t:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		return err
+	})
+}
@@ -0,0 +1,406 @@
+package importer
+
+import (
+	"archive/zip"
+	"astera"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+const (
+	defaultWorkers   = 4
+	defaultBatchSize = 64
+	// a batch is inserted early once its zips reach this size, the versions of a batch are held in memory
+	maxBatchBytes = 64 << 20
+
+	progressInterval = 10 * time.Second
+)
+
+// task is a module found by the walk of a source
+type task struct {
+	// name is the escaped module path
+	name string
+	// dir holds the versions of a directory source
+	dir string
+	// versions of the module known from the walk, the escaped versions
+	versions []string
+}
+
+// source is where the modules are imported from
+type source interface {
+	// walk sends the modules of the source
+	walk(ctx context.Context, tasks chan<- task) error
+	// versions lists the escaped versions of the module
+	versions(ctx context.Context, t task) ([]string, error)
+	// readVersion reads the version, it is validated afterwards
+	readVersion(ctx context.Context, t task, version string) (*astera.Module, error)
+}
+
+// result is a single version read by a worker, exactly one of the fields is set
+type result struct {
+	module  *astera.Module
+	skipped bool
+	failure *astera.ImportFailure
+}
+
+// Importer copies the modules of a directory (a module cache, a GOPROXY directory, an Athens disk
+// storage) or of a remote proxy into the repository. The modules are read by a pool of workers and
+// the versions are stored in batches, the progress of a batch is recorded once its versions are stored,
+// so an interrupted import resumes after the last batch. A version that can't be read or fails the
+// validation is reported and skipped.
+type Importer struct {
+	repository astera.ImportRepository
+	options    astera.ImportOptions
+}
+
+func New(repository astera.ImportRepository, options astera.ImportOptions) *Importer {
+	if options.Workers < 1 {
+		options.Workers = defaultWorkers
+	}
+
+	if options.BatchSize < 1 {
+		options.BatchSize = defaultBatchSize
+	}
+
+	return &Importer{repository: repository, options: options}
+}
+
+// Run imports the directory in the layout of the options
+func (i *Importer) Run(ctx context.Context, dir string) (*astera.ImportReport, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("import directory: %w", err)
+	}
+
+	var src source
+	switch i.options.Layout {
+	case "", astera.ImportLayoutDownload:
+		src = &downloadDir{root: dir}
+	case astera.ImportLayoutAthens:
+		src = &athensDir{root: dir}
+	default:
+		return nil, fmt.Errorf("unknown import layout %q", i.options.Layout)
+	}
+
+	return i.run(ctx, dir, src)
+}
+
+// Sync copies the modules matching patterns from a remote proxy, proxyURL identifies it in the
+// import progress. patterns is a comma separated list of module path globs in the GOPRIVATE syntax,
+// they need a proxy serving /catalog unless they are all exact module paths. Empty syncs the whole catalog.
+func (i *Importer) Sync(ctx context.Context, proxy astera.RemoteProxy, proxyURL, patterns string) (*astera.ImportReport, error) {
+	return i.run(ctx, proxyURL, &remote{proxy: proxy, patterns: patterns})
+}
+
+func (i *Importer) run(ctx context.Context, key string, src source) (*astera.ImportReport, error) {
+	var err error
+	if i.options.Restart && !i.options.DryRun {
+		err = i.repository.ResetImport(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var done map[string]bool
+	if !i.options.Restart {
+		done, err = i.repository.ImportedVersions(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report := &astera.ImportReport{Dir: key, DryRun: i.options.DryRun, Failed: []astera.ImportFailure{}}
+	started := time.Now()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tasks := make(chan task)
+	results := make(chan result, i.options.Workers)
+
+	var walkErr error
+	go func() {
+		defer close(tasks)
+		walkErr = src.walk(ctx, tasks)
+	}()
+
+	var modules atomic.Int64
+	var wg sync.WaitGroup
+	for range i.options.Workers {
+		wg.Go(func() {
+			for t := range tasks {
+				modules.Add(1)
+				i.readModule(ctx, src, t, done, results)
+			}
+		})
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	w := &writer{repository: i.repository, dir: key, report: report, dryRun: i.options.DryRun}
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for results != nil {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				results = nil
+				break
+			}
+
+			err = w.add(r, i.options.BatchSize)
+		case <-ticker.C:
+			slog.Info("import progress", "from", key, "imported", report.Imported, "skipped", report.Skipped,
+				"failed", len(report.Failed), "bytes", report.Bytes)
+		}
+
+		if err != nil {
+			// the repository is broken, stop the walk and the workers
+			cancel()
+
+			for range results {
+			}
+
+			report.Modules = int(modules.Load())
+			report.Elapsed = time.Since(started)
+
+			return report, err
+		}
+	}
+
+	err = w.flush()
+	report.Modules = int(modules.Load())
+	report.Elapsed = time.Since(started)
+
+	if err != nil {
+		return report, err
+	}
+
+	if walkErr != nil {
+		return report, walkErr
+	}
+
+	return report, ctx.Err()
+}
+
+// readModule reads and validates the versions of the module, skipping the ones imported before
+// and the ones already stored with their zip
+func (i *Importer) readModule(ctx context.Context, src source, t task, done map[string]bool, results chan<- result) {
+	versions, err := src.versions(ctx, t)
+	if err != nil {
+		send(ctx, results, result{failure: &astera.ImportFailure{Name: t.name, Err: err.Error()}})
+		return
+	}
+
+	for _, version := range versions {
+		var r result
+		if done[t.name+"@"+version] {
+			r.skipped = true
+		} else if stored, err := i.repository.HasModuleZip(t.name, version); err == nil && stored {
+			r.skipped = true
+		} else if m, err := src.readVersion(ctx, t, version); err != nil {
+			r.failure = &astera.ImportFailure{Name: t.name, Version: version, Err: err.Error()}
+		} else if err := Validate(m); err != nil {
+			r.failure = &astera.ImportFailure{Name: t.name, Version: version, Err: err.Error()}
+		} else if err := i.check(m); err != nil {
+			r.failure = &astera.ImportFailure{Name: t.name, Version: version, Err: err.Error()}
+		} else {
+			r.module = m
+		}
+
+		if !send(ctx, results, r) {
+			return
+		}
+	}
+}
+
+func (i *Importer) check(m *astera.Module) error {
+	if i.options.Check == nil {
+		return nil
+	}
+
+	return i.options.Check(m)
+}
+
+func send(ctx context.Context, results chan<- result, r result) bool {
+	select {
+	case results <- r:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Validate checks a version read from any source before it is stored, every source and the bundles
+// go through it. The zip hash is computed, a zip hash recorded by the source has to match it.
+func Validate(m *astera.Module) error {
+	modulePath, err := module.UnescapePath(m.Name)
+	if err != nil {
+		return err
+	}
+
+	version, err := module.UnescapeVersion(m.Version)
+	if err != nil {
+		return err
+	}
+
+	err = module.Check(modulePath, version)
+	if err != nil {
+		return err
+	}
+
+	_, err = modfile.ParseLax("go.mod", m.Mod, nil)
+	if err != nil {
+		return fmt.Errorf("invalid go.mod: %w", err)
+	}
+
+	m.Source = astera.ModuleSourceImport
+	if m.Zip == nil {
+		m.ZipHash = ""
+		return nil
+	}
+
+	hash, err := HashZip(m.Zip)
+	if err != nil {
+		return fmt.Errorf("invalid zip of %s: %w", modulePath, err)
+	}
+
+	if m.ZipHash != "" && m.ZipHash != hash {
+		return fmt.Errorf("zip hash %s doesn't match the recorded %s", hash, m.ZipHash)
+	}
+
+	m.ZipHash = hash
+
+	return nil
+}
+
+// HashZip computes the h1: hash of the module zip, like dirhash.HashZip of a file
+func HashZip(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+
+	files := make([]string, 0, len(zr.File))
+	byName := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+
+		files = append(files, f.Name)
+		byName[f.Name] = f
+	}
+
+	return dirhash.Hash1(files, func(name string) (io.ReadCloser, error) {
+		return byName[name].Open()
+	})
+}
+
+func readOptional(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+// writer collects the read versions into batches and keeps the report
+type writer struct {
+	repository astera.ImportRepository
+	dir        string
+	report     *astera.ImportReport
+	dryRun     bool
+
+	batch      []*astera.Module
+	batchBytes int64
+}
+
+func (w *writer) add(r result, batchSize int) error {
+	switch {
+	case r.skipped:
+		w.report.Skipped++
+	case r.failure != nil:
+		w.fail(r.failure.Name, r.failure.Version, r.failure.Err)
+	case r.module != nil:
+		w.batch = append(w.batch, r.module)
+		w.batchBytes += int64(len(r.module.Zip))
+
+		if len(w.batch) >= batchSize || w.batchBytes >= maxBatchBytes {
+			return w.flush()
+		}
+	}
+
+	return nil
+}
+
+func (w *writer) flush() error {
+	if len(w.batch) == 0 {
+		return nil
+	}
+
+	batch := w.batch
+	w.batch = nil
+	w.batchBytes = 0
+
+	if w.dryRun {
+		w.imported(batch...)
+		return nil
+	}
+
+	// the database refuses single versions, err is a failure of the database itself
+	errs, err := w.repository.InsertImportBatch(w.dir, batch)
+	if err != nil {
+		return err
+	}
+
+	for i, m := range batch {
+		switch {
+		case errs[i] == nil:
+			w.imported(m)
+		case errors.Is(errs[i], astera.ErrModuleAlreadyExists):
+			// stored meanwhile by a fetch or a publish
+			w.report.Skipped++
+		default:
+			w.fail(m.Name, m.Version, errs[i].Error())
+		}
+	}
+
+	return nil
+}
+
+func (w *writer) imported(modules ...*astera.Module) {
+	for _, m := range modules {
+		w.report.Imported++
+		w.report.Bytes += int64(len(m.Zip))
+	}
+}
+
+func (w *writer) fail(name, version, err string) {
+	slog.Warn("failed to import version", "module", name, "version", version, "err", err)
+	w.report.Failed = append(w.report.Failed, astera.ImportFailure{Name: name, Version: version, Err: err})
+}
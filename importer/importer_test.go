@@ -0,0 +1,316 @@
+package importer
+
+import (
+	"archive/zip"
+	"astera"
+	"astera/mock"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// writeVersion writes a version into the module cache at root, ziphash "" writes the correct hash
+func writeVersion(t *testing.T, root, name, version, ziphash string) {
+	t.Helper()
+
+	dir := filepath.Join(root, name, "@v")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+
+	base := filepath.Join(dir, version)
+	require.NoError(t, os.WriteFile(base+".mod", []byte("module "+name+"\n"), 0o644))
+	require.NoError(t, os.WriteFile(base+".info", []byte(`{"Version":"`+version+`"}`), 0o644))
+
+	require.NoError(t, os.WriteFile(base+".zip", moduleZip(t, name, version), 0o644))
+
+	if ziphash == "" {
+		var err error
+		ziphash, err = dirhash.HashZip(base+".zip", dirhash.Hash1)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, os.WriteFile(base+".ziphash", []byte(ziphash+"\n"), 0o644))
+}
+
+func moduleZip(t *testing.T, name, version string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create(name + "@" + version + "/go.mod")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("module " + name + "\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	return buf.Bytes()
+}
+
+type memoryImports struct {
+	mx       sync.Mutex
+	batches  int
+	imported map[string]*astera.Module
+	failOn   string
+}
+
+func (m *memoryImports) repository() *mock.ImportRepository {
+	return &mock.ImportRepository{
+		InsertImportBatchFn: func(dir string, modules []*astera.Module) ([]error, error) {
+			m.mx.Lock()
+			defer m.mx.Unlock()
+
+			errs := make([]error, len(modules))
+			stored := false
+			for i, module := range modules {
+				if module.Name == m.failOn {
+					errs[i] = errors.New("constraint failed")
+					continue
+				}
+
+				m.imported[module.Name+"@"+module.Version] = module
+				stored = true
+			}
+
+			// the progress is recorded for the stored versions only
+			if stored {
+				m.batches++
+			}
+
+			return errs, nil
+		},
+		ImportedVersionsFn: func(dir string) (map[string]bool, error) {
+			m.mx.Lock()
+			defer m.mx.Unlock()
+
+			versions := make(map[string]bool)
+			for key := range m.imported {
+				versions[key] = true
+			}
+
+			return versions, nil
+		},
+		ResetImportFn: func(dir string) error {
+			m.mx.Lock()
+			defer m.mx.Unlock()
+
+			m.imported = make(map[string]*astera.Module)
+			return nil
+		},
+		HasModuleZipFn: func(name, version string) (bool, error) {
+			m.mx.Lock()
+			defer m.mx.Unlock()
+
+			stored, ok := m.imported[name+"@"+version]
+			return ok && stored.Zip != nil, nil
+		},
+	}
+}
+
+func TestImporter(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeVersion(t, root, "github.com/tmwalaszek/module1", "v1.0.0", "")
+	writeVersion(t, root, "github.com/tmwalaszek/module1", "v1.1.0", "")
+	writeVersion(t, root, "github.com/!tmwalaszek/module2", "v0.1.0", "")
+	writeVersion(t, root, "github.com/tmwalaszek/corrupted", "v1.0.0", "h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")
+	writeVersion(t, root, "github.com/tmwalaszek/rejected", "v1.0.0", "")
+
+	// a version downloaded without its zip is imported with .info and .mod only
+	require.NoError(t, os.WriteFile(filepath.Join(root, "github.com/tmwalaszek/module1/@v/v1.2.0.mod"), []byte("module github.com/tmwalaszek/module1\n"), 0o644))
+	// the checksum database cache is not a module
+	writeVersion(t, root, "sumdb/sum.golang.org/lookup", "v1.0.0", "")
+
+	store := &memoryImports{imported: make(map[string]*astera.Module), failOn: "github.com/tmwalaszek/rejected"}
+
+	// dry run stores nothing
+	report, err := New(store.repository(), astera.ImportOptions{Workers: 2, BatchSize: 2, DryRun: true}).Run(context.Background(), root)
+	require.NoError(t, err)
+	require.Equal(t, 4, report.Modules)
+	require.Equal(t, 5, report.Imported)
+	require.Len(t, report.Failed, 1)
+	require.Empty(t, store.imported)
+
+	report, err = New(store.repository(), astera.ImportOptions{Workers: 2, BatchSize: 2}).Run(context.Background(), root)
+	require.NoError(t, err)
+	require.Equal(t, 4, report.Imported)
+	require.Len(t, report.Failed, 2)
+	require.Len(t, store.imported, 4)
+
+	failed := map[string]string{}
+	for _, f := range report.Failed {
+		failed[f.Name] = f.Err
+	}
+
+	require.Contains(t, failed["github.com/tmwalaszek/corrupted"], "doesn't match the recorded")
+	require.Equal(t, "constraint failed", failed["github.com/tmwalaszek/rejected"])
+
+	m := store.imported["github.com/!tmwalaszek/module2@v0.1.0"]
+	require.Equal(t, astera.ModuleSourceImport, m.Source)
+	require.NotEmpty(t, m.Zip)
+	require.Contains(t, m.ZipHash, "h1:")
+	require.Nil(t, store.imported["github.com/tmwalaszek/module1@v1.2.0"].Zip)
+
+	// the second run resumes, only the failed versions are read again
+	batches := store.batches
+	report, err = New(store.repository(), astera.ImportOptions{}).Run(context.Background(), root)
+	require.NoError(t, err)
+	require.Equal(t, 0, report.Imported)
+	require.Equal(t, 4, report.Skipped)
+	require.Len(t, report.Failed, 2)
+	require.Equal(t, batches, store.batches)
+
+	report, err = New(store.repository(), astera.ImportOptions{Restart: true}).Run(context.Background(), root)
+	require.NoError(t, err)
+	require.Equal(t, 4, report.Imported)
+	require.Equal(t, 0, report.Skipped)
+
+	// a version the check refuses is reported as failed
+	check := func(m *astera.Module) error {
+		if m.Name == "github.com/!tmwalaszek/module2" {
+			return errors.New("quarantined")
+		}
+
+		return nil
+	}
+
+	empty := &memoryImports{imported: make(map[string]*astera.Module)}
+	report, err = New(empty.repository(), astera.ImportOptions{DryRun: true, Check: check}).Run(context.Background(), root)
+	require.NoError(t, err)
+	require.Equal(t, 4, report.Imported)
+	require.Contains(t, report.Failed, astera.ImportFailure{Name: "github.com/!tmwalaszek/module2", Version: "v0.1.0", Err: "quarantined"})
+}
+
+func TestImporterAthens(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+
+	// athens keeps the paths and versions as they are
+	writeAthens := func(modulePath, version string, withZip bool) {
+		dir := filepath.Join(root, modulePath, version)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module "+modulePath+"\n"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, version+".info"), []byte(`{"Version":"`+version+`"}`), 0o644))
+		if withZip {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "source.zip"), moduleZip(t, modulePath, version), 0o644))
+		}
+	}
+
+	writeAthens("github.com/Tmwalaszek/module1", "v1.0.0", true)
+	writeAthens("github.com/Tmwalaszek/module1", "v1.1.0", false)
+	writeAthens("github.com/Tmwalaszek/module1/v2", "v2.0.0", true)
+	writeAthens("github.com/tmwalaszek/module2", "v0.1.0-RC1", true)
+
+	store := &memoryImports{imported: make(map[string]*astera.Module)}
+
+	report, err := New(store.repository(), astera.ImportOptions{Layout: astera.ImportLayoutAthens}).Run(context.Background(), root)
+	require.NoError(t, err)
+	require.Equal(t, 3, report.Modules)
+	require.Equal(t, 4, report.Imported)
+	require.Empty(t, report.Failed)
+
+	m := store.imported["github.com/!tmwalaszek/module1@v1.0.0"]
+	require.NotNil(t, m)
+	require.Equal(t, `{"Version":"v1.0.0"}`, string(m.Info))
+	require.Contains(t, m.ZipHash, "h1:")
+	require.Nil(t, store.imported["github.com/!tmwalaszek/module1@v1.1.0"].Zip)
+	require.NotNil(t, store.imported["github.com/!tmwalaszek/module1/v2@v2.0.0"])
+	require.NotNil(t, store.imported["github.com/tmwalaszek/module2@v0.1.0-!r!c1"])
+
+	_, err = New(store.repository(), astera.ImportOptions{Layout: "unknown"}).Run(context.Background(), root)
+	require.ErrorContains(t, err, "unknown import layout")
+}
+
+func TestImporterSync(t *testing.T) {
+	t.Parallel()
+
+	catalog := []astera.CatalogEntry{
+		{Module: "github.com/ourorg/module1", Version: "v1.0.0"},
+		{Module: "github.com/ourorg/module1", Version: "v1.1.0-0.20250101000000-89cbdd9e7b39"},
+		{Module: "github.com/ourorg/module2", Version: "v0.1.0"},
+		{Module: "github.com/other/module3", Version: "v1.0.0"},
+	}
+
+	var fetched sync.Map
+	proxy := &mock.RemoteProxy{
+		FetchCatalogFn: func(ctx context.Context, token string, pageSize int) ([]astera.CatalogEntry, string, error) {
+			// two entries a page
+			start := 0
+			if token != "" {
+				_, err := fmt.Sscan(token, &start)
+				require.NoError(t, err)
+			}
+
+			end := min(start+2, len(catalog))
+			next := ""
+			if end < len(catalog) {
+				next = fmt.Sprint(end)
+			}
+
+			return catalog[start:end], next, nil
+		},
+		FetchListFn: func(ctx context.Context, module string) ([]byte, error) {
+			if module == "github.com/other/module3" {
+				return []byte("v1.0.0\n"), nil
+			}
+
+			return nil, astera.ErrModuleNotFound
+		},
+		FetchModuleInfoFn: func(ctx context.Context, module, version string) ([]byte, error) {
+			return []byte(`{"Version":"` + version + `"}`), nil
+		},
+		FetchModuleModFn: func(ctx context.Context, module, version string) ([]byte, error) {
+			if module == "github.com/ourorg/module2" {
+				return []byte("module (\n"), nil
+			}
+
+			return []byte("module " + module + "\n"), nil
+		},
+		FetchModuleZipFn: func(ctx context.Context, module, version string) ([]byte, error) {
+			fetched.Store(module+"@"+version, true)
+			if module == "github.com/other/module3" {
+				return nil, astera.ErrModuleNotFound
+			}
+
+			return moduleZip(t, module, version), nil
+		},
+	}
+
+	store := &memoryImports{imported: make(map[string]*astera.Module)}
+
+	report, err := New(store.repository(), astera.ImportOptions{}).Sync(context.Background(), proxy, "http://astera:8080", "github.com/ourorg/*")
+	require.NoError(t, err)
+	require.Equal(t, "http://astera:8080", report.Dir)
+	require.Equal(t, 2, report.Modules)
+	require.Equal(t, 2, report.Imported)
+	require.Len(t, report.Failed, 1)
+	require.Contains(t, report.Failed[0].Err, "invalid go.mod")
+
+	m := store.imported["github.com/ourorg/module1@v1.1.0-0.20250101000000-89cbdd9e7b39"]
+	require.NotNil(t, m)
+	require.Equal(t, astera.ModuleSourceImport, m.Source)
+	require.Contains(t, m.ZipHash, "h1:")
+
+	// exact module paths are listed without the catalog, a missing zip gives a partial version
+	report, err = New(store.repository(), astera.ImportOptions{}).Sync(context.Background(), proxy, "http://astera:8080", "github.com/other/module3")
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Imported)
+	require.Nil(t, store.imported["github.com/other/module3@v1.0.0"].Zip)
+
+	// the versions stored with their zip are not downloaded again
+	fetched.Clear()
+	report, err = New(store.repository(), astera.ImportOptions{}).Sync(context.Background(), proxy, "http://other:8080", "github.com/ourorg/*")
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Skipped)
+	require.Equal(t, 0, report.Imported)
+	_, ok := fetched.Load("github.com/ourorg/module1@v1.0.0")
+	require.False(t, ok)
+}
@@ -0,0 +1,155 @@
+package importer
+
+import (
+	"astera"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+const catalogPageSize = 1000
+
+// remote is a GOPROXY, the modules are listed by its /catalog or, for exact module paths, by @v/list
+type remote struct {
+	proxy    astera.RemoteProxy
+	patterns string
+}
+
+func (r *remote) walk(ctx context.Context, tasks chan<- task) error {
+	if r.patterns != "" && !strings.ContainsAny(r.patterns, "*?[\\") {
+		for _, modulePath := range strings.Split(r.patterns, ",") {
+			modulePath = strings.TrimSpace(modulePath)
+			if modulePath == "" {
+				continue
+			}
+
+			name, err := module.EscapePath(modulePath)
+			if err != nil {
+				return err
+			}
+
+			select {
+			case tasks <- task{name: name}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		return nil
+	}
+
+	return r.walkCatalog(ctx, tasks)
+}
+
+// walkCatalog sends the modules of the catalog matching the patterns with their versions, the catalog
+// is ordered by module so the versions of a module are next to each other
+func (r *remote) walkCatalog(ctx context.Context, tasks chan<- task) error {
+	var current task
+
+	flush := func() error {
+		if current.name == "" {
+			return nil
+		}
+
+		select {
+		case tasks <- current:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		current = task{}
+
+		return nil
+	}
+
+	token := ""
+	for {
+		entries, next, err := r.proxy.FetchCatalog(ctx, token, catalogPageSize)
+		if errors.Is(err, astera.ErrModuleNotFound) {
+			return errors.New("the proxy has no /catalog, list exact module paths without wildcards")
+		}
+
+		if err != nil {
+			return fmt.Errorf("catalog: %w", err)
+		}
+
+		for _, entry := range entries {
+			if r.patterns != "" && !module.MatchPrefixPatterns(r.patterns, entry.Module) {
+				continue
+			}
+
+			name, err := module.EscapePath(entry.Module)
+			if err != nil {
+				continue
+			}
+
+			version, err := module.EscapeVersion(entry.Version)
+			if err != nil {
+				continue
+			}
+
+			if name != current.name {
+				err = flush()
+				if err != nil {
+					return err
+				}
+
+				current.name = name
+			}
+
+			current.versions = append(current.versions, version)
+		}
+
+		if next == "" || next == token {
+			return flush()
+		}
+
+		token = next
+	}
+}
+
+func (r *remote) versions(ctx context.Context, t task) ([]string, error) {
+	if t.versions != nil {
+		return t.versions, nil
+	}
+
+	list, err := r.proxy.FetchList(ctx, t.name)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, version := range strings.Fields(string(list)) {
+		version, err := module.EscapeVersion(version)
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// readVersion downloads the version, a proxy without its zip gives a version with .info and .mod only
+func (r *remote) readVersion(ctx context.Context, t task, version string) (*astera.Module, error) {
+	info, err := r.proxy.FetchModuleInfo(ctx, t.name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	mod, err := r.proxy.FetchModuleMod(ctx, t.name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	zip, err := r.proxy.FetchModuleZip(ctx, t.name, version)
+	if err != nil && !errors.Is(err, astera.ErrModuleNotFound) {
+		return nil, err
+	}
+
+	return &astera.Module{Name: t.name, Version: version, Info: info, Mod: mod, Zip: zip}, nil
+}
@@ -0,0 +1,247 @@
+package jobs
+
+import (
+	"astera"
+	"astera/schedule"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPollInterval = 10 * time.Second
+	defaultRetryDelay   = 30 * time.Second
+	maxRetryDelay       = time.Hour
+)
+
+// Handler does the work of a job, a nil error finishes it
+type Handler func(ctx context.Context, job *astera.Job) error
+
+type Config struct {
+	// Workers is the number of jobs running at once
+	Workers int
+	// MaxAttempts is how many times a job is tried before it is marked failed
+	MaxAttempts int
+	// PollInterval is how often idle workers look for due jobs, Notify wakes them earlier
+	PollInterval time.Duration
+	// RetryDelay is the delay after the first failure, it doubles with every attempt
+	RetryDelay time.Duration
+	// Schedule holds back the non urgent jobs (prefetch, mirror) outside its windows or over
+	// its budget, nil runs them any time
+	Schedule *schedule.Schedule
+}
+
+// deferredKinds are the kinds of jobs nobody is waiting for, they run only when the schedule is open
+var deferredKinds = []string{astera.JobKindPrefetch, astera.JobKindMirror}
+
+// Pool runs the jobs stored in the repository with a fixed number of workers. The jobs survive
+// restarts, the ones left running by a previous process are picked up again on Start.
+type Pool struct {
+	repository astera.JobRepository
+	handler    Handler
+	config     Config
+
+	wake chan struct{}
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mx      sync.Mutex
+	running map[int64]context.CancelFunc
+}
+
+func New(repository astera.JobRepository, handler Handler, config Config) *Pool {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultPollInterval
+	}
+
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = defaultRetryDelay
+	}
+
+	return &Pool{
+		repository: repository,
+		handler:    handler,
+		config:     config,
+		wake:       make(chan struct{}, 1),
+		running:    make(map[int64]context.CancelFunc),
+	}
+}
+
+// Start recovers the jobs interrupted by the previous process and starts the workers
+func (p *Pool) Start() {
+	n, err := p.repository.ResetRunningJobs()
+	if err != nil {
+		slog.Error("failed to reset interrupted jobs", "err", err)
+	} else if n > 0 {
+		slog.Info("resuming interrupted jobs", "jobs", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	for range p.config.Workers {
+		p.wg.Go(func() { p.work(ctx) })
+	}
+}
+
+// Stop cancels the running jobs, they are left to the next Start, and waits for the workers
+func (p *Pool) Stop(ctx context.Context) error {
+	if p.cancel == nil {
+		return nil
+	}
+
+	p.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Enqueue stores the job and wakes a worker if it is due
+func (p *Pool) Enqueue(job *astera.Job) (bool, error) {
+	added, err := p.repository.EnqueueJob(job)
+	if err != nil {
+		return false, err
+	}
+
+	if added && !job.NextAttempt.After(time.Now()) {
+		p.Notify()
+	}
+
+	return added, nil
+}
+
+// Notify wakes an idle worker to look for due jobs
+func (p *Pool) Notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Cancel removes the job and stops it when it is running
+func (p *Pool) Cancel(id int64) error {
+	deleted, err := p.repository.DeleteJob(id)
+	if err != nil {
+		return err
+	}
+
+	p.mx.Lock()
+	cancel, running := p.running[id]
+	p.mx.Unlock()
+
+	if running {
+		cancel()
+	}
+
+	if !deleted && !running {
+		return fmt.Errorf("%w: job %d", astera.ErrModuleNotFound, id)
+	}
+
+	return nil
+}
+
+func (p *Pool) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		var skip []string
+		if !p.config.Schedule.Open() {
+			skip = deferredKinds
+		}
+
+		job, err := p.repository.ClaimJob(time.Now(), skip)
+		if err != nil {
+			slog.Error("failed to claim job", "err", err)
+		}
+
+		if job != nil {
+			p.run(ctx, job)
+
+			// look for the next one right away
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-p.wake:
+		case <-time.After(p.config.PollInterval):
+		}
+	}
+}
+
+func (p *Pool) run(ctx context.Context, job *astera.Job) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p.mx.Lock()
+	p.running[job.ID] = cancel
+	p.mx.Unlock()
+
+	defer func() {
+		p.mx.Lock()
+		delete(p.running, job.ID)
+		p.mx.Unlock()
+	}()
+
+	logger := slog.With("job", job.ID, "kind", job.Kind, "module", job.Name, "version", job.Version)
+
+	reqInfo := &astera.RequestInfo{ID: fmt.Sprintf("job-%d", job.ID), Client: "job:" + job.Kind}
+	ctx = astera.WithRequestInfo(ctx, reqInfo)
+
+	before := time.Now()
+	err := p.handler(ctx, job)
+
+	if slices.Contains(deferredKinds, job.Kind) {
+		p.config.Schedule.Record(reqInfo.UpstreamBytes())
+	}
+
+	switch {
+	case err == nil:
+		logger.Info("job done", "elapsed", time.Since(before), "bytes", reqInfo.UpstreamBytes())
+		err = p.repository.FinishJob(job.Name, job.Version)
+	case ctx.Err() != nil:
+		// stopped or cancelled, a cancelled job is already deleted
+		logger.Info("job interrupted", "err", err)
+		err = p.repository.RetryJob(job.ID, job.Attempts, time.Now(), job.LastError)
+	case errors.Is(err, astera.ErrModuleNotFound) || errors.Is(err, astera.ErrPolicyDenied) || job.Attempts+1 >= p.config.MaxAttempts:
+		logger.Warn("job failed", "attempts", job.Attempts+1, "err", err)
+		err = p.repository.FailJob(job.ID, job.Attempts+1, err.Error())
+	default:
+		delay := p.retryDelay(job.Attempts + 1)
+		logger.Warn("job failed, retrying", "attempts", job.Attempts+1, "delay", delay, "err", err)
+		err = p.repository.RetryJob(job.ID, job.Attempts+1, time.Now().Add(delay), err.Error())
+	}
+
+	if err != nil {
+		logger.Error("failed to update job", "err", err)
+	}
+}
+
+// retryDelay doubles with every attempt, with jitter so the jobs failed together spread out
+func (p *Pool) retryDelay(attempt int) time.Duration {
+	delay := min(p.config.RetryDelay<<min(attempt-1, 16), maxRetryDelay)
+
+	return delay/2 + rand.N(delay/2+1)
+}
@@ -0,0 +1,184 @@
+package jobs
+
+import (
+	"astera"
+	"astera/mock"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryQueue is a JobRepository keeping the jobs in a slice
+type memoryQueue struct {
+	mx     sync.Mutex
+	jobs   []*astera.Job
+	nextID int64
+}
+
+func (q *memoryQueue) repository() *mock.JobRepository {
+	return &mock.JobRepository{
+		EnqueueJobFn: func(job *astera.Job) (bool, error) {
+			q.mx.Lock()
+			defer q.mx.Unlock()
+
+			q.nextID++
+			j := *job
+			j.ID = q.nextID
+			j.State = astera.JobStatePending
+			q.jobs = append(q.jobs, &j)
+
+			return true, nil
+		},
+		ClaimJobFn: func(now time.Time, skipKinds []string) (*astera.Job, error) {
+			q.mx.Lock()
+			defer q.mx.Unlock()
+
+			for _, j := range q.jobs {
+				if j.State == astera.JobStatePending && !j.NextAttempt.After(now) && !slices.Contains(skipKinds, j.Kind) {
+					j.State = astera.JobStateRunning
+					claimed := *j
+					return &claimed, nil
+				}
+			}
+
+			return nil, nil
+		},
+		FinishJobFn: func(name, version string) error {
+			q.mx.Lock()
+			defer q.mx.Unlock()
+
+			for i, j := range q.jobs {
+				if j.Name == name && j.Version == version {
+					q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+					break
+				}
+			}
+
+			return nil
+		},
+		RetryJobFn: func(id int64, attempts int, nextAttempt time.Time, lastErr string) error {
+			return q.update(id, astera.JobStatePending, attempts, lastErr, nextAttempt)
+		},
+		FailJobFn: func(id int64, attempts int, lastErr string) error {
+			return q.update(id, astera.JobStateFailed, attempts, lastErr, time.Time{})
+		},
+		DeleteJobFn: func(id int64) (bool, error) {
+			q.mx.Lock()
+			defer q.mx.Unlock()
+
+			for i, j := range q.jobs {
+				if j.ID == id {
+					q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+					return true, nil
+				}
+			}
+
+			return false, nil
+		},
+		ResetRunningJobsFn: func() (int64, error) {
+			return 0, nil
+		},
+	}
+}
+
+func (q *memoryQueue) update(id int64, state string, attempts int, lastErr string, nextAttempt time.Time) error {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	for _, j := range q.jobs {
+		if j.ID == id {
+			j.State = state
+			j.Attempts = attempts
+			j.LastError = lastErr
+			j.NextAttempt = nextAttempt
+		}
+	}
+
+	return nil
+}
+
+func (q *memoryQueue) snapshot() []astera.Job {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	jobs := make([]astera.Job, 0, len(q.jobs))
+	for _, j := range q.jobs {
+		jobs = append(jobs, *j)
+	}
+
+	return jobs
+}
+
+func TestPool(t *testing.T) {
+	t.Parallel()
+
+	q := &memoryQueue{}
+
+	var mx sync.Mutex
+	calls := make(map[string]int)
+	handler := func(ctx context.Context, job *astera.Job) error {
+		mx.Lock()
+		calls[job.Name]++
+		n := calls[job.Name]
+		mx.Unlock()
+
+		switch job.Name {
+		case "github.com/tmwalaszek/flaky":
+			if n == 1 {
+				return errors.New("connection reset")
+			}
+		case "github.com/tmwalaszek/missing":
+			return astera.ErrModuleNotFound
+		case "github.com/tmwalaszek/slow":
+			<-ctx.Done()
+			return ctx.Err()
+		}
+
+		return nil
+	}
+
+	p := New(q.repository(), handler, Config{
+		Workers:      2,
+		MaxAttempts:  3,
+		PollInterval: time.Millisecond,
+		RetryDelay:   time.Millisecond,
+	})
+	p.Start()
+
+	for _, name := range []string{"github.com/tmwalaszek/flaky", "github.com/tmwalaszek/missing", "github.com/tmwalaszek/slow"} {
+		added, err := p.Enqueue(&astera.Job{Name: name, Version: "v1.0.0", Kind: astera.JobKindMiss, NextAttempt: time.Now()})
+		require.NoError(t, err)
+		require.True(t, added)
+	}
+
+	// flaky is retried and finished, missing fails right away, slow keeps running
+	require.Eventually(t, func() bool {
+		jobs := q.snapshot()
+		return len(jobs) == 2 && jobs[0].State == astera.JobStateFailed && jobs[1].State == astera.JobStateRunning
+	}, time.Second, time.Millisecond)
+
+	jobs := q.snapshot()
+	require.Equal(t, "github.com/tmwalaszek/missing", jobs[0].Name)
+	require.Equal(t, astera.ErrModuleNotFound.Error(), jobs[0].LastError)
+
+	mx.Lock()
+	require.Equal(t, 2, calls["github.com/tmwalaszek/flaky"])
+	mx.Unlock()
+
+	// cancelling stops the running job
+	require.NoError(t, p.Cancel(jobs[1].ID))
+	require.Eventually(t, func() bool {
+		p.mx.Lock()
+		defer p.mx.Unlock()
+
+		return len(q.snapshot()) == 1 && len(p.running) == 0
+	}, time.Second, time.Millisecond)
+
+	require.ErrorIs(t, p.Cancel(jobs[1].ID), astera.ErrModuleNotFound)
+	require.NoError(t, p.Stop(context.Background()))
+}
@@ -0,0 +1,141 @@
+package limiter
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// FairQueue limits the number of concurrent operations. When all slots are taken the
+// waiters are queued per key and the freed slots are handed out round robin between the
+// keys, so a single client with a burst of requests can't starve the others.
+// A nil *FairQueue doesn't limit anything.
+type FairQueue struct {
+	slots int
+
+	mx     sync.Mutex
+	used   int
+	queues map[string][]*waiter
+	// keys with waiters in the order they will be served
+	order []string
+}
+
+// NewFairQueue returns nil, meaning no limit, when slots is not positive
+func NewFairQueue(slots int) *FairQueue {
+	if slots <= 0 {
+		return nil
+	}
+
+	return &FairQueue{
+		slots:  slots,
+		queues: make(map[string][]*waiter),
+	}
+}
+
+// Acquire waits for a free slot. The returned function releases the slot and must be called
+// once the operation is done.
+func (q *FairQueue) Acquire(ctx context.Context, key string) (func(), error) {
+	if q == nil {
+		return func() {}, nil
+	}
+
+	q.mx.Lock()
+	if q.used < q.slots && len(q.order) == 0 {
+		q.used++
+		q.mx.Unlock()
+
+		return q.releaseFunc(), nil
+	}
+
+	w := &waiter{ready: make(chan struct{})}
+	if len(q.queues[key]) == 0 {
+		q.order = append(q.order, key)
+	}
+	q.queues[key] = append(q.queues[key], w)
+	q.mx.Unlock()
+
+	select {
+	case <-w.ready:
+		return q.releaseFunc(), nil
+	case <-ctx.Done():
+	}
+
+	q.mx.Lock()
+	if w.granted {
+		// the slot was handed over while we were giving up, pass it on
+		q.mx.Unlock()
+		q.release()
+
+		return nil, ctx.Err()
+	}
+
+	q.remove(key, w)
+	q.mx.Unlock()
+
+	return nil, ctx.Err()
+}
+
+// Queued returns the number of operations waiting for a slot
+func (q *FairQueue) Queued() int {
+	if q == nil {
+		return 0
+	}
+
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	n := 0
+	for _, waiters := range q.queues {
+		n += len(waiters)
+	}
+
+	return n
+}
+
+func (q *FairQueue) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(q.release)
+	}
+}
+
+func (q *FairQueue) release() {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	if len(q.order) == 0 {
+		q.used--
+		return
+	}
+
+	key := q.order[0]
+	q.order = q.order[1:]
+
+	waiters := q.queues[key]
+	w := waiters[0]
+	if len(waiters) == 1 {
+		delete(q.queues, key)
+	} else {
+		q.queues[key] = waiters[1:]
+		q.order = append(q.order, key)
+	}
+
+	w.granted = true
+	close(w.ready)
+}
+
+func (q *FairQueue) remove(key string, w *waiter) {
+	waiters := slices.DeleteFunc(q.queues[key], func(v *waiter) bool { return v == w })
+	if len(waiters) > 0 {
+		q.queues[key] = waiters
+		return
+	}
+
+	delete(q.queues, key)
+	q.order = slices.DeleteFunc(q.order, func(k string) bool { return k == key })
+}
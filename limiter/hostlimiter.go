@@ -0,0 +1,157 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+type hostSlots struct {
+	// nil when there is no per host limit
+	sem chan struct{}
+
+	active atomic.Int64
+	queued atomic.Int64
+}
+
+// HostLimiter bounds the number of concurrent operations (downloads, git processes) in total
+// and per host. Waiting operations give up when their context is done.
+// A nil *HostLimiter doesn't limit anything.
+type HostLimiter struct {
+	// nil when there is no global limit
+	global  chan struct{}
+	perHost int
+
+	mx    sync.Mutex
+	hosts map[string]*hostSlots
+
+	active atomic.Int64
+	queued atomic.Int64
+}
+
+// HostStats are the operations running and waiting for a slot
+type HostStats struct {
+	Active int64 `json:"active"`
+	Queued int64 `json:"queued"`
+}
+
+type HostLimiterStats struct {
+	HostStats
+	Hosts map[string]HostStats `json:"hosts"`
+}
+
+// NewHostLimiter returns nil, meaning no limit, when neither limit is positive
+func NewHostLimiter(global, perHost int) *HostLimiter {
+	if global <= 0 && perHost <= 0 {
+		return nil
+	}
+
+	l := &HostLimiter{
+		perHost: perHost,
+		hosts:   make(map[string]*hostSlots),
+	}
+
+	if global > 0 {
+		l.global = make(chan struct{}, global)
+	}
+
+	return l
+}
+
+// Acquire waits for a slot of host and a global one. The returned function releases them
+// and must be called once the operation is done.
+func (l *HostLimiter) Acquire(ctx context.Context, host string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	h := l.host(host)
+
+	h.queued.Add(1)
+	l.queued.Add(1)
+	defer h.queued.Add(-1)
+	defer l.queued.Add(-1)
+
+	// the host slot first, so an operation blocked on a busy host doesn't hold a global slot
+	err := acquire(ctx, h.sem)
+	if err != nil {
+		return nil, err
+	}
+
+	err = acquire(ctx, l.global)
+	if err != nil {
+		release(h.sem)
+		return nil, err
+	}
+
+	h.active.Add(1)
+	l.active.Add(1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.active.Add(-1)
+			l.active.Add(-1)
+
+			release(l.global)
+			release(h.sem)
+		})
+	}, nil
+}
+
+// Stats returns the running and queued operations in total and per host, it is meant to be
+// published with expvar.Func
+func (l *HostLimiter) Stats() any {
+	stats := HostLimiterStats{Hosts: make(map[string]HostStats)}
+	if l == nil {
+		return stats
+	}
+
+	stats.Active = l.active.Load()
+	stats.Queued = l.queued.Load()
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	for name, h := range l.hosts {
+		stats.Hosts[name] = HostStats{Active: h.active.Load(), Queued: h.queued.Load()}
+	}
+
+	return stats
+}
+
+func (l *HostLimiter) host(name string) *hostSlots {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	h, ok := l.hosts[name]
+	if !ok {
+		h = &hostSlots{}
+		if l.perHost > 0 {
+			h.sem = make(chan struct{}, l.perHost)
+		}
+
+		l.hosts[name] = h
+	}
+
+	return h
+}
+
+func acquire(ctx context.Context, sem chan struct{}) error {
+	if sem == nil {
+		return nil
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func release(sem chan struct{}) {
+	if sem != nil {
+		<-sem
+	}
+}
@@ -0,0 +1,95 @@
+package limiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const cleanupInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// KeyedLimiter is a token bucket per key (client IP or token). Buckets refill at rate
+// tokens per second up to burst. A nil *KeyedLimiter allows everything.
+type KeyedLimiter struct {
+	rate  float64
+	burst float64
+
+	mx          sync.Mutex
+	buckets     map[string]*bucket
+	lastCleanup time.Time
+
+	now func() time.Time
+}
+
+// NewKeyedLimiter returns nil, meaning no limit, when rate is not positive
+func NewKeyedLimiter(rate float64, burst int) *KeyedLimiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &KeyedLimiter{
+		rate:        rate,
+		burst:       float64(burst),
+		buckets:     make(map[string]*bucket),
+		lastCleanup: time.Now(),
+		now:         time.Now,
+	}
+}
+
+// Allow takes a token from the key's bucket. When the bucket is empty it returns false
+// and how long the client should wait for the next token.
+func (l *KeyedLimiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	now := l.now()
+	l.cleanup(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		retryAfter := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, retryAfter
+	}
+
+	b.tokens--
+
+	return true, 0
+}
+
+// cleanup drops the buckets that had time to refill completely, they are
+// indistinguishable from new ones
+func (l *KeyedLimiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < cleanupInterval {
+		return
+	}
+
+	l.lastCleanup = now
+
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyedLimiter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	l := NewKeyedLimiter(1, 2)
+	l.now = func() time.Time { return now }
+
+	var tt = []struct {
+		key        string
+		advance    time.Duration
+		allowed    bool
+		retryAfter time.Duration
+	}{
+		{key: "10.0.0.1", allowed: true},
+		{key: "10.0.0.1", allowed: true},
+		{key: "10.0.0.1", allowed: false, retryAfter: time.Second},
+		{key: "10.0.0.2", allowed: true},
+		{key: "10.0.0.1", advance: 500 * time.Millisecond, allowed: false, retryAfter: 500 * time.Millisecond},
+		{key: "10.0.0.1", advance: 500 * time.Millisecond, allowed: true},
+	}
+
+	for _, tc := range tt {
+		now = now.Add(tc.advance)
+		allowed, retryAfter := l.Allow(tc.key)
+		require.Equal(t, tc.allowed, allowed)
+		require.Equal(t, tc.retryAfter, retryAfter)
+	}
+
+	var disabled *KeyedLimiter
+	allowed, _ := disabled.Allow("10.0.0.1")
+	require.True(t, allowed)
+}
+
+func TestFairQueue(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	q := NewFairQueue(1)
+
+	release, err := q.Acquire(ctx, "ci")
+	require.NoError(t, err)
+
+	// ci queues a burst before dev asks for a single slot
+	order := make(chan string, 4)
+	acquire := func(key string) {
+		r, err := q.Acquire(ctx, key)
+		require.NoError(t, err)
+		order <- key
+		r()
+	}
+
+	for range 3 {
+		go acquire("ci")
+		require.Eventually(t, func() bool { return q.Queued() > 0 }, time.Second, time.Millisecond)
+	}
+	require.Eventually(t, func() bool { return q.Queued() == 3 }, time.Second, time.Millisecond)
+
+	go acquire("dev")
+	require.Eventually(t, func() bool { return q.Queued() == 4 }, time.Second, time.Millisecond)
+
+	release()
+
+	got := make([]string, 0, 4)
+	for range 4 {
+		got = append(got, <-order)
+	}
+
+	// dev is served right after the first ci waiter instead of after the whole burst
+	require.Equal(t, []string{"ci", "dev", "ci", "ci"}, got)
+}
+
+func TestFairQueueCancel(t *testing.T) {
+	t.Parallel()
+
+	q := NewFairQueue(1)
+
+	release, err := q.Acquire(context.Background(), "ci")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = q.Acquire(ctx, "dev")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 0, q.Queued())
+
+	release()
+	release()
+
+	release, err = q.Acquire(context.Background(), "dev")
+	require.NoError(t, err)
+	release()
+}
+
+func TestHostLimiter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	l := NewHostLimiter(2, 1)
+	stats := func() HostLimiterStats { return l.Stats().(HostLimiterStats) }
+
+	releaseA, err := l.Acquire(ctx, "proxy.golang.org")
+	require.NoError(t, err)
+
+	// the host is busy
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	_, err = l.Acquire(timeoutCtx, "proxy.golang.org")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	releaseB, err := l.Acquire(ctx, "github.com")
+	require.NoError(t, err)
+
+	// both global slots are taken
+	acquired := make(chan func())
+	go func() {
+		release, err := l.Acquire(ctx, "gitlab.com")
+		require.NoError(t, err)
+		acquired <- release
+	}()
+
+	require.Eventually(t, func() bool { return stats().Queued == 1 }, time.Second, time.Millisecond)
+	require.Equal(t, HostStats{Active: 1}, stats().Hosts["github.com"])
+	require.Equal(t, int64(2), stats().Active)
+
+	releaseA()
+	releaseA()
+
+	releaseC := <-acquired
+	require.Equal(t, HostStats{Active: 1}, stats().Hosts["gitlab.com"])
+	require.Equal(t, int64(0), stats().Queued)
+
+	releaseB()
+	releaseC()
+	require.Equal(t, int64(0), stats().Active)
+
+	var disabled *HostLimiter
+	release, err := disabled.Acquire(ctx, "proxy.golang.org")
+	require.NoError(t, err)
+	release()
+	require.Nil(t, NewHostLimiter(0, 0))
+}
@@ -0,0 +1,374 @@
+package mirror
+
+import (
+	"astera"
+	"astera/constraint"
+	"astera/schedule"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	defaultInterval = 6 * time.Hour
+
+	// how often a sync waiting for the schedule checks it again
+	closedRetry = time.Minute
+
+	// how many stored modules a wildcard pattern expands to at most
+	maxPatternModules = 10000
+)
+
+// Rule selects the modules to mirror and which of their versions
+type Rule struct {
+	// Module is a module path or a glob in the GOPRIVATE syntax. A glob can't be listed upstream,
+	// it matches the modules already stored.
+	Module string `json:"module"`
+	// Include selects the versions, empty means all of them
+	Include constraint.Constraint `json:"include"`
+	// Exclude drops versions selected by Include
+	Exclude     constraint.Constraint `json:"exclude"`
+	Prereleases bool                  `json:"prereleases"`
+}
+
+func (r *Rule) match(version string) bool {
+	if !r.Prereleases && semver.Prerelease(version) != "" {
+		return false
+	}
+
+	return r.Include.Match(version) && (r.Exclude.IsEmpty() || !r.Exclude.Match(version))
+}
+
+type Config struct {
+	// Interval is how often the upstream version lists are checked, "6h" when empty
+	Interval string `json:"interval"`
+	Modules  []Rule `json:"modules"`
+}
+
+// LoadConfig reads the JSON mirror config
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+type Report struct {
+	Interval string                `json:"interval"`
+	Running  bool                  `json:"running"`
+	LastRun  time.Time             `json:"last_run,omitzero"`
+	NextRun  time.Time             `json:"next_run,omitzero"`
+	Modules  []astera.MirrorStatus `json:"modules"`
+}
+
+// Enqueuer queues the fetch of a module version, it reports if the job was added
+type Enqueuer func(job *astera.Job) (bool, error)
+
+// Mirror keeps the complete version history of the configured modules. Every interval it reads the
+// upstream version lists and queues a mirror job for each selected version not stored with its zip,
+// the job queue fetches them in the fetch windows. The private (GOPRIVATE) modules are never listed
+// upstream, they are not mirrored. A nil *Mirror does nothing.
+type Mirror struct {
+	rules      []Rule
+	interval   time.Duration
+	upstream   astera.RemoteProxy
+	repository astera.ModuleRepository
+	// statuses keeps the outcome of the syncs across restarts, nil keeps it in memory only
+	statuses  astera.MirrorStatusRepository
+	goPrivate string
+
+	mx      sync.Mutex
+	running bool
+	lastRun time.Time
+	nextRun time.Time
+	status  map[string]astera.MirrorStatus
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func New(config *Config, upstream astera.RemoteProxy, repository astera.ModuleRepository, statuses astera.MirrorStatusRepository,
+	goPrivate string) (*Mirror, error) {
+	interval := defaultInterval
+	if config.Interval != "" {
+		var err error
+		interval, err = time.ParseDuration(config.Interval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid mirror interval %q", config.Interval)
+		}
+	}
+
+	for _, rule := range config.Modules {
+		if rule.Module == "" {
+			return nil, errors.New("mirror rule without module")
+		}
+
+		if !hasGlob(rule.Module) {
+			if err := module.CheckPath(rule.Module); err != nil {
+				return nil, err
+			}
+
+			if module.MatchPrefixPatterns(goPrivate, rule.Module) {
+				return nil, fmt.Errorf("mirror rule %s is a private module (GOPRIVATE), only public modules are mirrored", rule.Module)
+			}
+		}
+	}
+
+	m := &Mirror{
+		rules:      config.Modules,
+		interval:   interval,
+		upstream:   upstream,
+		repository: repository,
+		statuses:   statuses,
+		goPrivate:  goPrivate,
+		status:     make(map[string]astera.MirrorStatus),
+	}
+
+	if statuses == nil {
+		return m, nil
+	}
+
+	// the last run is when the last module was synced before the restart
+	saved, err := statuses.MirrorStatuses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the mirror status: %w", err)
+	}
+
+	for _, status := range saved {
+		m.status[status.Module] = status
+		if status.SyncedAt.After(m.lastRun) {
+			m.lastRun = status.SyncedAt
+		}
+	}
+
+	return m, nil
+}
+
+// Start syncs right away and then every interval until Stop. Outside the windows of the schedule,
+// or with its budget spent, the sync waits for it to open, its list requests count against the budget.
+func (m *Mirror) Start(enqueue Enqueuer, s *schedule.Schedule) {
+	if m == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.done = make(chan struct{})
+
+	go func() {
+		defer close(m.done)
+
+		for {
+			wait := m.interval
+			if s.Open() {
+				reqInfo := &astera.RequestInfo{ID: "mirror-sync", Client: "mirror"}
+				m.Sync(astera.WithRequestInfo(ctx, reqInfo), enqueue)
+				s.Record(reqInfo.UpstreamBytes())
+			} else {
+				wait = closedRetry
+			}
+
+			m.mx.Lock()
+			m.nextRun = time.Now().Add(wait)
+			m.mx.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+func (m *Mirror) Stop() {
+	if m == nil || m.cancel == nil {
+		return
+	}
+
+	m.cancel()
+	<-m.done
+}
+
+// Sync checks every mirrored module once and queues its missing versions
+func (m *Mirror) Sync(ctx context.Context, enqueue Enqueuer) {
+	m.mx.Lock()
+	m.running = true
+	m.mx.Unlock()
+
+	defer func() {
+		m.mx.Lock()
+		m.running = false
+		m.lastRun = time.Now()
+		m.mx.Unlock()
+	}()
+
+	for i := range m.rules {
+		rule := &m.rules[i]
+
+		modules, err := m.expand(rule.Module)
+		if err != nil {
+			slog.Error("failed to expand mirror pattern", "pattern", rule.Module, "err", err)
+			continue
+		}
+
+		for _, modulePath := range modules {
+			if ctx.Err() != nil {
+				return
+			}
+
+			status := m.syncModule(ctx, rule, modulePath, enqueue)
+			if status.Error != "" {
+				slog.Warn("mirror sync failed", "module", modulePath, "err", status.Error)
+			} else if status.Queued > 0 {
+				slog.Info("queued mirror versions", "module", modulePath, "queued", status.Queued, "missing", status.Missing)
+			}
+
+			m.mx.Lock()
+			m.status[modulePath] = status
+			m.mx.Unlock()
+
+			if m.statuses == nil {
+				continue
+			}
+
+			if err := m.statuses.SaveMirrorStatus(status); err != nil {
+				slog.Error("failed to save the mirror status", "module", modulePath, "err", err)
+			}
+		}
+	}
+}
+
+// expand returns the module paths of the pattern, a glob matches the stored public modules
+func (m *Mirror) expand(pattern string) ([]string, error) {
+	if !hasGlob(pattern) {
+		return []string{pattern}, nil
+	}
+
+	// search by the literal part before the first wildcard, the match is checked afterwards
+	prefix := pattern[:strings.IndexAny(pattern, "*?[\\")]
+	prefix, err := module.EscapePath(strings.TrimSuffix(prefix, "/"))
+	if err != nil {
+		prefix = ""
+	}
+
+	names, err := m.repository.SearchModules(prefix, maxPatternModules)
+	if err != nil {
+		return nil, err
+	}
+
+	var modules []string
+	for _, name := range names {
+		modulePath, err := module.UnescapePath(name)
+		if err != nil {
+			continue
+		}
+
+		if module.MatchPrefixPatterns(pattern, modulePath) && !module.MatchPrefixPatterns(m.goPrivate, modulePath) {
+			modules = append(modules, modulePath)
+		}
+	}
+
+	return modules, nil
+}
+
+func (m *Mirror) syncModule(ctx context.Context, rule *Rule, modulePath string, enqueue Enqueuer) astera.MirrorStatus {
+	status := astera.MirrorStatus{Module: modulePath, Rule: rule.Module, SyncedAt: time.Now()}
+
+	fail := func(err error) astera.MirrorStatus {
+		status.Error = err.Error()
+		return status
+	}
+
+	name, err := module.EscapePath(modulePath)
+	if err != nil {
+		return fail(err)
+	}
+
+	list, err := m.upstream.FetchList(ctx, name)
+	if err != nil {
+		return fail(fmt.Errorf("fetching the version list: %w", err))
+	}
+
+	for _, version := range strings.Fields(string(list)) {
+		status.Upstream++
+
+		if !rule.match(version) {
+			continue
+		}
+
+		status.Matched++
+
+		escaped, err := module.EscapeVersion(version)
+		if err != nil {
+			continue
+		}
+
+		stored, err := m.repository.HasModuleZip(name, escaped)
+		if err != nil {
+			return fail(err)
+		}
+
+		if stored {
+			continue
+		}
+
+		status.Missing++
+
+		added, err := enqueue(&astera.Job{Name: name, Version: escaped, Kind: astera.JobKindMirror, NextAttempt: time.Now()})
+		if err != nil {
+			return fail(err)
+		}
+
+		if added {
+			status.Queued++
+		}
+	}
+
+	return status
+}
+
+func (m *Mirror) Report() Report {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	report := Report{
+		Interval: m.interval.String(),
+		Running:  m.running,
+		LastRun:  m.lastRun,
+		NextRun:  m.nextRun,
+		Modules:  make([]astera.MirrorStatus, 0, len(m.status)),
+	}
+
+	for _, status := range m.status {
+		report.Modules = append(report.Modules, status)
+	}
+
+	slices.SortFunc(report.Modules, func(a, b astera.MirrorStatus) int {
+		return strings.Compare(a.Module, b.Module)
+	})
+
+	return report
+}
+
+func hasGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[\\")
+}
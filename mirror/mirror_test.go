@@ -0,0 +1,160 @@
+package mirror
+
+import (
+	"astera"
+	"astera/mock"
+	"astera/schedule"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirror(t *testing.T) {
+	t.Parallel()
+
+	configPath := filepath.Join(t.TempDir(), "mirror.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(`{
+		"interval": "1h",
+		"modules": [
+			{"module": "github.com/Tmwalaszek/module1", "include": ">= v1.5.0", "exclude": "v1.6.3"},
+			{"module": "github.com/ourorg/*", "prereleases": true},
+			{"module": "github.com/tmwalaszek/missing"}
+		]
+	}`), 0o644))
+
+	config, err := LoadConfig(configPath)
+	require.NoError(t, err)
+
+	lists := map[string]string{
+		"github.com/!tmwalaszek/module1": "v1.4.0\nv1.5.0\nv1.6.0-rc.1\nv1.6.3\nv1.7.0\n",
+		"github.com/ourorg/module2":      "v0.1.0\nv0.2.0-beta.1\n",
+	}
+
+	upstream := &mock.RemoteProxy{
+		FetchListFn: func(ctx context.Context, module string) ([]byte, error) {
+			list, ok := lists[module]
+			if !ok {
+				return nil, astera.ErrModuleNotFound
+			}
+
+			return []byte(list), nil
+		},
+	}
+
+	repository := &mock.Repository{
+		SearchModulesFn: func(query string, limit int) ([]string, error) {
+			require.Equal(t, "github.com/ourorg", query)
+			return []string{"github.com/ourorg/module2", "github.com/ourorg-fork/module3", "github.com/ourorg/secret"}, nil
+		},
+		HasModuleZipFn: func(name, version string) (bool, error) {
+			return name == "github.com/!tmwalaszek/module1" && version == "v1.5.0", nil
+		},
+	}
+
+	saved := map[string]astera.MirrorStatus{}
+	statuses := &mock.MirrorStatusRepository{
+		SaveMirrorStatusFn: func(status astera.MirrorStatus) error {
+			saved[status.Module] = status
+			return nil
+		},
+		MirrorStatusesFn: func() ([]astera.MirrorStatus, error) {
+			var all []astera.MirrorStatus
+			for _, status := range saved {
+				all = append(all, status)
+			}
+
+			return all, nil
+		},
+	}
+
+	// the private modules are never listed upstream
+	m, err := New(config, upstream, repository, statuses, "github.com/ourorg/secret")
+	require.NoError(t, err)
+
+	queued := map[string]bool{}
+	enqueue := func(job *astera.Job) (bool, error) {
+		require.Equal(t, astera.JobKindMirror, job.Kind)
+
+		key := job.Name + "@" + job.Version
+		added := !queued[key]
+		queued[key] = true
+
+		return added, nil
+	}
+
+	m.Sync(context.Background(), enqueue)
+
+	require.Equal(t, map[string]bool{
+		"github.com/!tmwalaszek/module1@v1.7.0":   true,
+		"github.com/ourorg/module2@v0.1.0":        true,
+		"github.com/ourorg/module2@v0.2.0-beta.1": true,
+	}, queued)
+
+	report := m.Report()
+	require.Equal(t, "1h0m0s", report.Interval)
+	require.False(t, report.Running)
+	require.Len(t, report.Modules, 3)
+
+	module1 := report.Modules[0]
+	require.Equal(t, "github.com/Tmwalaszek/module1", module1.Module)
+	require.Equal(t, 5, module1.Upstream)
+	require.Equal(t, 2, module1.Matched)
+	require.Equal(t, 1, module1.Missing)
+	require.Equal(t, 1, module1.Queued)
+
+	require.Equal(t, "github.com/ourorg/module2", report.Modules[1].Module)
+	require.Equal(t, "github.com/ourorg/*", report.Modules[1].Rule)
+	require.Contains(t, report.Modules[2].Error, "module not found")
+
+	// queued versions are not queued again
+	m.Sync(context.Background(), enqueue)
+	require.Equal(t, 1, m.Report().Modules[0].Missing)
+	require.Equal(t, 0, m.Report().Modules[0].Queued)
+
+	// the outcome of the last sync survives a restart
+	require.Len(t, saved, 3)
+	restarted, err := New(config, upstream, repository, statuses, "github.com/ourorg/secret")
+	require.NoError(t, err)
+	require.Equal(t, m.Report().Modules, restarted.Report().Modules)
+	require.False(t, restarted.Report().LastRun.IsZero())
+
+	_, err = New(&Config{Interval: "soon"}, upstream, repository, nil, "")
+	require.Error(t, err)
+
+	_, err = New(&Config{Modules: []Rule{{Module: "not a path"}}}, upstream, repository, nil, "")
+	require.Error(t, err)
+
+	_, err = New(&Config{Modules: []Rule{{Module: "github.com/ourorg/secret"}}}, upstream, repository, nil, "github.com/ourorg/*")
+	require.ErrorContains(t, err, "private module")
+}
+
+func TestMirrorWaitsForSchedule(t *testing.T) {
+	t.Parallel()
+
+	// a window opening in a couple of hours
+	now := time.Now()
+	clock := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	s, err := schedule.New(schedule.Config{Windows: []schedule.Window{
+		{Start: (clock + 2*time.Hour) % (24 * time.Hour), End: (clock + 3*time.Hour) % (24 * time.Hour)},
+	}})
+	require.NoError(t, err)
+
+	upstream := &mock.RemoteProxy{
+		FetchListFn: func(ctx context.Context, module string) ([]byte, error) {
+			t.Errorf("listed %s outside the window", module)
+			return nil, astera.ErrModuleNotFound
+		},
+	}
+
+	m, err := New(&Config{Modules: []Rule{{Module: "github.com/tmwalaszek/module1"}}}, upstream, &mock.Repository{}, nil, "")
+	require.NoError(t, err)
+
+	m.Start(func(job *astera.Job) (bool, error) { return false, nil }, s)
+	m.Stop()
+
+	require.True(t, m.Report().LastRun.IsZero())
+}
@@ -0,0 +1,11 @@
+package mock
+
+import "astera"
+
+type ExportRepository struct {
+	WalkModulesFn func(prefixes []string, fn func(*astera.Module) error) error
+}
+
+func (r *ExportRepository) WalkModules(prefixes []string, fn func(*astera.Module) error) error {
+	return r.WalkModulesFn(prefixes, fn)
+}
@@ -0,0 +1,42 @@
+package mock
+
+import (
+	"astera"
+	"time"
+)
+
+type AccessRepository struct {
+	RecordAccessFn func(accesses []astera.Access) error
+}
+
+func (r *AccessRepository) RecordAccess(accesses []astera.Access) error {
+	return r.RecordAccessFn(accesses)
+}
+
+type GCRepository struct {
+	DatabaseSizeFn      func() (int64, error)
+	LeastRecentlyUsedFn func(withZip bool, accessedBefore time.Time, limit, offset int) ([]astera.ModuleVersion, error)
+	DropZipFn           func(name, version string) error
+	DeleteModuleFn      func(name, version string) error
+	IncrementalVacuumFn func() error
+}
+
+func (r *GCRepository) DatabaseSize() (int64, error) {
+	return r.DatabaseSizeFn()
+}
+
+func (r *GCRepository) LeastRecentlyUsed(withZip bool, accessedBefore time.Time, limit, offset int) ([]astera.ModuleVersion, error) {
+	return r.LeastRecentlyUsedFn(withZip, accessedBefore, limit, offset)
+}
+
+func (r *GCRepository) DropZip(name, version string) error {
+	return r.DropZipFn(name, version)
+}
+
+func (r *GCRepository) DeleteModule(name, version string) error {
+	return r.DeleteModuleFn(name, version)
+}
+
+func (r *GCRepository) IncrementalVacuum() error {
+	return r.IncrementalVacuumFn()
+}
@@ -1,16 +1,49 @@
 package mock
 
-import "context"
+import (
+	"astera"
+	"context"
+)
 
 type GoProxyCache struct {
-	ImportCachedModulesFn func(dir string) error
+	ImportCachedModulesFn func(ctx context.Context, dir string, options astera.ImportOptions) (*astera.ImportReport, error)
 	QueryFn               func(ctx context.Context, query string) ([]byte, error)
+	FetchModuleFn         func(ctx context.Context, module, version string, withZip bool) error
+	StartFn               func()
+	ShutdownFn            func(ctx context.Context) error
+	PurgeNegativeCacheFn  func(module string) (int64, error)
+	ListJobsFn            func(state string, limit int) ([]astera.Job, error)
+	CancelJobFn           func(id int64) error
 }
 
-func (c *GoProxyCache) ImportCachedModules(dir string) error {
-	return c.ImportCachedModulesFn(dir)
+func (c *GoProxyCache) ImportCachedModules(ctx context.Context, dir string, options astera.ImportOptions) (*astera.ImportReport, error) {
+	return c.ImportCachedModulesFn(ctx, dir, options)
 }
 
 func (c *GoProxyCache) Query(ctx context.Context, query string) ([]byte, error) {
 	return c.QueryFn(ctx, query)
 }
+
+func (c *GoProxyCache) FetchModule(ctx context.Context, module, version string, withZip bool) error {
+	return c.FetchModuleFn(ctx, module, version, withZip)
+}
+
+func (c *GoProxyCache) Start() {
+	c.StartFn()
+}
+
+func (c *GoProxyCache) Shutdown(ctx context.Context) error {
+	return c.ShutdownFn(ctx)
+}
+
+func (c *GoProxyCache) PurgeNegativeCache(module string) (int64, error) {
+	return c.PurgeNegativeCacheFn(module)
+}
+
+func (c *GoProxyCache) ListJobs(state string, limit int) ([]astera.Job, error) {
+	return c.ListJobsFn(state, limit)
+}
+
+func (c *GoProxyCache) CancelJob(id int64) error {
+	return c.CancelJobFn(id)
+}
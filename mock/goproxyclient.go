@@ -1 +1,34 @@
 package mock
+
+import (
+	"astera"
+	"context"
+)
+
+type RemoteProxy struct {
+	FetchCatalogFn    func(ctx context.Context, token string, pageSize int) ([]astera.CatalogEntry, string, error)
+	FetchListFn       func(ctx context.Context, module string) ([]byte, error)
+	FetchModuleInfoFn func(ctx context.Context, module, version string) ([]byte, error)
+	FetchModuleModFn  func(ctx context.Context, module, version string) ([]byte, error)
+	FetchModuleZipFn  func(ctx context.Context, module, version string) ([]byte, error)
+}
+
+func (p *RemoteProxy) FetchCatalog(ctx context.Context, token string, pageSize int) ([]astera.CatalogEntry, string, error) {
+	return p.FetchCatalogFn(ctx, token, pageSize)
+}
+
+func (p *RemoteProxy) FetchList(ctx context.Context, module string) ([]byte, error) {
+	return p.FetchListFn(ctx, module)
+}
+
+func (p *RemoteProxy) FetchModuleInfo(ctx context.Context, module, version string) ([]byte, error) {
+	return p.FetchModuleInfoFn(ctx, module, version)
+}
+
+func (p *RemoteProxy) FetchModuleMod(ctx context.Context, module, version string) ([]byte, error) {
+	return p.FetchModuleModFn(ctx, module, version)
+}
+
+func (p *RemoteProxy) FetchModuleZip(ctx context.Context, module, version string) ([]byte, error) {
+	return p.FetchModuleZipFn(ctx, module, version)
+}
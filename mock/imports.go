@@ -0,0 +1,26 @@
+package mock
+
+import "astera"
+
+type ImportRepository struct {
+	InsertImportBatchFn func(dir string, modules []*astera.Module) ([]error, error)
+	ImportedVersionsFn  func(dir string) (map[string]bool, error)
+	ResetImportFn       func(dir string) error
+	HasModuleZipFn      func(name, version string) (bool, error)
+}
+
+func (r *ImportRepository) InsertImportBatch(dir string, modules []*astera.Module) ([]error, error) {
+	return r.InsertImportBatchFn(dir, modules)
+}
+
+func (r *ImportRepository) ImportedVersions(dir string) (map[string]bool, error) {
+	return r.ImportedVersionsFn(dir)
+}
+
+func (r *ImportRepository) ResetImport(dir string) error {
+	return r.ResetImportFn(dir)
+}
+
+func (r *ImportRepository) HasModuleZip(name, version string) (bool, error) {
+	return r.HasModuleZipFn(name, version)
+}
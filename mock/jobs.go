@@ -0,0 +1,49 @@
+package mock
+
+import (
+	"astera"
+	"time"
+)
+
+type JobRepository struct {
+	EnqueueJobFn       func(job *astera.Job) (bool, error)
+	ClaimJobFn         func(now time.Time, skipKinds []string) (*astera.Job, error)
+	FinishJobFn        func(name, version string) error
+	RetryJobFn         func(id int64, attempts int, nextAttempt time.Time, lastErr string) error
+	FailJobFn          func(id int64, attempts int, lastErr string) error
+	ListJobsFn         func(state string, limit int) ([]astera.Job, error)
+	DeleteJobFn        func(id int64) (bool, error)
+	ResetRunningJobsFn func() (int64, error)
+}
+
+func (j *JobRepository) EnqueueJob(job *astera.Job) (bool, error) {
+	return j.EnqueueJobFn(job)
+}
+
+func (j *JobRepository) ClaimJob(now time.Time, skipKinds []string) (*astera.Job, error) {
+	return j.ClaimJobFn(now, skipKinds)
+}
+
+func (j *JobRepository) FinishJob(name, version string) error {
+	return j.FinishJobFn(name, version)
+}
+
+func (j *JobRepository) RetryJob(id int64, attempts int, nextAttempt time.Time, lastErr string) error {
+	return j.RetryJobFn(id, attempts, nextAttempt, lastErr)
+}
+
+func (j *JobRepository) FailJob(id int64, attempts int, lastErr string) error {
+	return j.FailJobFn(id, attempts, lastErr)
+}
+
+func (j *JobRepository) ListJobs(state string, limit int) ([]astera.Job, error) {
+	return j.ListJobsFn(state, limit)
+}
+
+func (j *JobRepository) DeleteJob(id int64) (bool, error) {
+	return j.DeleteJobFn(id)
+}
+
+func (j *JobRepository) ResetRunningJobs() (int64, error) {
+	return j.ResetRunningJobsFn()
+}
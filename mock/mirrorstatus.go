@@ -0,0 +1,16 @@
+package mock
+
+import "astera"
+
+type MirrorStatusRepository struct {
+	SaveMirrorStatusFn func(status astera.MirrorStatus) error
+	MirrorStatusesFn   func() ([]astera.MirrorStatus, error)
+}
+
+func (r *MirrorStatusRepository) SaveMirrorStatus(status astera.MirrorStatus) error {
+	return r.SaveMirrorStatusFn(status)
+}
+
+func (r *MirrorStatusRepository) MirrorStatuses() ([]astera.MirrorStatus, error) {
+	return r.MirrorStatusesFn()
+}
@@ -0,0 +1,21 @@
+package mock
+
+import "astera"
+
+type NegativeCache struct {
+	InsertNegativeFn func(name, resource string, entry astera.NegativeEntry) error
+	GetNegativeFn    func(name, resource string) (*astera.NegativeEntry, error)
+	PurgeNegativeFn  func(name string) (int64, error)
+}
+
+func (n *NegativeCache) InsertNegative(name, resource string, entry astera.NegativeEntry) error {
+	return n.InsertNegativeFn(name, resource, entry)
+}
+
+func (n *NegativeCache) GetNegative(name, resource string) (*astera.NegativeEntry, error) {
+	return n.GetNegativeFn(name, resource)
+}
+
+func (n *NegativeCache) PurgeNegative(name string) (int64, error) {
+	return n.PurgeNegativeFn(name)
+}
@@ -0,0 +1,31 @@
+package mock
+
+import "astera"
+
+type QuarantineRepository struct {
+	QuarantineFn      func(q *astera.Quarantine) error
+	ReleaseFn         func(name, version, by, reason string) (bool, error)
+	QuarantinedFn     func(name string) ([]astera.Quarantine, error)
+	ListQuarantinesFn func() ([]astera.Quarantine, error)
+	QuarantineAuditFn func(name string, limit int) ([]astera.QuarantineEvent, error)
+}
+
+func (r *QuarantineRepository) Quarantine(q *astera.Quarantine) error {
+	return r.QuarantineFn(q)
+}
+
+func (r *QuarantineRepository) Release(name, version, by, reason string) (bool, error) {
+	return r.ReleaseFn(name, version, by, reason)
+}
+
+func (r *QuarantineRepository) Quarantined(name string) ([]astera.Quarantine, error) {
+	return r.QuarantinedFn(name)
+}
+
+func (r *QuarantineRepository) ListQuarantines() ([]astera.Quarantine, error) {
+	return r.ListQuarantinesFn()
+}
+
+func (r *QuarantineRepository) QuarantineAudit(name string, limit int) ([]astera.QuarantineEvent, error) {
+	return r.QuarantineAuditFn(name, limit)
+}
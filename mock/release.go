@@ -0,0 +1,16 @@
+package mock
+
+import "time"
+
+type ReleaseRepository struct {
+	ReleaseTimesFn func(name string) (map[string]time.Time, error)
+	ReleaseTimeFn  func(name, version string) (time.Time, error)
+}
+
+func (r *ReleaseRepository) ReleaseTimes(name string) (map[string]time.Time, error) {
+	return r.ReleaseTimesFn(name)
+}
+
+func (r *ReleaseRepository) ReleaseTime(name, version string) (time.Time, error) {
+	return r.ReleaseTimeFn(name, version)
+}
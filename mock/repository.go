@@ -11,6 +11,10 @@ type Repository struct {
 	GetModuleZipFn   func(name, version string) ([]byte, error)
 
 	ModuleExistsFn func(name string, version string) (bool, error)
+	HasModuleZipFn func(name string, version string) (bool, error)
+
+	SearchModulesFn     func(query string, limit int) ([]string, error)
+	GetModuleVersionsFn func(name string) ([]astera.ModuleVersion, error)
 }
 
 func (r *Repository) InsertModule(module *astera.Module) error {
@@ -36,3 +40,23 @@ func (r *Repository) GetModuleZip(name, version string) ([]byte, error) {
 func (r *Repository) ModuleExists(name string, version string) (bool, error) {
 	return r.ModuleExistsFn(name, version)
 }
+
+func (r *Repository) HasModuleZip(name string, version string) (bool, error) {
+	return r.HasModuleZipFn(name, version)
+}
+
+func (r *Repository) SearchModules(query string, limit int) ([]string, error) {
+	return r.SearchModulesFn(query, limit)
+}
+
+func (r *Repository) GetModuleVersions(name string) ([]astera.ModuleVersion, error) {
+	return r.GetModuleVersionsFn(name)
+}
+
+type CatalogRepository struct {
+	CatalogFn func(afterName, afterVersion string, limit int) ([]astera.ModuleVersion, error)
+}
+
+func (r *CatalogRepository) Catalog(afterName, afterVersion string, limit int) ([]astera.ModuleVersion, error) {
+	return r.CatalogFn(afterName, afterVersion, limit)
+}
@@ -1,16 +1,19 @@
 package mock
 
-import "astera"
+import (
+	"astera"
+	"context"
+)
 
 type VCS struct {
-	CloneFn     func(repo string, tag string) (*astera.Module, error)
-	FetchTagsFn func(repo string) ([]string, error)
+	CloneFn     func(ctx context.Context, repo string, tag string) (*astera.Module, error)
+	FetchTagsFn func(ctx context.Context, repo string) ([]string, error)
 }
 
-func (v *VCS) Clone(repo string, tag string) (*astera.Module, error) {
-	return v.CloneFn(repo, tag)
+func (v *VCS) Clone(ctx context.Context, repo string, tag string) (*astera.Module, error) {
+	return v.CloneFn(ctx, repo, tag)
 }
 
-func (v *VCS) FetchTags(repo string) ([]string, error) {
-	return v.FetchTagsFn(repo)
+func (v *VCS) FetchTags(ctx context.Context, repo string) ([]string, error) {
+	return v.FetchTagsFn(ctx, repo)
 }
@@ -0,0 +1,16 @@
+package mock
+
+import "astera"
+
+type WindowUsageRepository struct {
+	AddWindowUsageFn func(usage astera.WindowUsage) error
+	WindowUsagesFn   func(limit int) ([]astera.WindowUsage, error)
+}
+
+func (r *WindowUsageRepository) AddWindowUsage(usage astera.WindowUsage) error {
+	return r.AddWindowUsageFn(usage)
+}
+
+func (r *WindowUsageRepository) WindowUsages(limit int) ([]astera.WindowUsage, error) {
+	return r.WindowUsagesFn(limit)
+}
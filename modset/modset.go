@@ -0,0 +1,338 @@
+package modset
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// Module is a module version of the set, paths and versions are not escaped
+type Module struct {
+	Mod module.Version
+	// ModOnly is set when only the go.mod of the version is needed, go.sum lists it without its zip
+	ModOnly bool
+}
+
+// Set is the module versions a build of the main modules needs
+type Set struct {
+	// Main are the paths of the main modules, they are local and never fetched
+	Main []string
+	// Roots are the requirements of the main modules, the start of the build list
+	Roots []module.Version
+
+	// replace of the main go.mod or go.work, a replacement with an empty version is a local directory
+	replace map[module.Version]module.Version
+
+	modules map[module.Version]bool
+}
+
+func newSet() *Set {
+	return &Set{
+		replace: make(map[module.Version]module.Version),
+		modules: make(map[module.Version]bool),
+	}
+}
+
+// Load reads the module set from a go.mod, go.sum or go.work file. A directory is loaded from its
+// go.work, or its go.mod and go.sum when there is no go.work.
+func Load(path string) (*Set, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newSet()
+
+	if fi.IsDir() {
+		if _, err := os.Stat(filepath.Join(path, "go.work")); err == nil {
+			return s, s.loadWork(filepath.Join(path, "go.work"))
+		}
+
+		return s, s.loadModuleDir(path)
+	}
+
+	switch name := filepath.Base(path); {
+	case name == "go.work":
+		err = s.loadWork(path)
+	case name == "go.sum" || name == "go.work.sum":
+		err = s.loadSum(path)
+	default:
+		err = s.loadMod(path)
+	}
+
+	return s, err
+}
+
+// Modules returns the versions of the set sorted by path and version, with the replacements applied.
+// Versions replaced by a local directory are left out.
+func (s *Set) Modules() []Module {
+	byVersion := make(map[module.Version]bool, len(s.modules))
+	for v, modOnly := range s.modules {
+		target, ok := s.Resolve(v)
+		if !ok {
+			continue
+		}
+
+		if prev, seen := byVersion[target]; seen {
+			modOnly = modOnly && prev
+		}
+
+		byVersion[target] = modOnly
+	}
+
+	modules := make([]Module, 0, len(byVersion))
+	for v, modOnly := range byVersion {
+		modules = append(modules, Module{Mod: v, ModOnly: modOnly})
+	}
+
+	slices.SortFunc(modules, func(a, b Module) int {
+		return compareVersions(a.Mod, b.Mod)
+	})
+
+	return modules
+}
+
+// Resolve returns the module version that is fetched in place of v, false when it is replaced by
+// a local directory or is a main module
+func (s *Set) Resolve(v module.Version) (module.Version, bool) {
+	if slices.Contains(s.Main, v.Path) {
+		return module.Version{}, false
+	}
+
+	target, ok := s.replace[v]
+	if !ok {
+		target, ok = s.replace[module.Version{Path: v.Path}]
+	}
+
+	if !ok {
+		return v, true
+	}
+
+	return target, target.Version != ""
+}
+
+// add records the version, a version needed whole is never downgraded to ModOnly
+func (s *Set) add(v module.Version, modOnly bool) {
+	if prev, ok := s.modules[v]; ok {
+		modOnly = modOnly && prev
+	}
+
+	s.modules[v] = modOnly
+}
+
+func (s *Set) loadModuleDir(dir string) error {
+	err := s.loadMod(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return err
+	}
+
+	err = s.loadSum(filepath.Join(dir, "go.sum"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *Set) loadMod(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := modfile.Parse(path, data, nil)
+	if err != nil {
+		return err
+	}
+
+	if f.Module != nil {
+		s.Main = append(s.Main, f.Module.Mod.Path)
+	}
+
+	for _, r := range f.Require {
+		s.Roots = append(s.Roots, r.Mod)
+		s.add(r.Mod, false)
+	}
+
+	for _, r := range f.Replace {
+		s.replace[r.Old] = r.New
+	}
+
+	return nil
+}
+
+func (s *Set) loadWork(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := modfile.ParseWork(path, data, nil)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	for _, u := range f.Use {
+		err = s.loadModuleDir(filepath.Join(dir, u.Path))
+		if err != nil {
+			return err
+		}
+	}
+
+	// the replacements of go.work override the ones of the modules
+	for _, r := range f.Replace {
+		s.replace[r.Old] = r.New
+	}
+
+	err = s.loadSum(filepath.Join(dir, "go.work.sum"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// loadSum reads the go.sum lines "<path> <version>[/go.mod] <hash>"
+func (s *Set) loadSum(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 3 {
+			return fmt.Errorf("%s:%d: malformed line", path, line)
+		}
+
+		version, modOnly := strings.CutSuffix(fields[1], "/go.mod")
+		v := module.Version{Path: fields[0], Version: version}
+		if err := module.Check(v.Path, v.Version); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+
+		s.add(v, modOnly)
+	}
+
+	return scanner.Err()
+}
+
+// ModFetcher returns the go.mod of the module version
+type ModFetcher func(ctx context.Context, v module.Version) ([]byte, error)
+
+// BuildList computes the build list of the set with minimal version selection: the highest version
+// of every module reachable from the roots. The go.mod files are read with workers fetches at once.
+// The versions whose go.mod couldn't be fetched are reported in the error, the list is computed
+// without their requirements.
+func BuildList(ctx context.Context, s *Set, workers int, fetchMod ModFetcher) ([]module.Version, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	selected := make(map[string]string)
+	visited := make(map[module.Version]bool)
+	var errs []error
+
+	level := slices.Clone(s.Roots)
+	for len(level) > 0 {
+		var next []module.Version
+		var mx sync.Mutex
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, workers)
+
+		for _, v := range level {
+			if visited[v] || slices.Contains(s.Main, v.Path) {
+				continue
+			}
+
+			visited[v] = true
+			if semver.Compare(v.Version, selected[v.Path]) > 0 {
+				selected[v.Path] = v.Version
+			}
+
+			target, ok := s.Resolve(v)
+			if !ok {
+				continue
+			}
+
+			sem <- struct{}{}
+			wg.Go(func() {
+				defer func() { <-sem }()
+
+				requirements, err := readRequirements(ctx, target, fetchMod)
+
+				mx.Lock()
+				defer mx.Unlock()
+
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s@%s: %w", target.Path, target.Version, err))
+					return
+				}
+
+				next = append(next, requirements...)
+			})
+		}
+
+		wg.Wait()
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		level = next
+	}
+
+	list := make([]module.Version, 0, len(selected))
+	for path, version := range selected {
+		list = append(list, module.Version{Path: path, Version: version})
+	}
+
+	slices.SortFunc(list, compareVersions)
+
+	return list, errors.Join(errs...)
+}
+
+func readRequirements(ctx context.Context, v module.Version, fetchMod ModFetcher) ([]module.Version, error) {
+	data, err := fetchMod(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+
+	// the replace and exclude directives of dependencies don't apply, ParseLax ignores them
+	f, err := modfile.ParseLax(v.Path+"@"+v.Version+"/go.mod", data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	requirements := make([]module.Version, 0, len(f.Require))
+	for _, r := range f.Require {
+		requirements = append(requirements, r.Mod)
+	}
+
+	return requirements, nil
+}
+
+func compareVersions(a, b module.Version) int {
+	if c := strings.Compare(a.Path, b.Path); c != 0 {
+		return c
+	}
+
+	return semver.Compare(a.Version, b.Version)
+}
@@ -0,0 +1,162 @@
+package modset
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{
+		"app/go.mod": `module example.com/app
+
+go 1.24
+
+require (
+	example.com/lib v0.1.0
+	github.com/Masterminds/semver/v3 v3.3.1
+	golang.org/x/mod v0.27.0
+)
+
+replace golang.org/x/mod => golang.org/x/mod v0.28.0
+
+replace example.com/lib => ../lib
+`,
+		"app/go.sum": `github.com/Masterminds/semver/v3 v3.3.1 h1:abc=
+github.com/Masterminds/semver/v3 v3.3.1/go.mod h1:abc=
+github.com/davecgh/go-spew v1.1.1/go.mod h1:abc=
+`,
+		"lib/go.mod": `module example.com/lib
+
+go 1.24
+
+require github.com/stretchr/testify v1.10.0
+`,
+		"go.work": `go 1.24
+
+use (
+	./app
+	./lib
+)
+`,
+	})
+
+	var tt = []struct {
+		name    string
+		path    string
+		modules []Module
+		err     bool
+	}{
+		{
+			name: "go.sum",
+			path: "app/go.sum",
+			modules: []Module{
+				{Mod: module.Version{Path: "github.com/Masterminds/semver/v3", Version: "v3.3.1"}},
+				{Mod: module.Version{Path: "github.com/davecgh/go-spew", Version: "v1.1.1"}, ModOnly: true},
+			},
+		},
+		{
+			name: "go.mod",
+			path: "app/go.mod",
+			modules: []Module{
+				{Mod: module.Version{Path: "github.com/Masterminds/semver/v3", Version: "v3.3.1"}},
+				{Mod: module.Version{Path: "golang.org/x/mod", Version: "v0.28.0"}},
+			},
+		},
+		{
+			name: "module directory",
+			path: "app",
+			modules: []Module{
+				{Mod: module.Version{Path: "github.com/Masterminds/semver/v3", Version: "v3.3.1"}},
+				{Mod: module.Version{Path: "github.com/davecgh/go-spew", Version: "v1.1.1"}, ModOnly: true},
+				{Mod: module.Version{Path: "golang.org/x/mod", Version: "v0.28.0"}},
+			},
+		},
+		{
+			name: "workspace",
+			path: ".",
+			modules: []Module{
+				{Mod: module.Version{Path: "github.com/Masterminds/semver/v3", Version: "v3.3.1"}},
+				{Mod: module.Version{Path: "github.com/davecgh/go-spew", Version: "v1.1.1"}, ModOnly: true},
+				{Mod: module.Version{Path: "github.com/stretchr/testify", Version: "v1.10.0"}},
+				{Mod: module.Version{Path: "golang.org/x/mod", Version: "v0.28.0"}},
+			},
+		},
+		{
+			name: "missing",
+			path: "missing/go.sum",
+			err:  true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := Load(filepath.Join(dir, tc.path))
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.modules, s.Modules())
+		})
+	}
+}
+
+func TestBuildList(t *testing.T) {
+	t.Parallel()
+
+	mods := map[module.Version]string{
+		{Path: "example.com/a", Version: "v1.0.0"}: "module example.com/a\nrequire example.com/c v1.1.0\n",
+		{Path: "example.com/b", Version: "v1.2.0"}: "module example.com/b\nrequire (\n\texample.com/c v1.3.0\n\texample.com/d v1.0.0\n)\n",
+		{Path: "example.com/c", Version: "v1.1.0"}: "module example.com/c\nrequire example.com/e v1.0.0\n",
+		{Path: "example.com/c", Version: "v1.3.0"}: "module example.com/c\n",
+		{Path: "example.com/e", Version: "v1.0.0"}: "module example.com/e\n",
+	}
+
+	s := newSet()
+	s.Main = []string{"example.com/app"}
+	s.Roots = []module.Version{
+		{Path: "example.com/a", Version: "v1.0.0"},
+		{Path: "example.com/b", Version: "v1.2.0"},
+	}
+
+	list, err := BuildList(context.Background(), s, 2, func(ctx context.Context, v module.Version) ([]byte, error) {
+		mod, ok := mods[v]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+
+		return []byte(mod), nil
+	})
+
+	// d has no go.mod, it is still selected
+	require.ErrorContains(t, err, "example.com/d@v1.0.0: not found")
+	require.Equal(t, []module.Version{
+		{Path: "example.com/a", Version: "v1.0.0"},
+		{Path: "example.com/b", Version: "v1.2.0"},
+		{Path: "example.com/c", Version: "v1.3.0"},
+		{Path: "example.com/d", Version: "v1.0.0"},
+		{Path: "example.com/e", Version: "v1.0.0"},
+	}, list)
+}
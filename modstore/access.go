@@ -0,0 +1,129 @@
+package modstore
+
+import (
+	"astera"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const defaultAccessFlushInterval = time.Minute
+
+// accessTracker counts the served versions in memory and writes them in a single transaction every
+// flush interval, so the hot read path never writes to the database. A nil *accessTracker records nothing.
+type accessTracker struct {
+	repository astera.AccessRepository
+	interval   time.Duration
+
+	mx      sync.Mutex
+	pending map[string]*astera.Access
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newAccessTracker(repository astera.AccessRepository, interval time.Duration) *accessTracker {
+	if repository == nil {
+		return nil
+	}
+
+	if interval <= 0 {
+		interval = defaultAccessFlushInterval
+	}
+
+	t := &accessTracker{
+		repository: repository,
+		interval:   interval,
+		pending:    make(map[string]*astera.Access),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	go t.run()
+
+	return t
+}
+
+func (t *accessTracker) record(module, version string) {
+	if t == nil {
+		return
+	}
+
+	key := module + "@" + version
+
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	a, ok := t.pending[key]
+	if !ok {
+		a = &astera.Access{Name: module, Version: version}
+		t.pending[key] = a
+	}
+
+	a.Hits++
+	a.At = time.Now()
+}
+
+func (t *accessTracker) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			t.flush()
+			return
+		case <-ticker.C:
+			t.flush()
+		}
+	}
+}
+
+// flush writes the pending accesses, on failure they are merged into the next flush
+func (t *accessTracker) flush() {
+	t.mx.Lock()
+	pending := t.pending
+	t.pending = make(map[string]*astera.Access)
+	t.mx.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	accesses := make([]astera.Access, 0, len(pending))
+	for _, a := range pending {
+		accesses = append(accesses, *a)
+	}
+
+	err := t.repository.RecordAccess(accesses)
+	if err == nil {
+		return
+	}
+
+	slog.Error("failed to record module accesses", "versions", len(accesses), "err", err)
+
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	for key, a := range pending {
+		if newer, ok := t.pending[key]; ok {
+			newer.Hits += a.Hits
+			continue
+		}
+
+		t.pending[key] = a
+	}
+}
+
+// close writes the pending accesses and stops the flushes
+func (t *accessTracker) close() {
+	if t == nil {
+		return
+	}
+
+	t.stopOnce.Do(func() { close(t.stop) })
+	<-t.done
+}
@@ -0,0 +1,96 @@
+package modstore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// flight is a single fetch of a module version shared by all the requests waiting for it
+type flight struct {
+	done    chan struct{}
+	err     error
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// flightGroup runs every fetch once in its own goroutine, detached from the request that
+// started it. The fetch has its own timeout and is cancelled when the last waiter gives up,
+// unless background is set and it completes anyway to have the module stored for next time.
+// A nil *flightGroup runs the fetch in the caller's goroutine and context.
+type flightGroup struct {
+	timeout    time.Duration
+	background bool
+
+	mx      sync.Mutex
+	flights map[string]*flight
+}
+
+func newFlightGroup(timeout time.Duration, background bool) *flightGroup {
+	return &flightGroup{
+		timeout:    timeout,
+		background: background,
+		flights:    make(map[string]*flight),
+	}
+}
+
+// do joins the fetch of key or starts it with fn. The context passed to fn keeps the values of
+// ctx (request info, client ID) but not its cancellation.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) error) error {
+	if g == nil {
+		return fn(ctx)
+	}
+
+	g.mx.Lock()
+	f, ok := g.flights[key]
+	if !ok {
+		fctx := context.WithoutCancel(ctx)
+
+		var cancel context.CancelFunc
+		if g.timeout > 0 {
+			fctx, cancel = context.WithTimeout(fctx, g.timeout)
+		} else {
+			fctx, cancel = context.WithCancel(fctx)
+		}
+
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.flights[key] = f
+
+		go func() {
+			f.err = fn(fctx)
+			cancel()
+
+			g.mx.Lock()
+			g.forget(key, f)
+			g.mx.Unlock()
+
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mx.Unlock()
+
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+	}
+
+	g.mx.Lock()
+	f.waiters--
+	if f.waiters == 0 && !g.background {
+		f.cancel()
+		// the next request starts a new fetch instead of joining the cancelled one
+		g.forget(key, f)
+	}
+	g.mx.Unlock()
+
+	return ctx.Err()
+}
+
+// forget removes the flight unless it was already replaced by a new one, g.mx must be held
+func (g *flightGroup) forget(key string, f *flight) {
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+}
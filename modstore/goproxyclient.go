@@ -2,43 +2,147 @@ package modstore
 
 import (
 	"astera"
+	"astera/breaker"
+	"astera/limiter"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
 	proxyGolangURL = "https://proxy.golang.org"
+
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+
+	// a download that keeps making progress is resumed at most this many times
+	maxResumes = 100
+
+	probeTimeout = 10 * time.Second
 )
 
+var errIdleTimeout = errors.New("no data received within the idle timeout")
+
+type GoProxyClientConfig struct {
+	// URL is the GOPROXY to fetch from, empty means proxy.golang.org
+	URL string
+	// Retries is how many times a transient failure (network error, 5xx, 429, idle timeout) is retried
+	Retries int
+	// IdleTimeout aborts a transfer that received no data for this long, zero means no limit.
+	// There is no limit on the total time so slow but healthy downloads can finish.
+	IdleTimeout time.Duration
+	// SpillDir holds the partial zip downloads, empty means the default temp directory
+	SpillDir string
+	// Breakers fail the requests fast while an upstream keeps failing, nil disables them
+	Breakers *breaker.Set
+	// Limiter bounds the concurrent requests in total and per upstream host, nil means no limit
+	Limiter *limiter.HostLimiter
+}
+
 type GoProxyClient struct {
 	client *http.Client
+	// url is the GOPROXY, empty means proxy.golang.org
+	url string
+
+	retries     int
+	idleTimeout time.Duration
+	spillDir    string
+	breakers    *breaker.Set
+	limiter     *limiter.HostLimiter
+}
+
+// statusError is an unexpected upstream status code
+type statusError struct {
+	code       int
+	retryAfter time.Duration
 }
 
-func NewGoProxyClient() *GoProxyClient {
+func (e *statusError) Error() string {
+	return fmt.Sprintf("request failed with status code %d", e.code)
+}
+
+func NewGoProxyClient(config GoProxyClientConfig) *GoProxyClient {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
 	c := &http.Client{
 		Transport: &http.Transport{
-			MaxIdleConns:        10,
-			MaxIdleConnsPerHost: 10,
-			IdleConnTimeout:     30 * time.Second,
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			MaxIdleConns:          10,
+			MaxIdleConnsPerHost:   10,
+			IdleConnTimeout:       30 * time.Second,
 		},
-		Timeout: 1 * time.Minute,
 	}
 
 	return &GoProxyClient{
-		client: c,
+		client:      c,
+		url:         strings.TrimSuffix(config.URL, "/"),
+		retries:     config.Retries,
+		idleTimeout: config.IdleTimeout,
+		spillDir:    config.SpillDir,
+		breakers:    config.Breakers,
+		limiter:     config.Limiter,
+	}
+}
+
+func (c *GoProxyClient) baseURL() string {
+	if c.url == "" {
+		return proxyGolangURL
 	}
+
+	return c.url
 }
 
 func (c *GoProxyClient) fetch(ctx context.Context, url string) ([]byte, error) {
+	var body []byte
+
+	err := c.guarded(ctx, url, func() error {
+		return c.retry(ctx, url, func() (bool, error) {
+			var err error
+			body, err = c.get(ctx, url)
+
+			return false, err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+func (c *GoProxyClient) get(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	release, err := c.limiter.Acquire(ctx, req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
@@ -46,22 +150,328 @@ func (c *GoProxyClient) fetch(ctx context.Context, url string) ([]byte, error) {
 
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
-		return nil, astera.ErrModuleNotFound
-	} else if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("request failed with status code %d", resp.StatusCode)
+	err = checkStatus(resp, http.StatusOK)
+	if err != nil {
+		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(c.idleReader(ctx, cancel, resp.Body))
+	astera.RequestInfoFromContext(ctx).AddUpstreamBytes(int64(len(body)))
 	if err != nil {
-		return nil, err
+		return nil, readError(ctx, err)
 	}
 
 	return body, nil
 }
 
+// fetchResumable downloads into a spill file and resumes with a Range request after
+// a broken transfer, so a large zip failing at 95% doesn't start from scratch
+func (c *GoProxyClient) fetchResumable(ctx context.Context, url string) ([]byte, error) {
+	spill, err := os.CreateTemp(c.spillDir, "download-*")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(spill.Name())
+	defer spill.Close()
+
+	resumes := 0
+	err = c.guarded(ctx, url, func() error {
+		return c.retry(ctx, url, func() (bool, error) {
+			written, err := c.getRange(ctx, url, spill)
+			if err != nil && written > 0 && resumes < maxResumes {
+				resumes++
+				slog.Warn("download interrupted, resuming", "url", url, "received", written, "err", err)
+
+				// progress was made, it doesn't count as a failed attempt
+				return true, err
+			}
+
+			return false, err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = spill.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(spill)
+}
+
+// getRange continues the download from the current end of the spill file and returns
+// how many bytes this attempt wrote
+func (c *GoProxyClient) getRange(ctx context.Context, url string, spill *os.File) (int64, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	offset, err := spill.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	release, err := c.limiter.Acquire(ctx, req.URL.Host)
+	if err != nil {
+		return 0, err
+	}
+
+	defer release()
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	err = checkStatus(resp, http.StatusOK, http.StatusPartialContent)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode == http.StatusPartialContent && !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+		// not the part we asked for, drop what we have and start over on the next attempt
+		return 0, errors.Join(fmt.Errorf("unexpected Content-Range %q", resp.Header.Get("Content-Range")), spill.Truncate(0))
+	}
+
+	if resp.StatusCode == http.StatusOK && offset > 0 {
+		// the server ignored the Range header, start over
+		err = spill.Truncate(0)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = spill.Seek(0, io.SeekStart)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	written, err := io.Copy(spill, c.idleReader(ctx, cancel, resp.Body))
+	astera.RequestInfoFromContext(ctx).AddUpstreamBytes(written)
+	if err != nil {
+		return written, readError(ctx, err)
+	}
+
+	if resp.ContentLength > 0 && written != resp.ContentLength {
+		return written, fmt.Errorf("short body, got %d of %d bytes: %w", written, resp.ContentLength, io.ErrUnexpectedEOF)
+	}
+
+	return written, nil
+}
+
+// guarded runs fn unless the circuit of the upstream is open and reports the outcome to its breaker.
+// Any answer from the upstream, 404 included, means it is healthy.
+func (c *GoProxyClient) guarded(ctx context.Context, rawURL string, fn func() error) error {
+	var b *breaker.Breaker
+	if u, err := url.Parse(rawURL); err == nil {
+		b = c.breakers.Get(u.Host)
+	}
+
+	err := b.Allow()
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	switch {
+	case ctx.Err() != nil:
+		b.Cancel()
+	case err == nil || !isTransient(ctx, err):
+		b.Success()
+	default:
+		b.Failure(err)
+	}
+
+	return err
+}
+
+// retry calls fn until it succeeds, fails permanently or runs out of attempts.
+// fn reports progress when the failed attempt should not count against the retries.
+func (c *GoProxyClient) retry(ctx context.Context, url string, fn func() (bool, error)) error {
+	attempt := 0
+	for {
+		progress, err := fn()
+		if err == nil {
+			return nil
+		}
+
+		if !isTransient(ctx, err) {
+			return err
+		}
+
+		// resume right away, the transfer was working until it broke
+		if progress {
+			attempt = 0
+			continue
+		}
+
+		attempt++
+		if attempt > c.retries {
+			return err
+		}
+
+		delay := backoff(attempt)
+
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.retryAfter > delay {
+			delay = min(statusErr.retryAfter, retryMaxDelay)
+		}
+
+		slog.Warn("upstream request failed, retrying", "url", url, "attempt", attempt, "delay", delay, "err", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff is exponential with jitter, between half and the full delay
+func backoff(attempt int) time.Duration {
+	delay := retryBaseDelay << min(attempt-1, 16)
+	delay = min(delay, retryMaxDelay)
+
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func isTransient(ctx context.Context, err error) bool {
+	// the caller gave up, there is nobody to retry for
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if errors.Is(err, astera.ErrModuleNotFound) {
+		return false
+	}
+
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code == http.StatusTooManyRequests || statusErr.code >= http.StatusInternalServerError
+	}
+
+	// network errors, idle timeouts and broken bodies
+	return true
+}
+
+func checkStatus(resp *http.Response, expected ...int) error {
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return astera.ErrModuleNotFound
+	} else if resp.StatusCode == http.StatusGone {
+		return astera.ErrModuleGone
+	}
+
+	statusErr := &statusError{code: resp.StatusCode}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		statusErr.retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return statusErr
+}
+
+func readError(ctx context.Context, err error) error {
+	if errors.Is(context.Cause(ctx), errIdleTimeout) {
+		return errIdleTimeout
+	}
+
+	return err
+}
+
+// idleReader cancels the request when the body doesn't deliver any data within the idle timeout
+func (c *GoProxyClient) idleReader(ctx context.Context, cancel context.CancelCauseFunc, r io.Reader) io.Reader {
+	if c.idleTimeout <= 0 {
+		return r
+	}
+
+	timer := time.AfterFunc(c.idleTimeout, func() { cancel(errIdleTimeout) })
+	context.AfterFunc(ctx, func() { timer.Stop() })
+
+	return &idleTimeoutReader{r: r, timer: timer, timeout: c.idleTimeout}
+}
+
+type idleTimeoutReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+
+	return n, err
+}
+
+// Ping checks that the upstream proxy answers at all, the status code does not matter
+func (c *GoProxyClient) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.baseURL(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// Probe asks the upstream host for its root over the scheme of the GOPROXY, an answer below 500
+// means it is back. It is the breaker.Config Probe, the client must not use the breakers itself.
+func (c *GoProxyClient) Probe(ctx context.Context, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	scheme := "https"
+	if u, err := url.Parse(c.baseURL()); err == nil && u.Host == host {
+		scheme = u.Scheme
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, scheme+"://"+host+"/", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return &statusError{code: resp.StatusCode}
+	}
+
+	return nil
+}
+
 func (c *GoProxyClient) FetchLatest(ctx context.Context, module string) ([]byte, error) {
-	u, err := url.JoinPath(proxyGolangURL, module, "@latest")
+	u, err := url.JoinPath(c.baseURL(), module, "@latest")
 	if err != nil {
 		return nil, err
 	}
@@ -70,7 +480,7 @@ func (c *GoProxyClient) FetchLatest(ctx context.Context, module string) ([]byte,
 }
 
 func (c *GoProxyClient) FetchModuleMod(ctx context.Context, module, version string) ([]byte, error) {
-	u, err := url.JoinPath(proxyGolangURL, module, "@v", version+".mod")
+	u, err := url.JoinPath(c.baseURL(), module, "@v", version+".mod")
 	if err != nil {
 		return nil, err
 	}
@@ -79,19 +489,61 @@ func (c *GoProxyClient) FetchModuleMod(ctx context.Context, module, version stri
 }
 
 func (c *GoProxyClient) FetchModuleZip(ctx context.Context, module, version string) ([]byte, error) {
-	u, err := url.JoinPath(proxyGolangURL, module, "@v", version+".zip")
+	u, err := url.JoinPath(c.baseURL(), module, "@v", version+".zip")
 	if err != nil {
 		return nil, err
 	}
 
-	return c.fetch(ctx, u)
+	return c.fetchResumable(ctx, u)
 }
 
 func (c *GoProxyClient) FetchModuleInfo(ctx context.Context, module, version string) ([]byte, error) {
-	u, err := url.JoinPath(proxyGolangURL, module, "@v", version+".info")
+	u, err := url.JoinPath(c.baseURL(), module, "@v", version+".info")
 	if err != nil {
 		return nil, err
 	}
 
 	return c.fetch(ctx, u)
 }
+
+func (c *GoProxyClient) FetchList(ctx context.Context, module string) ([]byte, error) {
+	u, err := url.JoinPath(c.baseURL(), module, "@v", "list")
+	if err != nil {
+		return nil, err
+	}
+
+	return c.fetch(ctx, u)
+}
+
+type catalogResponse struct {
+	Modules []astera.CatalogEntry `json:"modules"`
+	Next    string                `json:"next"`
+}
+
+// FetchCatalog reads a page of the Athens style /catalog endpoint, served by Athens and astera
+func (c *GoProxyClient) FetchCatalog(ctx context.Context, token string, pageSize int) ([]astera.CatalogEntry, string, error) {
+	u, err := url.Parse(c.baseURL() + "/catalog")
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := url.Values{"pagesize": {strconv.Itoa(pageSize)}}
+	if token != "" {
+		query.Set("token", token)
+	}
+
+	u.RawQuery = query.Encode()
+
+	body, err := c.fetch(ctx, u.String())
+	if err != nil {
+		return nil, "", err
+	}
+
+	var catalog catalogResponse
+	err = json.Unmarshal(body, &catalog)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid catalog: %w", err)
+	}
+
+	return catalog.Modules, catalog.Next, nil
+}
@@ -0,0 +1,198 @@
+package modstore
+
+import (
+	"astera"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchRetry(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var tt = []struct {
+		name     string
+		statuses []int
+		retries  int
+		err      error
+		requests int32
+	}{
+		{
+			name:     "recovers after 5xx",
+			statuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK},
+			retries:  2,
+			requests: 3,
+		},
+		{
+			name:     "gives up after retries",
+			statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			retries:  1,
+			err:      &statusError{code: http.StatusBadGateway},
+			requests: 2,
+		},
+		{
+			name:     "not found is not retried",
+			statuses: []int{http.StatusNotFound, http.StatusOK},
+			retries:  2,
+			err:      astera.ErrModuleNotFound,
+			requests: 1,
+		},
+		{
+			name:     "4xx is not retried",
+			statuses: []int{http.StatusForbidden, http.StatusOK},
+			retries:  2,
+			err:      &statusError{code: http.StatusForbidden},
+			requests: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := requests.Add(1)
+				w.WriteHeader(tc.statuses[n-1])
+				fmt.Fprint(w, "body")
+			}))
+			defer srv.Close()
+
+			c := &GoProxyClient{client: srv.Client(), retries: tc.retries}
+
+			body, err := c.fetch(ctx, srv.URL)
+			if tc.err != nil {
+				assert.Equal(t, tc.err, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, []byte("body"), body)
+			}
+
+			assert.Equal(t, tc.requests, requests.Load())
+		})
+	}
+}
+
+func TestFetchResumable(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+
+		offset := 0
+		if rng := r.Header.Get("Range"); rng != "" {
+			fmt.Sscanf(rng, "bytes=%d-", &offset)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(content)-1, len(content)))
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)-offset))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		}
+
+		// every response breaks off after 3000 bytes
+		end := min(offset+3000, len(content))
+		w.Write(content[offset:end])
+		if end < len(content) {
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+	}))
+	defer srv.Close()
+
+	c := &GoProxyClient{client: srv.Client(), spillDir: t.TempDir()}
+
+	body, err := c.fetchResumable(ctx, srv.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, content, body)
+	assert.Equal(t, []string{"", "bytes=3000-", "bytes=6000-", "bytes=9000-"}, ranges)
+}
+
+func TestFetchIdleTimeout(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c := &GoProxyClient{client: srv.Client(), idleTimeout: 50 * time.Millisecond}
+
+	_, err := c.fetch(ctx, srv.URL)
+	assert.ErrorIs(t, err, errIdleTimeout)
+	assert.True(t, strings.Contains(err.Error(), "idle timeout"))
+}
+
+func TestFetchCatalog(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/proxy/catalog" {
+			http.NotFound(w, r)
+			return
+		}
+
+		assert.Equal(t, "2", r.URL.Query().Get("pagesize"))
+		if r.URL.Query().Get("token") == "" {
+			fmt.Fprint(w, `{"modules":[{"module":"github.com/Tmwalaszek/module1","version":"v1.0.0"}],"next":"page2"}`)
+			return
+		}
+
+		fmt.Fprint(w, `{"modules":[]}`)
+	}))
+	defer srv.Close()
+
+	c := NewGoProxyClient(GoProxyClientConfig{URL: srv.URL + "/proxy/"})
+
+	entries, next, err := c.FetchCatalog(ctx, "", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []astera.CatalogEntry{{Module: "github.com/Tmwalaszek/module1", Version: "v1.0.0"}}, entries)
+	assert.Equal(t, "page2", next)
+
+	entries, next, err = c.FetchCatalog(ctx, next, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.Empty(t, next)
+
+	_, _, err = NewGoProxyClient(GoProxyClientConfig{URL: srv.URL}).FetchCatalog(ctx, "", 2)
+	assert.ErrorIs(t, err, astera.ErrModuleNotFound)
+}
+
+func TestProbe(t *testing.T) {
+	t.Parallel()
+
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	c := NewGoProxyClient(GoProxyClientConfig{URL: srv.URL})
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	assert.Error(t, c.Probe(context.Background(), host))
+
+	// any answer below 500 means the upstream is back
+	status.Store(http.StatusNotFound)
+	assert.NoError(t, c.Probe(context.Background(), host))
+}
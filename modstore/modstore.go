@@ -3,14 +3,22 @@ package modstore
 import (
 	"astera"
 	"astera/git"
+	"astera/importer"
+	"astera/jobs"
+	"astera/limiter"
+	"astera/mirror"
+	"astera/policy"
+	"astera/schedule"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
-	"path"
-	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/tmwalaszek/weakcache"
 	xmod "golang.org/x/mod/module"
@@ -18,12 +26,78 @@ import (
 )
 
 const (
-	infoSuffix    = ".info"
-	modSuffix     = ".mod"
-	zipSuffix     = ".zip"
-	zipHashSuffix = ".ziphash"
+	infoSuffix = ".info"
+	modSuffix  = ".mod"
+	zipSuffix  = ".zip"
 )
 
+const defaultMissJobDelay = 10 * time.Minute
+
+// errShuttingDown refuses the fetches started after Shutdown, a job is resumed on the next start
+var errShuttingDown = errors.New("module store is shutting down")
+
+type Config struct {
+	Upstream GoProxyClientConfig
+
+	// MissRate is the number of cache misses per second a single client can cause,
+	// MissBurst is how many it can cause at once. Zero MissRate disables the limit.
+	MissRate  float64
+	MissBurst int
+
+	// FetchSlots is the number of upstream fetches running at once, the slots are shared
+	// fairly between the clients. Zero means no limit.
+	FetchSlots int
+
+	// VCSLimiter bounds the git processes running at once, nil means no limit
+	VCSLimiter *limiter.HostLimiter
+
+	// NegativeCache stores the resources upstream doesn't have for NegativeTTL.
+	// Negative caching is disabled when it is nil or NegativeTTL is zero.
+	NegativeCache astera.NegativeCacheRepository
+	NegativeTTL   time.Duration
+
+	// FetchTimeout limits a single module fetch, which runs detached from the requests waiting
+	// for it. With BackgroundFetch the fetch completes and stores the module even when all the
+	// requests are gone, otherwise it is cancelled with the last one.
+	FetchTimeout    time.Duration
+	BackgroundFetch bool
+
+	// Jobs stores the queued background fetches, the queue is disabled when it is nil.
+	// A cache miss is queued before it is fetched, so it is retried in the background if the
+	// fetch fails or astera restarts.
+	Jobs           astera.JobRepository
+	JobWorkers     int
+	JobMaxAttempts int
+	// JobSchedule holds back the prefetch and mirror jobs and the mirror syncs outside its windows, nil runs them any time
+	JobSchedule *schedule.Schedule
+
+	// PrefetchDepth is how many levels of requirements of a fetched go.mod are queued for prefetch,
+	// zero disables the prefetch. It needs the job queue. The prefetched modules get only
+	// .info and .mod unless PrefetchZip is set.
+	PrefetchDepth int
+	PrefetchZip   bool
+
+	// Imports stores the modules imported from a local module cache, the import is disabled when it is nil
+	Imports astera.ImportRepository
+
+	// Access records the last access and hits of the served versions, batched every AccessFlushInterval
+	// (a minute when zero). Nothing is recorded when it is nil.
+	Access              astera.AccessRepository
+	AccessFlushInterval time.Duration
+
+	// Mirror queues the missing versions of the mirrored modules as mirror jobs, it needs the job queue
+	Mirror *mirror.Mirror
+
+	// Quarantine stops serving and fetching the quarantined versions, nothing is quarantined when it is nil
+	Quarantine astera.QuarantineRepository
+
+	// Policy decides the modules and versions served and fetched, everything is allowed when it is nil
+	Policy *policy.Engine
+	// Releases reads the release times for the minimum release age of the policy, which is not
+	// checked when it is nil
+	Releases astera.ReleaseRepository
+}
+
 type ModuleStore struct {
 	moduleRepository astera.ModuleRepository
 	vcs              astera.VCS
@@ -33,40 +107,209 @@ type ModuleStore struct {
 	goPrivate string
 
 	weakCache *weakcache.WeakCache[[]byte]
+
+	missLimiter *limiter.KeyedLimiter
+	fetchQueue  *limiter.FairQueue
+
+	negativeCache *negativeCache
+
+	flights *flightGroup
+
+	jobRepository astera.JobRepository
+	jobs          *jobs.Pool
+	// how long a failed or abandoned miss waits before a worker retries it, an abandoned fetch may
+	// still be running
+	missJobDelay time.Duration
+
+	prefetchDepth int
+	prefetchZip   bool
+
+	importRepository astera.ImportRepository
+
+	mirror      *mirror.Mirror
+	jobSchedule *schedule.Schedule
+
+	access *accessTracker
+
+	quarantineRepository astera.QuarantineRepository
+
+	policy            *policy.Engine
+	releaseRepository astera.ReleaseRepository
+	releaseTimes      *releaseCache
+
+	// in-flight fetches, waited for on Shutdown. No fetch is added once closed is set, Add must
+	// not race with Wait.
+	fetchesMx sync.Mutex
+	closed    bool
+	fetches   sync.WaitGroup
 }
 
-func NewModuleStore(moduleRepository astera.ModuleRepository) astera.GoProxyService {
-	goProxyClient := NewGoProxyClient()
+func NewModuleStore(moduleRepository astera.ModuleRepository, config Config) astera.GoProxyService {
+	goProxyClient := NewGoProxyClient(config.Upstream)
 	newWeakCache := weakcache.NewWeakCache[[]byte]()
 	vcs := git.New()
+	vcs.Limiter = config.VCSLimiter
 
 	goPrivate := os.Getenv("GOPRIVATE")
 
-	return &ModuleStore{moduleRepository: moduleRepository,
+	c := &ModuleStore{moduleRepository: moduleRepository,
 		weakCache:     newWeakCache,
 		goProxyClient: goProxyClient,
 		goPrivate:     goPrivate,
 		vcs:           vcs,
+		missLimiter:   limiter.NewKeyedLimiter(config.MissRate, config.MissBurst),
+		fetchQueue:    limiter.NewFairQueue(config.FetchSlots),
+		negativeCache: newNegativeCache(config.NegativeCache, config.NegativeTTL),
+		flights:       newFlightGroup(config.FetchTimeout, config.BackgroundFetch),
+		jobRepository: config.Jobs,
+		missJobDelay:  config.FetchTimeout,
+		prefetchDepth: config.PrefetchDepth,
+		prefetchZip:   config.PrefetchZip,
+
+		importRepository: config.Imports,
+		access:           newAccessTracker(config.Access, config.AccessFlushInterval),
+
+		quarantineRepository: config.Quarantine,
+		policy:               config.Policy,
+		releaseRepository:    config.Releases,
+		releaseTimes:         newReleaseCache(),
+	}
+
+	if c.missJobDelay <= 0 {
+		c.missJobDelay = defaultMissJobDelay
+	}
+
+	if config.Jobs != nil {
+		c.jobs = jobs.New(config.Jobs, c.runJob, jobs.Config{
+			Workers:     config.JobWorkers,
+			MaxAttempts: config.JobMaxAttempts,
+			Schedule:    config.JobSchedule,
+		})
+		c.mirror = config.Mirror
+		c.jobSchedule = config.JobSchedule
 	}
+
+	return c
 }
 
-func (c *ModuleStore) ImportCachedModules(dir string) error {
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		return errors.New("module cache directory does not exist")
+// Start starts the job workers and the mirror syncs, a store used only to fetch doesn't need them
+func (c *ModuleStore) Start() {
+	if c.jobs == nil {
+		return
 	}
 
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() && info.Name() == "@v" {
-			err = c.createModuleCache(dir, path)
-			if err != nil && !errors.Is(err, os.ErrNotExist) {
-				return err
-			}
-		}
+	c.jobs.Start()
+	c.mirror.Start(c.enqueueMirror, c.jobSchedule)
+}
 
-		return nil
+// enqueueMirror queues a mirror job, the quarantined and denied versions are left out of the sync
+func (c *ModuleStore) enqueueMirror(job *astera.Job) (bool, error) {
+	err := c.checkVersion(job.Name, job.Version)
+	if errors.Is(err, astera.ErrModuleGone) || errors.Is(err, astera.ErrPolicyDenied) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return c.jobs.Enqueue(job)
+}
+
+// PurgeNegativeCache forgets the resources upstream didn't have, for all modules when module is empty
+func (c *ModuleStore) PurgeNegativeCache(module string) (int64, error) {
+	return c.negativeCache.purge(module)
+}
+
+func (c *ModuleStore) ListJobs(state string, limit int) ([]astera.Job, error) {
+	if c.jobRepository == nil {
+		return []astera.Job{}, nil
+	}
+
+	return c.jobRepository.ListJobs(state, limit)
+}
+
+func (c *ModuleStore) CancelJob(id int64) error {
+	if c.jobs == nil {
+		return astera.ErrModuleNotFound
+	}
+
+	return c.jobs.Cancel(id)
+}
+
+// runJob fetches the queued module version, joining the fetch of the requests if there is one. Only the
+// retried misses were requested explicitly, the prefetch and the mirror never store a version too young.
+func (c *ModuleStore) runJob(ctx context.Context, job *astera.Job) error {
+	withZip := job.Kind != astera.JobKindPrefetch || c.prefetchZip
+	exact := job.Kind == astera.JobKindMiss
+
+	return c.flights.do(ctx, c.flightKey(job.Name, job.Version, withZip, exact), func(ctx context.Context) error {
+		return c.fetchAndStoreModule(ctx, job.Name, job.Version, withZip, exact, job.Depth)
 	})
+}
 
-	return err
+// enqueue queues the background fetch of the module version, nothing happens when the queue is disabled
+func (c *ModuleStore) enqueue(module, version, kind string, nextAttempt time.Time) {
+	if c.jobs == nil {
+		return
+	}
+
+	_, err := c.jobs.Enqueue(&astera.Job{Name: module, Version: version, Kind: kind, NextAttempt: nextAttempt})
+	if err != nil {
+		slog.Error("failed to queue job", "module", module, "version", version, "kind", kind, "err", err)
+	}
+}
+
+// ImportCachedModules imports the local module cache at dir, see importer.Importer
+func (c *ModuleStore) ImportCachedModules(ctx context.Context, dir string, options astera.ImportOptions) (*astera.ImportReport, error) {
+	if c.importRepository == nil {
+		return nil, errors.New("module cache import is not configured")
+	}
+
+	options.Check = c.checkImport
+
+	return importer.New(c.importRepository, options).Run(ctx, dir)
+}
+
+// checkImport refuses the imported versions that must not be served, the release age is read from their .info
+func (c *ModuleStore) checkImport(m *astera.Module) error {
+	err := c.checkVersion(m.Name, m.Version)
+	if err != nil {
+		return err
+	}
+
+	return c.checkInfoReleaseAge(m.Name, m.Version, m.Info, false)
+}
+
+// Shutdown stops the job workers, their jobs are resumed on the next start, waits for the
+// in-flight upstream and git fetches to be stored or until ctx is done and records the pending accesses
+func (c *ModuleStore) Shutdown(ctx context.Context) error {
+	c.mirror.Stop()
+	defer c.access.close()
+
+	if c.jobs != nil {
+		err := c.jobs.Stop(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.fetchesMx.Lock()
+	c.closed = true
+	c.fetchesMx.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.fetches.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (c *ModuleStore) Query(ctx context.Context, query string) ([]byte, error) {
@@ -92,15 +335,23 @@ func (c *ModuleStore) Query(ctx context.Context, query string) ([]byte, error) {
 		resource = split[1]
 	}
 
-	_, err = xmod.UnescapePath(module)
+	modulePath, err := xmod.UnescapePath(module)
 	if err != nil {
 		return nil, err
 	}
 
+	// the versions are checked one by one before they are served or fetched
+	if resource == "list" || resource == "@latest" {
+		err = c.policy.CheckModule(modulePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	switch {
 	case resource == "list":
 		var versionLists []string
-		versionLists, err = c.queryVersionsList(module)
+		versionLists, err = c.queryVersionsList(ctx, module)
 
 		responseBody = []byte(strings.Join(versionLists, "\n"))
 	case resource == "@latest":
@@ -143,176 +394,248 @@ func (c *ModuleStore) Query(ctx context.Context, query string) ([]byte, error) {
 	return responseBody, nil
 }
 
-func (c *ModuleStore) createModuleCache(dir, modulePath string) error {
-	module := strings.TrimPrefix(modulePath, dir+"/")
-	module = strings.TrimSuffix(module, "/@v")
-
-	listBody, err := os.ReadFile(path.Join(modulePath, "list"))
-	if err != nil {
-		return err
-	}
-
-	list := strings.Split(string(listBody), "\n")
-	for _, v := range list {
-		if len(v) == 0 {
-			continue
-		}
-
-		version := strings.TrimSpace(v)
-		var infoFile, zip, zipHash []byte
-
-		modFilePath := path.Join(modulePath, version+modSuffix)
-		modFile, err := os.ReadFile(modFilePath)
-		if err != nil {
-			return err
-		}
-
-		infoFilePath := path.Join(modulePath, version+infoSuffix)
-		_, err = os.Stat(infoFilePath)
-		if !os.IsNotExist(err) {
-			infoFile, err = os.ReadFile(infoFilePath)
-			if err != nil {
-				return err
-			}
-		}
-
-		zipFilePath := path.Join(modulePath, version+zipSuffix)
-		_, err = os.Stat(zipFilePath)
-		if !os.IsNotExist(err) {
-			zip, err = os.ReadFile(zipFilePath)
-			if err != nil {
-				return err
-			}
-		}
-
-		zipHashFilePath := path.Join(modulePath, version+zipHashSuffix)
-		_, err = os.Stat(zipHashFilePath)
-		if !os.IsNotExist(err) {
-			zipHash, err = os.ReadFile(zipHashFilePath)
-			if err != nil {
-				return err
-			}
-		}
+func (c *ModuleStore) queryVersionsList(ctx context.Context, module string) ([]string, error) {
+	var versionList []string
+	var err error
 
-		m := &astera.Module{
-			Name:    module,
-			Version: version,
-			Info:    infoFile,
-			Mod:     modFile,
-			ZipHash: string(zipHash),
-			Zip:     zip,
-		}
+	reqInfo := astera.RequestInfoFromContext(ctx)
 
-		err = c.moduleRepository.InsertModule(m)
-		if err != nil && !errors.Is(err, astera.ErrModuleAlreadyExists) {
-			return err
-		}
+	check, err := c.versionCheck(module)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
-}
-
-func (c *ModuleStore) queryVersionsList(module string) ([]string, error) {
-	var versionList []string
-	var err error
-
 	if xmod.MatchPrefixPatterns(c.goPrivate, module) {
 		module, err = xmod.UnescapePath(module)
 		if err != nil {
 			return nil, err
 		}
 
-		versionList, err = c.vcs.FetchTags(module)
+		versionList, err = c.vcs.FetchTags(ctx, module)
 		if err != nil {
 			return nil, err
 		}
+
+		reqInfo.SetSource(astera.CacheBypass, astera.SourceGit, module)
 	} else {
 		versionList, err = c.moduleRepository.GetVersionList(module)
 		if err != nil {
 			return nil, err
 		}
+
+		reqInfo.SetSource(astera.CacheHit, astera.SourceDatabase, "")
 	}
 
-	return versionList, nil
+	return check.filter(versionList), nil
 }
 
 func (c *ModuleStore) queryLatest(ctx context.Context, module string) (string, error) {
 	var latest string
 
+	reqInfo := astera.RequestInfoFromContext(ctx)
+
+	check, err := c.versionCheck(module)
+	if err != nil {
+		return "", err
+	}
+
 	if xmod.MatchPrefixPatterns(c.goPrivate, module) {
 		module, err := xmod.UnescapePath(module)
 		if err != nil {
 			return "", err
 		}
 
-		tagLists, err := c.vcs.FetchTags(module)
+		release, err := c.acquireUpstream(ctx)
 		if err != nil {
 			return "", err
 		}
 
+		tagLists, err := c.vcs.FetchTags(ctx, module)
+		release()
+		if err != nil {
+			return "", err
+		}
+
+		tagLists = check.filter(tagLists)
+		if len(tagLists) == 0 {
+			return "", astera.ErrModuleNotFound
+		}
+
 		semver.Sort(tagLists)
 		latest = tagLists[len(tagLists)-1]
+
+		reqInfo.SetSource(astera.CacheBypass, astera.SourceGit, module)
 	} else {
-		tag, err := c.goProxyClient.FetchLatest(ctx, module)
+		tag, err := c.fetchLatest(ctx, module)
+		if err != nil && ctx.Err() == nil && !errors.As(err, new(*astera.RateLimitError)) {
+			// the published modules are known only to us and while upstream is unreachable
+			// the latest stored version is better than nothing
+			stored, storedErr := c.latestFromRepository(module, check)
+			if errors.Is(storedErr, astera.ErrModuleNotFound) {
+				return "", err
+			}
+
+			if storedErr != nil {
+				return "", storedErr
+			}
+
+			if errors.Is(err, astera.ErrModuleNotFound) {
+				reqInfo.SetSource(astera.CacheHit, astera.SourceDatabase, "")
+			} else {
+				slog.Warn("upstream unavailable, serving stored @latest", "module", module, "err", err)
+				reqInfo.SetSource(astera.CacheStale, astera.SourceDatabase, "")
+			}
+
+			return string(stored), nil
+		}
+
 		if err != nil {
 			return "", err
 		}
 
+		if latestErr := c.checkLatest(module, check, tag); latestErr != nil {
+			// the newest stored version that can be served answers instead
+			stored, err := c.latestFromRepository(module, check)
+			if errors.Is(err, astera.ErrModuleNotFound) {
+				return "", latestErr
+			}
+
+			if err != nil {
+				return "", err
+			}
+
+			reqInfo.SetSource(astera.CacheHit, astera.SourceDatabase, "")
+
+			return string(stored), nil
+		}
+
 		latest = string(tag)
+
+		reqInfo.SetSource(astera.CacheBypass, astera.SourceUpstream, c.goProxyClient.baseURL())
 	}
 
 	return latest, nil
 }
 
-func (c *ModuleStore) queryModuleInfo(ctx context.Context, module, version string) ([]byte, error) {
-	result, err := c.queryModuleInfoCache(module, version)
-	if err == nil {
-		return result, nil
+func (c *ModuleStore) fetchLatest(ctx context.Context, module string) ([]byte, error) {
+	if entry, _ := c.negativeCache.get(module, "@latest"); entry != nil {
+		return nil, entry.Err()
 	}
 
-	if errors.Is(err, astera.ErrModuleNotFound) {
-		err := c.fetchAndSetModule(ctx, module, version)
-		if err != nil {
-			return nil, err
-		}
+	release, err := c.acquireUpstream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
 
-		return c.queryModuleInfoCache(module, version)
+	latest, err := c.goProxyClient.FetchLatest(ctx, module)
+	c.negativeCache.set(module, "@latest", err)
 
+	return latest, err
+}
+
+// acquireUpstream admits a request going upstream on behalf of the client: its miss rate limit
+// first, then a slot of the fair fetch queue
+func (c *ModuleStore) acquireUpstream(ctx context.Context) (func(), error) {
+	client := astera.RequestInfoFromContext(ctx).ClientID()
+	if ok, retryAfter := c.missLimiter.Allow(client); !ok {
+		return nil, &astera.RateLimitError{RetryAfter: retryAfter}
 	}
 
-	return nil, err
+	return c.fetchQueue.Acquire(ctx, client)
 }
 
-func (c *ModuleStore) queryModuleMod(ctx context.Context, module, version string) ([]byte, error) {
-	result, err := c.queryModuleModCache(module, version)
-	if err == nil {
-		return result, nil
+// latestFromRepository returns the .info of the latest stored version that can be served
+func (c *ModuleStore) latestFromRepository(module string, check versionCheck) ([]byte, error) {
+	versions, err := c.moduleRepository.GetVersionList(module)
+	if err != nil {
+		return nil, err
 	}
-	if errors.Is(err, astera.ErrModuleNotFound) {
-		err := c.fetchAndSetModule(ctx, module, version)
-		if err != nil {
-			return nil, err
-		}
 
-		return c.queryModuleModCache(module, version)
+	versions = check.filter(versions)
+
+	if len(versions) == 0 {
+		return nil, astera.ErrModuleNotFound
 	}
 
-	return nil, err
+	return c.moduleRepository.GetVersionInfo(module, latestVersion(versions))
+}
+
+// latestVersion prefers releases over pre-releases the same way the go command does
+func latestVersion(versions []string) string {
+	versions = slices.Clone(versions)
+	semver.Sort(versions)
+
+	for i := len(versions) - 1; i >= 0; i-- {
+		if semver.Prerelease(versions[i]) == "" {
+			return versions[i]
+		}
+	}
+
+	return versions[len(versions)-1]
+}
+
+func (c *ModuleStore) queryModuleInfo(ctx context.Context, module, version string) ([]byte, error) {
+	return c.queryModuleResource(ctx, module, version, infoSuffix, c.moduleRepository.GetVersionInfo)
+}
+
+func (c *ModuleStore) queryModuleMod(ctx context.Context, module, version string) ([]byte, error) {
+	return c.queryModuleResource(ctx, module, version, modSuffix, c.moduleRepository.GetModFile)
 }
 
 func (c *ModuleStore) queryModuleZip(ctx context.Context, module, version string) ([]byte, error) {
-	result, err := c.queryModuleZipCache(module, version)
+	return c.queryModuleResource(ctx, module, version, zipSuffix, c.moduleRepository.GetModuleZip)
+}
+
+// queryModuleResource serves the resource from the cache and fetches the whole module on a miss
+func (c *ModuleStore) queryModuleResource(ctx context.Context, module, version, suffix string,
+	repositoryGetFn func(string, string) ([]byte, error),
+) ([]byte, error) {
+	reqInfo := astera.RequestInfoFromContext(ctx)
+
+	err := c.checkVersion(module, version)
+	if err != nil {
+		return nil, err
+	}
+
+	result, source, err := c.queryCache(module, version, suffix, repositoryGetFn)
 	if err == nil {
+		err = c.checkStoredReleaseAge(module, version)
+		if err != nil {
+			return nil, err
+		}
+
+		reqInfo.SetSource(astera.CacheHit, source, "")
+		c.access.record(module, version)
 		return result, nil
 	}
 
 	if errors.Is(err, astera.ErrModuleNotFound) {
+		// a missing version is missing for .info, .mod and .zip alike, the entry covers the version
+		resource := version
+		if entry, source := c.negativeCache.get(module, resource); entry != nil {
+			reqInfo.SetSource(astera.CacheHit, source, "")
+			return nil, entry.Err()
+		}
+
+		if ok, retryAfter := c.missLimiter.Allow(reqInfo.ClientID()); !ok {
+			return nil, &astera.RateLimitError{RetryAfter: retryAfter}
+		}
+
+		// a version too young is refused by the fetch, from the upstream .info it fetches first
 		err := c.fetchAndSetModule(ctx, module, version)
 		if err != nil {
+			c.negativeCache.set(module, resource, err)
 			return nil, err
 		}
 
-		return c.queryModuleZipCache(module, version)
+		result, _, err = c.queryCache(module, version, suffix, repositoryGetFn)
+		if err == nil {
+			c.access.record(module, version)
+		}
+
+		return result, err
 	}
 
 	return nil, err
@@ -332,22 +655,32 @@ func (c *ModuleStore) fetchAndCache(ctx context.Context, module, version, suffix
 }
 
 // resource is version + {info,mod,zip}
-func (c *ModuleStore) fetchModule(ctx context.Context, module, version string) (*astera.Module, error) {
+// without zip it is a partial module with only .info and .mod. The .info is fetched first, a version
+// too young is refused before the rest is downloaded.
+func (c *ModuleStore) fetchModule(ctx context.Context, module, version string, withZip, exact bool) (*astera.Module, error) {
 	info, err := c.fetchAndCache(ctx, module, version, infoSuffix, c.goProxyClient.FetchModuleInfo)
 	if err != nil {
 		return nil, err
 	}
 
-	mod, err := c.fetchAndCache(ctx, module, version, modSuffix, c.goProxyClient.FetchModuleMod)
+	err = c.checkInfoReleaseAge(module, version, info, exact)
 	if err != nil {
 		return nil, err
 	}
 
-	zip, err := c.fetchAndCache(ctx, module, version, zipSuffix, c.goProxyClient.FetchModuleZip)
+	mod, err := c.fetchAndCache(ctx, module, version, modSuffix, c.goProxyClient.FetchModuleMod)
 	if err != nil {
 		return nil, err
 	}
 
+	var zip []byte
+	if withZip {
+		zip, err = c.fetchAndCache(ctx, module, version, zipSuffix, c.goProxyClient.FetchModuleZip)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var infoResponse astera.Info
 	err = json.Unmarshal(info, &infoResponse)
 	if err != nil {
@@ -356,6 +689,7 @@ func (c *ModuleStore) fetchModule(ctx context.Context, module, version string) (
 
 	return &astera.Module{
 		Name:    module,
+		Source:  astera.ModuleSourceProxy,
 		Version: version,
 		Info:    info,
 		Mod:     mod,
@@ -364,17 +698,115 @@ func (c *ModuleStore) fetchModule(ctx context.Context, module, version string) (
 	}, nil
 }
 
-// fetchModule
+// fetchAndSetModule waits for the module to be fetched and stored. All the requests for the same
+// version share a single fetch, which is not cancelled when only some of them go away. Only a
+// fetch that failed or was abandoned by its requests is queued as a job to be retried, a
+// successful one costs no write besides the module.
 func (c *ModuleStore) fetchAndSetModule(ctx context.Context, module, version string) error {
+	err := c.flights.do(ctx, c.flightKey(module, version, true, true), func(ctx context.Context) error {
+		return c.fetchAndStoreModule(ctx, module, version, true, true, 0)
+	})
+	if err != nil {
+		if retryable(err) {
+			c.enqueue(module, version, astera.JobKindMiss, time.Now().Add(c.missJobDelay))
+		}
+
+		return err
+	}
+
+	reqInfo := astera.RequestInfoFromContext(ctx)
+	if xmod.MatchPrefixPatterns(c.goPrivate, module) {
+		modulePath, _ := xmod.UnescapePath(module)
+		reqInfo.SetSource(astera.CacheMiss, astera.SourceGit, modulePath)
+	} else {
+		reqInfo.SetSource(astera.CacheMiss, astera.SourceUpstream, c.goProxyClient.baseURL())
+	}
+
+	return nil
+}
+
+// FetchModule stores the module for the prefetch, a version too young is refused
+func (c *ModuleStore) FetchModule(ctx context.Context, module, version string, withZip bool) error {
+	return c.flights.do(ctx, c.flightKey(module, version, withZip, false), func(ctx context.Context) error {
+		return c.fetchAndStoreModule(ctx, module, version, withZip, false, 0)
+	})
+}
+
+// flightKey keys the shared fetches. A request, exact, must not get the refusal of a young version it
+// may be served with ServeExact, so it only joins the other fetches of the modules without a minimum age.
+func (c *ModuleStore) flightKey(module, version string, withZip, exact bool) string {
+	key := module + "@" + version
+	if !withZip {
+		key += "/mod"
+	}
+
+	if modulePath, err := xmod.UnescapePath(module); !exact && err == nil && c.checksReleaseAge(module, modulePath) {
+		key += "/aged"
+	}
+
+	return key
+}
+
+// retryable tells if a later fetch may succeed where this one failed
+func retryable(err error) bool {
+	return !errors.Is(err, astera.ErrModuleNotFound) && !errors.Is(err, astera.ErrModuleGone) &&
+		!errors.Is(err, astera.ErrPolicyDenied) &&
+		!errors.Is(err, astera.ErrInvalidResource) && !errors.As(err, new(*astera.RateLimitError))
+}
+
+// startFetch registers an in-flight fetch, false once Shutdown started
+func (c *ModuleStore) startFetch() bool {
+	c.fetchesMx.Lock()
+	defer c.fetchesMx.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	c.fetches.Add(1)
+
+	return true
+}
+
+// fetchAndStoreModule fetches the module unless it is stored already. A stored partial module gets
+// its zip when withZip is set. exact is set for the requests of the version itself, the minimum
+// release age applies to them as to list and @latest otherwise. depth is the distance from the
+// requested module for the prefetch.
+func (c *ModuleStore) fetchAndStoreModule(ctx context.Context, module, version string, withZip, exact bool, depth int) error {
+	if !c.startFetch() {
+		return errShuttingDown
+	}
+
+	defer c.fetches.Done()
+
+	err := c.checkVersion(module, version)
+	if err != nil {
+		return err
+	}
+
 	moduleExists, err := c.moduleRepository.ModuleExists(module, version)
 	if err != nil {
 		return err
 	}
 
+	if moduleExists && withZip {
+		moduleExists, err = c.moduleRepository.HasModuleZip(module, version)
+		if err != nil {
+			return err
+		}
+	}
+
 	if moduleExists {
 		return nil
 	}
 
+	release, err := c.fetchQueue.Acquire(ctx, astera.RequestInfoFromContext(ctx).ClientID())
+	if err != nil {
+		return err
+	}
+
+	defer release()
+
 	var m *astera.Module
 	if xmod.MatchPrefixPatterns(c.goPrivate, module) {
 		module, err := xmod.UnescapePath(module)
@@ -382,71 +814,235 @@ func (c *ModuleStore) fetchAndSetModule(ctx context.Context, module, version str
 			return err
 		}
 
-		version, err = xmod.UnescapeVersion(version)
+		version, err := xmod.UnescapeVersion(version)
 		if err != nil {
 			return err
 		}
 
-		m, err = c.vcs.Clone(module, version)
+		m, err = c.vcs.Clone(ctx, module, version)
 		if err != nil {
 			return err
 		}
+
+		// the transfer size of git is not known, the zip is close enough
+		astera.RequestInfoFromContext(ctx).AddUpstreamBytes(int64(len(m.Zip)))
 	} else {
-		m, err = c.fetchModule(ctx, module, version)
+		m, err = c.fetchModule(ctx, module, version, withZip, exact)
 		if err != nil {
 			return err
 		}
 	}
 
+	// stored meanwhile by an import or a publish
 	err = c.moduleRepository.InsertModule(m)
-	if err != nil {
+	if err != nil && !errors.Is(err, astera.ErrModuleAlreadyExists) {
 		return err
 	}
 
+	if err == nil && m.Source == astera.ModuleSourceProxy {
+		c.releaseTimes.set(module, version, infoTime(m.Info))
+	}
+
+	c.startPrefetch(module, version, m.Mod, depth+1)
+
 	return nil
 }
 
-func (c *ModuleStore) queryRepository(module, version string, modulePostfix string, repositoryGetFn func(string, string) ([]byte, error)) ([]byte, error) {
-	result, err := repositoryGetFn(module, version)
+// versionCheck tells why a version, escaped or not, must not be served or fetched, nil when it can be
+type versionCheck func(version string) error
+
+// filter drops the versions that must not be served
+func (check versionCheck) filter(versions []string) []string {
+	return slices.DeleteFunc(versions, func(v string) bool {
+		return check(v) != nil
+	})
+}
+
+// checkLatest checks the version and the release time of the @latest .info
+func (c *ModuleStore) checkLatest(module string, check versionCheck, info []byte) error {
+	var latest astera.Info
+	if err := json.Unmarshal(info, &latest); err != nil {
+		return nil
+	}
+
+	err := check(latest.Version)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	modulePath, err := xmod.UnescapePath(module)
+	if err != nil || !c.checksReleaseAge(module, modulePath) {
+		return nil
 	}
 
-	return result, nil
+	released, _ := time.Parse(time.RFC3339, latest.Time)
+
+	return c.policy.CheckRelease(modulePath, latest.Version, released, false)
 }
 
-func (c *ModuleStore) queryModuleInfoCache(module, version string) ([]byte, error) {
-	result, err := c.weakCache.Do(fmt.Sprintf("%s-%s%s", module, version, infoSuffix),
-		func() ([]byte, error) {
-			return c.queryRepository(module, version, "info", c.moduleRepository.GetVersionInfo)
-		})
+// versionCheck combines the quarantine and the policy of the module, the versions released too
+// recently are hidden. The release times are read from the database on the first version missing
+// from the cache, once per check; a version can't be served when they can't be read.
+func (c *ModuleStore) versionCheck(module string) (versionCheck, error) {
+	check, err := c.rulesCheck(module)
 	if err != nil {
 		return nil, err
 	}
 
-	return result, nil
+	modulePath, err := xmod.UnescapePath(module)
+	if err != nil || !c.checksReleaseAge(module, modulePath) {
+		return check, nil
+	}
+
+	var stored map[string]time.Time
+	return func(version string) error {
+		err := check(version)
+		if err != nil {
+			return err
+		}
+
+		escaped, unescaped := escapings(version)
+
+		released, ok := c.releaseTimes.get(module, escaped)
+		if !ok {
+			if stored == nil {
+				stored, err = c.releaseRepository.ReleaseTimes(module)
+				if err != nil {
+					return err
+				}
+
+				for v, t := range stored {
+					c.releaseTimes.set(module, v, t)
+				}
+			}
+
+			// a version not stored has no release time
+			released = stored[escaped]
+		}
+
+		return c.policy.CheckRelease(modulePath, unescaped, released, false)
+	}, nil
 }
 
-func (c *ModuleStore) queryModuleModCache(module, version string) ([]byte, error) {
-	result, err := c.weakCache.Do(fmt.Sprintf("%s-%s%s", module, version, modSuffix),
-		func() ([]byte, error) {
-			return c.queryRepository(module, version, "mod", c.moduleRepository.GetModFile)
-		})
+// escapings returns the version escaped and unescaped, whichever it is
+func escapings(version string) (string, string) {
+	escaped, unescaped := version, version
+	if v, err := xmod.EscapeVersion(version); err == nil {
+		escaped = v
+	}
+	if v, err := xmod.UnescapeVersion(version); err == nil {
+		unescaped = v
+	}
+
+	return escaped, unescaped
+}
+
+// rulesCheck combines the quarantine and the rules of the policy
+func (c *ModuleStore) rulesCheck(module string) (versionCheck, error) {
+	var quarantined []astera.Quarantine
+	if c.quarantineRepository != nil {
+		var err error
+		quarantined, err = c.quarantineRepository.Quarantined(module)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	modulePath, err := xmod.UnescapePath(module)
 	if err != nil {
-		return nil, err
+		modulePath = module
 	}
 
-	return result, nil
+	return func(version string) error {
+		escaped, unescaped := escapings(version)
+
+		for i := range quarantined {
+			if quarantined[i].Version == escaped {
+				return &astera.QuarantinedError{Quarantine: &quarantined[i]}
+			}
+		}
+
+		return c.policy.CheckVersion(modulePath, unescaped)
+	}, nil
 }
 
-func (c *ModuleStore) queryModuleZipCache(module, version string) ([]byte, error) {
-	result, err := c.weakCache.Do(fmt.Sprintf("%s-%s%s", module, version, zipSuffix),
+// checkVersion returns why the version must not be served, it is checked before any fetch
+func (c *ModuleStore) checkVersion(module, version string) error {
+	check, err := c.rulesCheck(module)
+	if err != nil {
+		return err
+	}
+
+	return check(version)
+}
+
+// checksReleaseAge tells if the minimum release age applies, only to the public modules
+func (c *ModuleStore) checksReleaseAge(module, modulePath string) bool {
+	return c.releaseRepository != nil && !xmod.MatchPrefixPatterns(c.goPrivate, module) &&
+		c.policy.ChecksReleaseAge(modulePath)
+}
+
+// checkStoredReleaseAge refuses an explicitly requested stored version released too recently. The
+// release time is read from the database once, then remembered.
+func (c *ModuleStore) checkStoredReleaseAge(module, version string) error {
+	modulePath, err := xmod.UnescapePath(module)
+	if err != nil || !c.checksReleaseAge(module, modulePath) {
+		return nil
+	}
+
+	released, ok := c.releaseTimes.get(module, version)
+	if !ok {
+		released, err = c.releaseRepository.ReleaseTime(module, version)
+		if err != nil {
+			return err
+		}
+
+		c.releaseTimes.set(module, version, released)
+	}
+
+	_, unescaped := escapings(version)
+
+	return c.policy.CheckRelease(modulePath, unescaped, released, true)
+}
+
+// checkInfoReleaseAge refuses a version not stored yet released too recently according to its .info
+func (c *ModuleStore) checkInfoReleaseAge(module, version string, info []byte, exact bool) error {
+	modulePath, err := xmod.UnescapePath(module)
+	if err != nil || !c.checksReleaseAge(module, modulePath) {
+		return nil
+	}
+
+	_, unescaped := escapings(version)
+
+	return c.policy.CheckRelease(modulePath, unescaped, infoTime(info), exact)
+}
+
+// infoTime is the Time of the .info, zero when it has none
+func infoTime(info []byte) time.Time {
+	var i astera.Info
+	if json.Unmarshal(info, &i) != nil {
+		return time.Time{}
+	}
+
+	t, _ := time.Parse(time.RFC3339, i.Time)
+
+	return t
+}
+
+// queryCache reads the resource through the weak cache, the returned source tells
+// if the value was already in memory or had to be read from the database
+func (c *ModuleStore) queryCache(module, version, suffix string,
+	repositoryGetFn func(string, string) ([]byte, error),
+) ([]byte, string, error) {
+	source := astera.SourceMemory
+	result, err := c.weakCache.Do(cacheKey(module, version, suffix),
 		func() ([]byte, error) {
-			return c.queryRepository(module, version, "zip", c.moduleRepository.GetModuleZip)
+			source = astera.SourceDatabase
+			return repositoryGetFn(module, version)
 		})
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return result, nil
+	return result, source, nil
 }
@@ -2,12 +2,21 @@ package modstore
 
 import (
 	"astera"
+	"astera/breaker"
+	"astera/jobs"
+	"astera/limiter"
 	"astera/mock"
+	"astera/policy"
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tmwalaszek/weakcache"
@@ -267,7 +276,11 @@ func TestQueryLatest(t *testing.T) {
 
 	ctx := context.Background()
 
-	repositoryMock := &mock.Repository{}
+	repositoryMock := &mock.Repository{
+		GetVersionListFn: func(name string) ([]string, error) {
+			return []string{}, nil
+		},
+	}
 	vcsMock := &mock.VCS{}
 
 	weakCache := weakcache.NewWeakCache[[]byte]()
@@ -324,11 +337,17 @@ func TestQueryLatest(t *testing.T) {
 
 			d, err := proxyCache.Query(ctx, tc.query)
 			if tc.code != http.StatusOK {
-				if tc.code == http.StatusNotFound || tc.code == http.StatusGone {
+				if tc.code == http.StatusNotFound {
 					assert.EqualError(t, err, astera.ErrModuleNotFound.Error())
 					return
 				}
 
+				if tc.code == http.StatusGone {
+					assert.EqualError(t, err, astera.ErrModuleGone.Error())
+					assert.ErrorIs(t, err, astera.ErrModuleNotFound)
+					return
+				}
+
 				assert.EqualError(t, err, "request failed with status code 500")
 				return
 			}
@@ -337,3 +356,872 @@ func TestQueryLatest(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryMissRateLimited(t *testing.T) {
+	t.Parallel()
+
+	repositoryMock := &mock.Repository{
+		GetModFileFn: func(name string, version string) ([]byte, error) {
+			return nil, astera.ErrModuleNotFound
+		},
+		ModuleExistsFn: func(name string, version string) (bool, error) {
+			return false, nil
+		},
+	}
+
+	proxyCache := &ModuleStore{
+		goProxyClient: &GoProxyClient{client: &http.Client{Transport: mockRoundTripper(func(req *http.Request) *http.Response {
+			return &http.Response{
+				StatusCode: http.StatusNotFound,
+				Body:       io.NopCloser(bytes.NewBuffer(nil)),
+				Header:     make(http.Header),
+			}
+		})}},
+		moduleRepository: repositoryMock,
+		vcs:              &mock.VCS{},
+		weakCache:        weakcache.NewWeakCache[[]byte](),
+		missLimiter:      limiter.NewKeyedLimiter(0.001, 1),
+	}
+
+	ctx := astera.WithRequestInfo(context.Background(), &astera.RequestInfo{Client: "10.0.0.1"})
+
+	_, err := proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@v/v1.0.0.mod")
+	assert.ErrorIs(t, err, astera.ErrModuleNotFound)
+
+	_, err = proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@v/v1.0.1.mod")
+	var rateLimitErr *astera.RateLimitError
+	assert.ErrorAs(t, err, &rateLimitErr)
+	assert.Positive(t, rateLimitErr.RetryAfter)
+
+	// @latest goes upstream on every call and is limited the same way
+	_, err = proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@latest")
+	assert.ErrorAs(t, err, &rateLimitErr)
+
+	otherClient := astera.WithRequestInfo(context.Background(), &astera.RequestInfo{Client: "10.0.0.2"})
+	_, err = proxyCache.Query(otherClient, "github.com/tmwalaszek/module1/@v/v1.0.1.mod")
+	assert.ErrorIs(t, err, astera.ErrModuleNotFound)
+}
+
+func TestQueryLatestPublished(t *testing.T) {
+	t.Parallel()
+
+	published := []byte(`{"Version":"v1.1.0","Time":"2025-09-12T21:00:38Z"}`)
+
+	repositoryMock := &mock.Repository{
+		GetVersionListFn: func(name string) ([]string, error) {
+			return []string{"v1.0.0", "v1.2.0-rc.1", "v1.1.0"}, nil
+		},
+		GetVersionInfoFn: func(name, version string) ([]byte, error) {
+			if version != "v1.1.0" {
+				return nil, astera.ErrModuleNotFound
+			}
+
+			return published, nil
+		},
+	}
+
+	proxyCache := &ModuleStore{
+		goProxyClient: &GoProxyClient{client: &http.Client{Transport: mockRoundTripper(func(req *http.Request) *http.Response {
+			return &http.Response{
+				StatusCode: http.StatusNotFound,
+				Body:       io.NopCloser(bytes.NewBuffer(nil)),
+				Header:     make(http.Header),
+			}
+		})}},
+		moduleRepository: repositoryMock,
+		vcs:              &mock.VCS{},
+		weakCache:        weakcache.NewWeakCache[[]byte](),
+	}
+
+	d, err := proxyCache.Query(context.Background(), "example.com/internal/module/@latest")
+	assert.NoError(t, err)
+	assert.Equal(t, published, d)
+}
+
+func TestQueryQuarantined(t *testing.T) {
+	t.Parallel()
+
+	upstreamLatest := "v1.2.0"
+	var fetched []string
+
+	repositoryMock := &mock.Repository{
+		GetVersionListFn: func(name string) ([]string, error) {
+			return []string{"v1.0.0", "v1.1.0", "v1.2.0"}, nil
+		},
+		GetVersionInfoFn: func(name, version string) ([]byte, error) {
+			return []byte(`{"Version":"` + version + `"}`), nil
+		},
+		ModuleExistsFn: func(name, version string) (bool, error) {
+			return false, nil
+		},
+	}
+
+	quarantineMock := &mock.QuarantineRepository{
+		QuarantinedFn: func(name string) ([]astera.Quarantine, error) {
+			if name != "github.com/tmwalaszek/module1" {
+				return nil, nil
+			}
+
+			return []astera.Quarantine{
+				{Name: name, Version: "v1.1.0", Reason: "compromised release", By: "sec"},
+				{Name: name, Version: "v1.2.0", Reason: "wrong tag", By: "sec"},
+			}, nil
+		},
+	}
+
+	var queued []string
+	jobRepositoryMock := &mock.JobRepository{
+		EnqueueJobFn: func(job *astera.Job) (bool, error) {
+			queued = append(queued, job.Version)
+			return true, nil
+		},
+	}
+
+	proxyCache := &ModuleStore{
+		goProxyClient: &GoProxyClient{client: &http.Client{Transport: mockRoundTripper(func(req *http.Request) *http.Response {
+			fetched = append(fetched, req.URL.Path)
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString(`{"Version":"` + upstreamLatest + `"}`)),
+				Header:     make(http.Header),
+			}
+		})}},
+		moduleRepository:     repositoryMock,
+		quarantineRepository: quarantineMock,
+		vcs:                  &mock.VCS{},
+		weakCache:            weakcache.NewWeakCache[[]byte](),
+		fetchQueue:           limiter.NewFairQueue(0),
+		flights:              newFlightGroup(time.Minute, false),
+		jobs:                 jobs.New(jobRepositoryMock, nil, jobs.Config{}),
+	}
+
+	ctx := context.Background()
+
+	// the version is gone with the reason and never fetched
+	_, err := proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@v/v1.1.0.info")
+	var quarantinedErr *astera.QuarantinedError
+	assert.ErrorAs(t, err, &quarantinedErr)
+	assert.ErrorIs(t, err, astera.ErrModuleGone)
+	assert.EqualError(t, err, "github.com/tmwalaszek/module1@v1.1.0 is quarantined by sec: compromised release")
+
+	err = proxyCache.FetchModule(ctx, "github.com/tmwalaszek/module1", "v1.1.0", true)
+	assert.ErrorAs(t, err, &quarantinedErr)
+	assert.Empty(t, fetched)
+
+	d, err := proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@v/list")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.0.0", string(d))
+
+	// a quarantined upstream @latest is replaced by the newest stored version
+	d, err = proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@latest")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Version":"v1.0.0"}`, string(d))
+
+	upstreamLatest = "v1.3.0"
+	d, err = proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@latest")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Version":"v1.3.0"}`, string(d))
+
+	d, err = proxyCache.Query(ctx, "github.com/tmwalaszek/module2/@v/v1.1.0.info")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Version":"v1.1.0"}`, string(d))
+
+	// the mirror sync doesn't queue the quarantined versions
+	for _, version := range []string{"v1.0.0", "v1.1.0", "v1.2.0"} {
+		_, err = proxyCache.enqueueMirror(&astera.Job{Name: "github.com/tmwalaszek/module1", Version: version, Kind: astera.JobKindMirror})
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"v1.0.0"}, queued)
+}
+
+func TestQueryPolicy(t *testing.T) {
+	t.Parallel()
+
+	policyPath := filepath.Join(t.TempDir(), "policy.json")
+	assert.NoError(t, os.WriteFile(policyPath, []byte(`{"rules": [
+		{"name": "no-evil", "action": "deny", "module": "github.com/evil"},
+		{"name": "lib-fixed", "action": "allow", "module": "github.com/tmwalaszek/module1", "versions": ">= v1.1.0"},
+		{"name": "lib-buggy", "action": "deny", "module": "github.com/tmwalaszek/module1"}
+	]}`), 0o644))
+
+	modulePolicy, err := policy.Load(policyPath)
+	assert.NoError(t, err)
+
+	repositoryMock := &mock.Repository{
+		GetVersionListFn: func(name string) ([]string, error) {
+			return []string{"v1.0.0", "v1.1.0"}, nil
+		},
+		GetVersionInfoFn: func(name, version string) ([]byte, error) {
+			return []byte(`{"Version":"` + version + `"}`), nil
+		},
+	}
+
+	proxyCache := &ModuleStore{
+		goProxyClient: &GoProxyClient{client: &http.Client{Transport: mockRoundTripper(func(req *http.Request) *http.Response {
+			t.Errorf("unexpected upstream request %s", req.URL.Path)
+			return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(bytes.NewBuffer(nil)), Header: make(http.Header)}
+		})}},
+		moduleRepository: repositoryMock,
+		vcs:              &mock.VCS{},
+		weakCache:        weakcache.NewWeakCache[[]byte](),
+		policy:           modulePolicy,
+	}
+
+	ctx := context.Background()
+
+	var deniedErr *astera.PolicyDeniedError
+	_, err = proxyCache.Query(ctx, "github.com/evil/@v/list")
+	assert.ErrorAs(t, err, &deniedErr)
+	assert.Equal(t, "no-evil", deniedErr.Rule)
+
+	_, err = proxyCache.Query(ctx, "github.com/evil/@v/v1.0.0.zip")
+	assert.ErrorIs(t, err, astera.ErrPolicyDenied)
+
+	_, err = proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@v/v1.0.0.mod")
+	assert.ErrorAs(t, err, &deniedErr)
+	assert.Equal(t, "lib-buggy", deniedErr.Rule)
+
+	d, err := proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@v/list")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.1.0", string(d))
+
+	d, err = proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@v/v1.1.0.info")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Version":"v1.1.0"}`, string(d))
+}
+
+func TestQueryReleaseAge(t *testing.T) {
+	t.Parallel()
+
+	policyPath := filepath.Join(t.TempDir(), "policy.json")
+	assert.NoError(t, os.WriteFile(policyPath, []byte(`{"min_release_age": {"age": "72h", "exempt": "github.com/ourorg"}}`), 0o644))
+
+	modulePolicy, err := policy.Load(policyPath)
+	assert.NoError(t, err)
+
+	old := time.Now().Add(-100 * time.Hour).UTC().Format(time.RFC3339)
+	young := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	released := map[string]time.Time{}
+	for version, t := range map[string]string{"v1.0.0": old, "v1.1.0": young} {
+		released[version], _ = time.Parse(time.RFC3339, t)
+	}
+
+	repositoryMock := &mock.Repository{
+		GetVersionListFn: func(name string) ([]string, error) {
+			return []string{"v1.0.0", "v1.1.0"}, nil
+		},
+		GetVersionInfoFn: func(name, version string) ([]byte, error) {
+			if _, ok := released[version]; !ok {
+				return nil, astera.ErrModuleNotFound
+			}
+
+			return []byte(`{"Version":"` + version + `"}`), nil
+		},
+		GetModFileFn: func(name, version string) ([]byte, error) {
+			return []byte("module " + name), nil
+		},
+		GetModuleZipFn: func(name, version string) ([]byte, error) {
+			return nil, astera.ErrModuleNotFound
+		},
+		ModuleExistsFn: func(name, version string) (bool, error) {
+			return false, nil
+		},
+		InsertModuleFn: func(module *astera.Module) error {
+			t.Errorf("unexpected insert of %s@%s", module.Name, module.Version)
+			return nil
+		},
+	}
+
+	releaseLookups := 0
+	releaseMock := &mock.ReleaseRepository{
+		ReleaseTimesFn: func(name string) (map[string]time.Time, error) {
+			releaseLookups++
+			return released, nil
+		},
+		ReleaseTimeFn: func(name, version string) (time.Time, error) {
+			releaseLookups++
+			t, ok := released[version]
+			if !ok {
+				return time.Time{}, astera.ErrModuleNotFound
+			}
+
+			return t, nil
+		},
+	}
+
+	negativeCacheMock := &mock.NegativeCache{
+		InsertNegativeFn: func(name, resource string, entry astera.NegativeEntry) error {
+			t.Errorf("unexpected negative cache entry %s %s", name, resource)
+			return nil
+		},
+		GetNegativeFn: func(name, resource string) (*astera.NegativeEntry, error) {
+			return nil, nil
+		},
+	}
+
+	fetched := map[string]int{}
+	proxyCache := &ModuleStore{
+		goProxyClient: &GoProxyClient{client: &http.Client{Transport: mockRoundTripper(func(req *http.Request) *http.Response {
+			fetched[req.URL.Path]++
+
+			body := ""
+			switch req.URL.Path {
+			case "/github.com/tmwalaszek/module1/@latest":
+				body = `{"Version":"v1.1.0","Time":"` + young + `"}`
+			case "/github.com/tmwalaszek/module1/@v/v1.2.0.info":
+				body = `{"Version":"v1.2.0","Time":"` + young + `"}`
+			default:
+				t.Errorf("unexpected upstream request %s", req.URL.Path)
+			}
+
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(body)), Header: make(http.Header)}
+		})}},
+		moduleRepository:  repositoryMock,
+		vcs:               &mock.VCS{},
+		weakCache:         weakcache.NewWeakCache[[]byte](),
+		fetchQueue:        limiter.NewFairQueue(0),
+		flights:           newFlightGroup(time.Minute, false),
+		negativeCache:     newNegativeCache(negativeCacheMock, time.Hour),
+		policy:            modulePolicy,
+		releaseRepository: releaseMock,
+		releaseTimes:      newReleaseCache(),
+	}
+
+	ctx := context.Background()
+
+	d, err := proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@v/list")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.0.0", string(d))
+
+	d, err = proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@latest")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Version":"v1.0.0"}`, string(d))
+
+	d, err = proxyCache.Query(ctx, "github.com/ourorg/tool/@v/list")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.0.0\nv1.1.0", string(d))
+
+	var deniedErr *astera.PolicyDeniedError
+	_, err = proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@v/v1.1.0.mod")
+	assert.ErrorAs(t, err, &deniedErr)
+	assert.Equal(t, "min-release-age", deniedErr.Rule)
+
+	// the upstream .info of a version not stored yet decides before the module is fetched, the
+	// refusal is not remembered as missing
+	_, err = proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@v/v1.2.0.zip")
+	assert.ErrorAs(t, err, &deniedErr)
+	assert.Equal(t, map[string]int{"/github.com/tmwalaszek/module1/@latest": 1, "/github.com/tmwalaszek/module1/@v/v1.2.0.info": 1}, fetched)
+
+	// neither is it stored by the prefetch or an import
+	err = proxyCache.FetchModule(ctx, "github.com/tmwalaszek/module1", "v1.2.0", true)
+	assert.ErrorAs(t, err, &deniedErr)
+
+	err = proxyCache.checkImport(&astera.Module{Name: "github.com/tmwalaszek/module1", Version: "v1.2.0",
+		Info: []byte(`{"Version":"v1.2.0","Time":"` + young + `"}`)})
+	assert.ErrorAs(t, err, &deniedErr)
+
+	_, err = proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@v/v1.0.0.info")
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(policyPath, []byte(`{"min_release_age": {"age": "72h", "serve_exact": true}}`), 0o644))
+	assert.NoError(t, modulePolicy.Reload())
+
+	d, err = proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@v/v1.1.0.info")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Version":"v1.1.0"}`, string(d))
+
+	// the release times of the stored versions are read from the database once
+	_, err = proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@v/v1.1.0.mod")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, releaseLookups)
+
+	// the prefetch still holds it back
+	err = proxyCache.FetchModule(ctx, "github.com/tmwalaszek/module1", "v1.2.0", true)
+	assert.ErrorAs(t, err, &deniedErr)
+
+	d, err = proxyCache.Query(ctx, "github.com/tmwalaszek/module1/@v/list")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.0.0", string(d))
+	assert.Equal(t, 1, releaseLookups)
+}
+
+func TestQueryNegativeCache(t *testing.T) {
+	t.Parallel()
+
+	repositoryMock := &mock.Repository{
+		GetVersionInfoFn: func(name string, version string) ([]byte, error) {
+			return nil, astera.ErrModuleNotFound
+		},
+		GetModFileFn: func(name string, version string) ([]byte, error) {
+			return nil, astera.ErrModuleNotFound
+		},
+		GetModuleZipFn: func(name string, version string) ([]byte, error) {
+			return nil, astera.ErrModuleNotFound
+		},
+		ModuleExistsFn: func(name string, version string) (bool, error) {
+			return false, nil
+		},
+	}
+
+	stored := 0
+	negativeCacheMock := &mock.NegativeCache{
+		InsertNegativeFn: func(name, resource string, entry astera.NegativeEntry) error {
+			stored++
+			return nil
+		},
+		GetNegativeFn: func(name, resource string) (*astera.NegativeEntry, error) {
+			return nil, nil
+		},
+		PurgeNegativeFn: func(name string) (int64, error) {
+			return 0, nil
+		},
+	}
+
+	upstreamCalls := 0
+	proxyCache := &ModuleStore{
+		goProxyClient: &GoProxyClient{client: &http.Client{Transport: mockRoundTripper(func(req *http.Request) *http.Response {
+			upstreamCalls++
+
+			code := http.StatusNotFound
+			if req.URL.Path == "/github.com/tmwalaszek/module2/@v/v1.0.0.info" {
+				code = http.StatusGone
+			}
+
+			return &http.Response{
+				StatusCode: code,
+				Body:       io.NopCloser(bytes.NewBuffer(nil)),
+				Header:     make(http.Header),
+			}
+		})}},
+		moduleRepository: repositoryMock,
+		vcs:              &mock.VCS{},
+		weakCache:        weakcache.NewWeakCache[[]byte](),
+		negativeCache:    newNegativeCache(negativeCacheMock, time.Hour),
+	}
+
+	var tt = []struct {
+		query         string
+		err           error
+		upstreamCalls int
+	}{
+		{
+			query:         "github.com/tmwalaszek/module1/@v/v1.0.0.info",
+			err:           astera.ErrModuleNotFound,
+			upstreamCalls: 1,
+		},
+		{
+			query:         "github.com/tmwalaszek/module1/@v/v1.0.0.info",
+			err:           astera.ErrModuleNotFound,
+			upstreamCalls: 1,
+		},
+		// the entry covers the whole version
+		{
+			query:         "github.com/tmwalaszek/module1/@v/v1.0.0.mod",
+			err:           astera.ErrModuleNotFound,
+			upstreamCalls: 1,
+		},
+		{
+			query:         "github.com/tmwalaszek/module2/@v/v1.0.0.info",
+			err:           astera.ErrModuleGone,
+			upstreamCalls: 2,
+		},
+		{
+			query:         "github.com/tmwalaszek/module2/@v/v1.0.0.zip",
+			err:           astera.ErrModuleGone,
+			upstreamCalls: 2,
+		},
+	}
+
+	for _, tc := range tt {
+		_, err := proxyCache.Query(context.Background(), tc.query)
+		assert.EqualError(t, err, tc.err.Error())
+		assert.Equal(t, tc.upstreamCalls, upstreamCalls)
+	}
+
+	assert.Equal(t, 2, stored)
+
+	// a version quarantined during the fetch is served again once released
+	proxyCache.negativeCache.set("github.com/tmwalaszek/module3", "v1.0.0",
+		&astera.QuarantinedError{Quarantine: &astera.Quarantine{Name: "github.com/tmwalaszek/module3", Version: "v1.0.0"}})
+	assert.Equal(t, 2, stored)
+
+	_, err := proxyCache.PurgeNegativeCache("github.com/tmwalaszek/module1")
+	assert.NoError(t, err)
+
+	_, err = proxyCache.Query(context.Background(), "github.com/tmwalaszek/module1/@v/v1.0.0.info")
+	assert.ErrorIs(t, err, astera.ErrModuleNotFound)
+	assert.Equal(t, 3, upstreamCalls)
+}
+
+func TestQueryUpstreamUnavailable(t *testing.T) {
+	t.Parallel()
+
+	stored := []byte(`{"Version":"v1.1.0","Time":"2025-09-12T21:00:38Z"}`)
+
+	repositoryMock := &mock.Repository{
+		GetVersionListFn: func(name string) ([]string, error) {
+			return []string{"v1.0.0", "v1.1.0"}, nil
+		},
+		GetVersionInfoFn: func(name, version string) ([]byte, error) {
+			if name == "github.com/tmwalaszek/module1" && version == "v1.1.0" {
+				return stored, nil
+			}
+
+			return nil, astera.ErrModuleNotFound
+		},
+		ModuleExistsFn: func(name string, version string) (bool, error) {
+			return false, nil
+		},
+	}
+
+	upstreamCalls := 0
+	proxyCache := &ModuleStore{
+		goProxyClient: &GoProxyClient{
+			client: &http.Client{Transport: mockRoundTripper(func(req *http.Request) *http.Response {
+				upstreamCalls++
+
+				return &http.Response{
+					StatusCode: http.StatusBadGateway,
+					Body:       io.NopCloser(bytes.NewBuffer(nil)),
+					Header:     make(http.Header),
+				}
+			})},
+			breakers: breaker.NewSet(breaker.Config{Threshold: 2, Cooldown: time.Hour}),
+		},
+		moduleRepository: repositoryMock,
+		vcs:              &mock.VCS{},
+		weakCache:        weakcache.NewWeakCache[[]byte](),
+	}
+
+	var tt = []struct {
+		query         string
+		cache         astera.CacheStatus
+		err           string
+		upstreamCalls int
+	}{
+		{
+			query:         "github.com/tmwalaszek/module1/@latest",
+			cache:         astera.CacheStale,
+			upstreamCalls: 1,
+		},
+		{
+			query:         "github.com/tmwalaszek/module1/@v/v1.2.0.info",
+			err:           "request failed with status code 502",
+			upstreamCalls: 2,
+		},
+		{
+			query:         "github.com/tmwalaszek/module1/@v/v1.2.0.info",
+			err:           "upstream unavailable: proxy.golang.org",
+			upstreamCalls: 2,
+		},
+		{
+			query:         "github.com/tmwalaszek/module1/@latest",
+			cache:         astera.CacheStale,
+			upstreamCalls: 2,
+		},
+	}
+
+	for _, tc := range tt {
+		reqInfo := &astera.RequestInfo{}
+		ctx := astera.WithRequestInfo(context.Background(), reqInfo)
+
+		d, err := proxyCache.Query(ctx, tc.query)
+		if tc.err != "" {
+			assert.ErrorContains(t, err, tc.err)
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, stored, d)
+		}
+
+		cache, _, _ := reqInfo.Source()
+		assert.Equal(t, tc.cache, cache)
+		assert.Equal(t, tc.upstreamCalls, upstreamCalls)
+	}
+}
+
+func TestFlightGroup(t *testing.T) {
+	t.Parallel()
+
+	var tt = []struct {
+		name       string
+		background bool
+		cancelled  bool
+	}{
+		{
+			name:      "last waiter cancels the fetch",
+			cancelled: true,
+		},
+		{
+			name:       "background fetch completes",
+			background: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := newFlightGroup(time.Minute, tc.background)
+
+			started := make(chan struct{})
+			release := make(chan struct{})
+			result := make(chan error, 1)
+			fn := func(ctx context.Context) error {
+				close(started)
+
+				select {
+				case <-release:
+					result <- nil
+				case <-ctx.Done():
+					result <- ctx.Err()
+				}
+
+				return nil
+			}
+
+			first, cancelFirst := context.WithCancel(context.Background())
+			second, cancelSecond := context.WithCancel(context.Background())
+
+			firstErr := make(chan error, 1)
+			go func() { firstErr <- g.do(first, "module@v1.0.0", fn) }()
+			<-started
+
+			secondErr := make(chan error, 1)
+			go func() { secondErr <- g.do(second, "module@v1.0.0", fn) }()
+
+			assert.Eventually(t, func() bool {
+				g.mx.Lock()
+				defer g.mx.Unlock()
+
+				return g.flights["module@v1.0.0"].waiters == 2
+			}, time.Second, time.Millisecond)
+
+			// the first caller going away doesn't affect the second one
+			cancelFirst()
+			assert.ErrorIs(t, <-firstErr, context.Canceled)
+
+			select {
+			case err := <-result:
+				t.Fatalf("fetch finished early: %v", err)
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			cancelSecond()
+			assert.ErrorIs(t, <-secondErr, context.Canceled)
+
+			if tc.cancelled {
+				assert.ErrorIs(t, <-result, context.Canceled)
+			} else {
+				close(release)
+				assert.NoError(t, <-result)
+			}
+		})
+	}
+}
+
+func TestPrefetchRequirements(t *testing.T) {
+	t.Parallel()
+
+	mod := []byte(`module github.com/tmwalaszek/module1
+
+go 1.24
+
+require (
+	github.com/Masterminds/semver/v3 v3.3.1
+	github.com/stretchr/testify v1.10.0
+	golang.org/x/mod v0.27.0 // indirect
+	github.com/tmwalaszek/replaced v1.0.0
+)
+
+replace github.com/tmwalaszek/replaced => ../replaced
+`)
+
+	var inserted []*astera.Module
+	repositoryMock := &mock.Repository{
+		ModuleExistsFn: func(name string, version string) (bool, error) {
+			return name == "github.com/stretchr/testify", nil
+		},
+		InsertModuleFn: func(module *astera.Module) error {
+			inserted = append(inserted, module)
+			return nil
+		},
+	}
+
+	var queued []*astera.Job
+	jobRepositoryMock := &mock.JobRepository{
+		EnqueueJobFn: func(job *astera.Job) (bool, error) {
+			queued = append(queued, job)
+			return true, nil
+		},
+	}
+
+	var requested []string
+	proxyCache := &ModuleStore{
+		goProxyClient: &GoProxyClient{client: &http.Client{Transport: mockRoundTripper(func(req *http.Request) *http.Response {
+			requested = append(requested, req.URL.Path)
+
+			body := []byte(`{"Version":"v1.0.0"}`)
+			if strings.HasSuffix(req.URL.Path, ".mod") {
+				body = mod
+			}
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBuffer(body)),
+				Header:     make(http.Header),
+			}
+		})}},
+		moduleRepository: repositoryMock,
+		vcs:              &mock.VCS{},
+		weakCache:        weakcache.NewWeakCache[[]byte](),
+		jobs:             jobs.New(jobRepositoryMock, nil, jobs.Config{}),
+		prefetchDepth:    2,
+	}
+
+	// a prefetched module gets only .info and .mod, its requirements are one level deeper
+	err := proxyCache.runJob(context.Background(), &astera.Job{
+		Name:    "github.com/tmwalaszek/module1",
+		Version: "v1.0.0",
+		Kind:    astera.JobKindPrefetch,
+		Depth:   1,
+	})
+	assert.NoError(t, err)
+
+	// the requirements are queued in the background
+	proxyCache.fetches.Wait()
+
+	assert.Equal(t, []string{"/github.com/tmwalaszek/module1/@v/v1.0.0.info", "/github.com/tmwalaszek/module1/@v/v1.0.0.mod"}, requested)
+	assert.Len(t, inserted, 1)
+	assert.Nil(t, inserted[0].Zip)
+
+	// replace directives only apply in the main module
+	assert.Len(t, queued, 3)
+	assert.Equal(t, "github.com/!masterminds/semver/v3", queued[0].Name)
+	assert.Equal(t, "golang.org/x/mod", queued[1].Name)
+	assert.Equal(t, "github.com/tmwalaszek/replaced", queued[2].Name)
+	for _, job := range queued {
+		assert.Equal(t, astera.JobKindPrefetch, job.Kind)
+		assert.Equal(t, 2, job.Depth)
+	}
+
+	// the requirements of the deepest level are not queued
+	queued = nil
+	err = proxyCache.runJob(context.Background(), &astera.Job{
+		Name:    "github.com/tmwalaszek/module1",
+		Version: "v1.0.1",
+		Kind:    astera.JobKindPrefetch,
+		Depth:   2,
+	})
+	assert.NoError(t, err)
+	proxyCache.fetches.Wait()
+	assert.Empty(t, queued)
+}
+
+func TestAccessTracker(t *testing.T) {
+	t.Parallel()
+
+	var recorded [][]astera.Access
+	fail := true
+	repository := &mock.AccessRepository{
+		RecordAccessFn: func(accesses []astera.Access) error {
+			if fail {
+				fail = false
+				return errors.New("database is locked")
+			}
+
+			recorded = append(recorded, accesses)
+			return nil
+		},
+	}
+
+	// flushed only by close
+	tracker := newAccessTracker(repository, time.Hour)
+	tracker.record("github.com/tmwalaszek/module1", "v1.0.0")
+	tracker.record("github.com/tmwalaszek/module1", "v1.0.0")
+
+	// a failed flush is merged into the next one
+	tracker.flush()
+	assert.Empty(t, recorded)
+
+	tracker.record("github.com/tmwalaszek/module1", "v1.0.0")
+	tracker.close()
+	tracker.close()
+
+	assert.Len(t, recorded, 1)
+	assert.Len(t, recorded[0], 1)
+	assert.Equal(t, "github.com/tmwalaszek/module1", recorded[0][0].Name)
+	assert.Equal(t, int64(3), recorded[0][0].Hits)
+
+	var nilTracker *accessTracker
+	nilTracker.record("github.com/tmwalaszek/module1", "v1.0.0")
+	nilTracker.close()
+	assert.Nil(t, newAccessTracker(nil, 0))
+}
+
+func TestShutdownRefusesFetches(t *testing.T) {
+	t.Parallel()
+
+	proxyCache := &ModuleStore{}
+	assert.NoError(t, proxyCache.Shutdown(context.Background()))
+
+	err := proxyCache.fetchAndStoreModule(context.Background(), "github.com/tmwalaszek/module1", "v1.0.0", true, true, 0)
+	assert.ErrorIs(t, err, errShuttingDown)
+}
+
+func TestQueryMissJobs(t *testing.T) {
+	t.Parallel()
+
+	repositoryMock := &mock.Repository{
+		GetModFileFn: func(name string, version string) ([]byte, error) {
+			return nil, astera.ErrModuleNotFound
+		},
+		ModuleExistsFn: func(name string, version string) (bool, error) {
+			return false, nil
+		},
+		InsertModuleFn: func(module *astera.Module) error {
+			if module.Name == "github.com/tmwalaszek/module1" {
+				return errors.New("database is locked")
+			}
+
+			return nil
+		},
+	}
+
+	var queued []string
+	jobRepositoryMock := &mock.JobRepository{
+		EnqueueJobFn: func(job *astera.Job) (bool, error) {
+			queued = append(queued, job.Name)
+			return true, nil
+		},
+	}
+
+	proxyCache := &ModuleStore{
+		goProxyClient: &GoProxyClient{client: &http.Client{Transport: mockRoundTripper(func(req *http.Request) *http.Response {
+			code := http.StatusOK
+			if strings.HasPrefix(req.URL.Path, "/github.com/tmwalaszek/module2/") {
+				code = http.StatusNotFound
+			}
+
+			return &http.Response{StatusCode: code, Body: io.NopCloser(bytes.NewBufferString("{}")), Header: make(http.Header)}
+		})}},
+		moduleRepository: repositoryMock,
+		vcs:              &mock.VCS{},
+		weakCache:        weakcache.NewWeakCache[[]byte](),
+		jobs:             jobs.New(jobRepositoryMock, nil, jobs.Config{}),
+	}
+
+	// a successful miss is not recorded as a job
+	_, err := proxyCache.Query(context.Background(), "github.com/tmwalaszek/module3/@v/v1.0.0.mod")
+	assert.NoError(t, err)
+
+	// module1 fails to be stored and is retried in the background, upstream doesn't have module2
+	_, err = proxyCache.Query(context.Background(), "github.com/tmwalaszek/module1/@v/v1.0.0.mod")
+	assert.Error(t, err)
+
+	_, err = proxyCache.Query(context.Background(), "github.com/tmwalaszek/module2/@v/v1.0.0.mod")
+	assert.ErrorIs(t, err, astera.ErrModuleNotFound)
+
+	assert.Equal(t, []string{"github.com/tmwalaszek/module1"}, queued)
+}
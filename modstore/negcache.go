@@ -0,0 +1,139 @@
+package modstore
+
+import (
+	"astera"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const negativeCacheMaxEntries = 100_000
+
+// negativeCache remembers the versions and @latest upstream doesn't have, so the go command probing
+// every prefix of an import path doesn't hit the internet on every build. The entries are
+// kept in memory and in the database to survive restarts.
+// A nil *negativeCache remembers nothing.
+type negativeCache struct {
+	repository astera.NegativeCacheRepository
+	ttl        time.Duration
+
+	mx      sync.Mutex
+	entries map[string]astera.NegativeEntry
+}
+
+func newNegativeCache(repository astera.NegativeCacheRepository, ttl time.Duration) *negativeCache {
+	if repository == nil || ttl <= 0 {
+		return nil
+	}
+
+	return &negativeCache{
+		repository: repository,
+		ttl:        ttl,
+		entries:    make(map[string]astera.NegativeEntry),
+	}
+}
+
+func negativeKey(module, resource string) string {
+	return module + "/@v/" + resource
+}
+
+// get returns the entry when upstream is known not to have the resource and where the entry was found
+func (n *negativeCache) get(module, resource string) (*astera.NegativeEntry, string) {
+	if n == nil {
+		return nil, ""
+	}
+
+	key := negativeKey(module, resource)
+	now := time.Now()
+
+	n.mx.Lock()
+	entry, ok := n.entries[key]
+	if ok && !now.Before(entry.ExpiresAt) {
+		delete(n.entries, key)
+		ok = false
+	}
+	n.mx.Unlock()
+
+	source := astera.SourceMemory
+	if !ok {
+		stored, err := n.repository.GetNegative(module, resource)
+		if err != nil {
+			slog.Error("negative cache lookup failed", "module", module, "resource", resource, "err", err)
+			return nil, ""
+		}
+
+		if stored == nil {
+			return nil, ""
+		}
+
+		entry = *stored
+		source = astera.SourceDatabase
+		n.remember(key, entry)
+	}
+
+	return &entry, source
+}
+
+// set records err if it tells upstream doesn't have the resource. A refusal of the policy or the
+// quarantine is never recorded, a version too young or released is served again right away.
+func (n *negativeCache) set(module, resource string, err error) {
+	if n == nil || !errors.Is(err, astera.ErrModuleNotFound) || errors.As(err, new(*astera.QuarantinedError)) {
+		return
+	}
+
+	entry := astera.NegativeEntry{
+		Gone:      errors.Is(err, astera.ErrModuleGone),
+		ExpiresAt: time.Now().Add(n.ttl),
+	}
+
+	n.remember(negativeKey(module, resource), entry)
+
+	err = n.repository.InsertNegative(module, resource, entry)
+	if err != nil {
+		slog.Error("failed to store negative cache entry", "module", module, "resource", resource, "err", err)
+	}
+}
+
+func (n *negativeCache) remember(key string, entry astera.NegativeEntry) {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+
+	if len(n.entries) >= negativeCacheMaxEntries {
+		now := time.Now()
+		for k, e := range n.entries {
+			if !now.Before(e.ExpiresAt) {
+				delete(n.entries, k)
+			}
+		}
+
+		// still full, the database keeps the entries anyway
+		if len(n.entries) >= negativeCacheMaxEntries {
+			clear(n.entries)
+		}
+	}
+
+	n.entries[key] = entry
+}
+
+func (n *negativeCache) purge(module string) (int64, error) {
+	if n == nil {
+		return 0, nil
+	}
+
+	n.mx.Lock()
+	if module == "" {
+		clear(n.entries)
+	} else {
+		prefix := module + "/@v/"
+		for k := range n.entries {
+			if strings.HasPrefix(k, prefix) {
+				delete(n.entries, k)
+			}
+		}
+	}
+	n.mx.Unlock()
+
+	return n.repository.PurgeNegative(module)
+}
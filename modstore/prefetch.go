@@ -0,0 +1,77 @@
+package modstore
+
+import (
+	"astera"
+	"log/slog"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	xmod "golang.org/x/mod/module"
+)
+
+// startPrefetch runs prefetchRequirements in the background, the fetch storing the module doesn't wait
+// for its queries. Shutdown waits for it like for a fetch.
+func (c *ModuleStore) startPrefetch(module, version string, mod []byte, depth int) {
+	if c.jobs == nil || depth > c.prefetchDepth || !c.startFetch() {
+		return
+	}
+
+	go func() {
+		defer c.fetches.Done()
+		c.prefetchRequirements(module, version, mod, depth)
+	}()
+}
+
+// prefetchRequirements queues the modules required by the go.mod of module@version, the go command
+// is going to ask for them next. depth is the distance of the requirements from the requested module.
+func (c *ModuleStore) prefetchRequirements(module, version string, mod []byte, depth int) {
+	if c.jobs == nil || depth > c.prefetchDepth {
+		return
+	}
+
+	f, err := modfile.ParseLax(module+"@"+version+"/go.mod", mod, nil)
+	if err != nil {
+		slog.Warn("failed to parse go.mod for prefetch", "module", module, "version", version, "err", err)
+		return
+	}
+
+	// the replace directives of a dependency don't apply to the builds using it, all the
+	// requirements are fetched
+	queued := 0
+	for _, r := range f.Require {
+		name, err := xmod.EscapePath(r.Mod.Path)
+		if err != nil {
+			continue
+		}
+
+		version, err := xmod.EscapeVersion(r.Mod.Version)
+		if err != nil {
+			continue
+		}
+
+		exists, err := c.moduleRepository.ModuleExists(name, version)
+		if err != nil || exists {
+			continue
+		}
+
+		added, err := c.jobs.Enqueue(&astera.Job{
+			Name:        name,
+			Version:     version,
+			Kind:        astera.JobKindPrefetch,
+			Depth:       depth,
+			NextAttempt: time.Now(),
+		})
+		if err != nil {
+			slog.Error("failed to queue prefetch", "module", name, "version", version, "err", err)
+			continue
+		}
+
+		if added {
+			queued++
+		}
+	}
+
+	if queued > 0 {
+		slog.Info("queued requirements for prefetch", "module", module, "version", version, "depth", depth, "queued", queued)
+	}
+}
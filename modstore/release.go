@@ -0,0 +1,49 @@
+package modstore
+
+import (
+	"sync"
+	"time"
+)
+
+const releaseCacheMaxEntries = 100_000
+
+// releaseCache remembers the release times of the stored versions, they never change once a version
+// is stored, so a cache hit checks the minimum release age without reading the database.
+// A nil *releaseCache remembers nothing.
+type releaseCache struct {
+	mx    sync.Mutex
+	times map[string]time.Time
+}
+
+func newReleaseCache() *releaseCache {
+	return &releaseCache{times: make(map[string]time.Time)}
+}
+
+func (r *releaseCache) get(module, version string) (time.Time, bool) {
+	if r == nil {
+		return time.Time{}, false
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	t, ok := r.times[module+"@"+version]
+
+	return t, ok
+}
+
+func (r *releaseCache) set(module, version string, released time.Time) {
+	if r == nil {
+		return
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	// the database keeps them anyway
+	if len(r.times) >= releaseCacheMaxEntries {
+		clear(r.times)
+	}
+
+	r.times[module+"@"+version] = released
+}
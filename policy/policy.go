@@ -0,0 +1,393 @@
+package policy
+
+import (
+	"astera"
+	"astera/constraint"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/mod/module"
+)
+
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+
+	// defaultRule names the decision of the default action
+	defaultRule = "default"
+	// minReleaseAgeRule names the decision of the minimum release age
+	minReleaseAgeRule = "min-release-age"
+
+	defaultWatchInterval = 5 * time.Second
+)
+
+// Rule matches module versions, the first rule matching a version decides if it is served
+type Rule struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	// Module is a comma separated list of module path globs in the GOPRIVATE syntax, empty matches every module
+	Module string `json:"module"`
+	// Versions selects the versions, empty matches every version
+	Versions constraint.Constraint `json:"versions"`
+	// Incompatible restricts the rule to the +incompatible versions
+	Incompatible bool `json:"incompatible"`
+}
+
+func (r *Rule) matchModule(modulePath string) bool {
+	return r.Module == "" || module.MatchPrefixPatterns(r.Module, modulePath)
+}
+
+// versioned rules decide only single versions
+func (r *Rule) versioned() bool {
+	return !r.Versions.IsEmpty() || r.Incompatible
+}
+
+func (r *Rule) matchVersion(version string) bool {
+	if r.Incompatible && !strings.HasSuffix(version, "+incompatible") {
+		return false
+	}
+
+	return r.Versions.Match(version)
+}
+
+// Duration is a time.Duration written as "72h"
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
+
+// MinReleaseAge holds back the versions released upstream too recently
+type MinReleaseAge struct {
+	Age Duration `json:"age"`
+	// Exempt is a comma separated list of module path globs in the GOPRIVATE syntax
+	Exempt string `json:"exempt,omitempty"`
+	// ServeExact serves the young versions requested explicitly, they stay hidden from list and @latest
+	ServeExact bool `json:"serve_exact"`
+}
+
+type Policy struct {
+	// Default is the action when no rule matches, allow when empty
+	Default string `json:"default"`
+	Rules   []Rule `json:"rules"`
+	// MinReleaseAge is checked once the rules allow a version
+	MinReleaseAge *MinReleaseAge `json:"min_release_age,omitempty"`
+}
+
+// Parse reads and validates the JSON policy
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	err := json.Unmarshal(data, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Default == "" {
+		p.Default = ActionAllow
+	}
+
+	if p.Default != ActionAllow && p.Default != ActionDeny {
+		return nil, fmt.Errorf("invalid default action %q", p.Default)
+	}
+
+	names := make(map[string]bool, len(p.Rules))
+	for i, r := range p.Rules {
+		if r.Name == "" || r.Name == defaultRule {
+			return nil, fmt.Errorf("rule %d: a rule needs a name other than %q", i+1, defaultRule)
+		}
+
+		if names[r.Name] {
+			return nil, fmt.Errorf("rule %q: duplicate name", r.Name)
+		}
+
+		names[r.Name] = true
+
+		if r.Action != ActionAllow && r.Action != ActionDeny {
+			return nil, fmt.Errorf("rule %q: invalid action %q", r.Name, r.Action)
+		}
+
+		for pattern := range strings.SplitSeq(r.Module, ",") {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %q: invalid module pattern %q", r.Name, pattern)
+			}
+		}
+	}
+
+	if a := p.MinReleaseAge; a != nil {
+		if a.Age < 0 {
+			return nil, fmt.Errorf("min_release_age: negative age %s", time.Duration(a.Age))
+		}
+
+		for pattern := range strings.SplitSeq(a.Exempt, ",") {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("min_release_age: invalid exempt pattern %q", pattern)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// CheckModule decides the requests without a version, list and @latest. A rule with version
+// conditions can't decide them: a matching allow lets the module through and leaves its versions
+// to CheckVersion, a matching deny is skipped.
+func (p *Policy) CheckModule(modulePath string) error {
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if !r.matchModule(modulePath) || (r.versioned() && r.Action == ActionDeny) {
+			continue
+		}
+
+		return p.decide(r.Action, r.Name, modulePath, "")
+	}
+
+	return p.decide(p.Default, defaultRule, modulePath, "")
+}
+
+// CheckVersion returns a *astera.PolicyDeniedError when the version is denied, the version is unescaped
+func (p *Policy) CheckVersion(modulePath, version string) error {
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.matchModule(modulePath) && r.matchVersion(version) {
+			return p.decide(r.Action, r.Name, modulePath, version)
+		}
+	}
+
+	return p.decide(p.Default, defaultRule, modulePath, version)
+}
+
+// ChecksReleaseAge tells if the release time of the versions of the module matters
+func (p *Policy) ChecksReleaseAge(modulePath string) bool {
+	a := p.MinReleaseAge
+	return a != nil && a.Age > 0 && (a.Exempt == "" || !module.MatchPrefixPatterns(a.Exempt, modulePath))
+}
+
+// CheckRelease returns a *astera.PolicyDeniedError when the version was released less than the
+// minimum release age ago. exact is set for the requests of the version itself, which are served
+// with ServeExact. An unknown, zero, release time passes.
+func (p *Policy) CheckRelease(modulePath, version string, released time.Time, exact bool) error {
+	if released.IsZero() || !p.ChecksReleaseAge(modulePath) || (exact && p.MinReleaseAge.ServeExact) {
+		return nil
+	}
+
+	age := time.Since(released)
+	if age >= time.Duration(p.MinReleaseAge.Age) {
+		return nil
+	}
+
+	return &astera.PolicyDeniedError{Module: modulePath, Version: version, Rule: minReleaseAgeRule,
+		Reason: fmt.Sprintf("released %s ago, less than %s",
+			max(age, 0).Round(time.Second), time.Duration(p.MinReleaseAge.Age))}
+}
+
+func (p *Policy) decide(action, rule, modulePath, version string) error {
+	if action == ActionAllow {
+		return nil
+	}
+
+	return &astera.PolicyDeniedError{Module: modulePath, Version: version, Rule: rule}
+}
+
+// Report describes the policy in use
+type Report struct {
+	Path     string    `json:"path"`
+	LoadedAt time.Time `json:"loaded_at"`
+	Policy   *Policy   `json:"policy"`
+	// LastError is the failure of the last reload, the previous policy stays in use
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Engine evaluates the policy file and reloads it when it changes, a broken file keeps the
+// previous policy in use. A nil *Engine allows everything.
+type Engine struct {
+	path string
+
+	policy atomic.Pointer[Policy]
+
+	// serializes the reloads
+	mx        sync.Mutex
+	modTime   time.Time
+	loadedAt  time.Time
+	lastError string
+
+	cancel chan struct{}
+	done   chan struct{}
+}
+
+// Load reads the policy file, it fails when the file is invalid
+func Load(path string) (*Engine, error) {
+	e := &Engine{path: path}
+
+	err := e.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Reload reads the policy file again, on failure the previous policy stays in use
+func (e *Engine) Reload() error {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	stat, err := os.Stat(e.path)
+	if err != nil {
+		e.lastError = err.Error()
+		return err
+	}
+
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		e.lastError = err.Error()
+		return err
+	}
+
+	// a broken file is not read again until it changes
+	e.modTime = stat.ModTime()
+
+	p, err := Parse(data)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", e.path, err)
+		e.lastError = err.Error()
+		return err
+	}
+
+	e.policy.Store(p)
+	e.loadedAt = time.Now()
+	e.lastError = ""
+
+	return nil
+}
+
+// Watch reloads the policy file when its modification time changes, until Stop
+func (e *Engine) Watch(interval time.Duration) {
+	if e == nil {
+		return
+	}
+
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	e.cancel = make(chan struct{})
+	e.done = make(chan struct{})
+
+	go func() {
+		defer close(e.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-e.cancel:
+				return
+			case <-ticker.C:
+			}
+
+			stat, err := os.Stat(e.path)
+			if err != nil {
+				continue
+			}
+
+			e.mx.Lock()
+			changed := !stat.ModTime().Equal(e.modTime)
+			e.mx.Unlock()
+
+			if changed {
+				e.reloadAndLog()
+			}
+		}
+	}()
+}
+
+// reloadAndLog reloads the policy for the watcher and SIGHUP
+func (e *Engine) reloadAndLog() {
+	err := e.Reload()
+	if err != nil {
+		slog.Error("failed to reload the policy, keeping the previous one", "err", err)
+		return
+	}
+
+	slog.Info("policy reloaded", "path", e.path, "rules", len(e.policy.Load().Rules))
+}
+
+// ReloadOnSignal reloads the policy on every value received from the channel, typically SIGHUP
+func (e *Engine) ReloadOnSignal(signals <-chan os.Signal) {
+	if e == nil {
+		return
+	}
+
+	go func() {
+		for range signals {
+			e.reloadAndLog()
+		}
+	}()
+}
+
+func (e *Engine) Stop() {
+	if e == nil || e.cancel == nil {
+		return
+	}
+
+	close(e.cancel)
+	<-e.done
+}
+
+func (e *Engine) CheckModule(modulePath string) error {
+	if e == nil {
+		return nil
+	}
+
+	return e.policy.Load().CheckModule(modulePath)
+}
+
+func (e *Engine) CheckVersion(modulePath, version string) error {
+	if e == nil {
+		return nil
+	}
+
+	return e.policy.Load().CheckVersion(modulePath, version)
+}
+
+func (e *Engine) ChecksReleaseAge(modulePath string) bool {
+	if e == nil {
+		return false
+	}
+
+	return e.policy.Load().ChecksReleaseAge(modulePath)
+}
+
+func (e *Engine) CheckRelease(modulePath, version string, released time.Time, exact bool) error {
+	if e == nil {
+		return nil
+	}
+
+	return e.policy.Load().CheckRelease(modulePath, version, released, exact)
+}
+
+func (e *Engine) Report() Report {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	return Report{Path: e.path, LoadedAt: e.loadedAt, Policy: e.policy.Load(), LastError: e.lastError}
+}
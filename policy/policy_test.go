@@ -0,0 +1,166 @@
+package policy
+
+import (
+	"astera"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `{
+	"rules": [
+		{"name": "no-evil", "action": "deny", "module": "github.com/evil/*,github.com/worse"},
+		{"name": "no-incompatible", "action": "deny", "incompatible": true},
+		{"name": "lib-fixed", "action": "allow", "module": "github.com/foo/lib", "versions": ">= v1.2.0"},
+		{"name": "lib-buggy", "action": "deny", "module": "github.com/foo/lib"}
+	]
+}`
+
+func TestPolicy(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse([]byte(testPolicy))
+	require.NoError(t, err)
+
+	tests := []struct {
+		module  string
+		version string
+		rule    string
+	}{
+		{module: "github.com/evil/pkg", rule: "no-evil"},
+		{module: "github.com/evil/pkg", version: "v1.0.0", rule: "no-evil"},
+		{module: "github.com/worse/sub", version: "v1.0.0", rule: "no-evil"},
+		{module: "github.com/evilish/pkg", version: "v1.0.0"},
+		{module: "github.com/docker/docker"},
+		{module: "github.com/docker/docker", version: "v20.10.0+incompatible", rule: "no-incompatible"},
+		{module: "github.com/docker/docker", version: "v20.10.0"},
+		{module: "github.com/foo/lib"},
+		{module: "github.com/foo/lib", version: "v1.1.9", rule: "lib-buggy"},
+		{module: "github.com/foo/lib", version: "v1.2.0"},
+		{module: "github.com/foo/lib", version: "v2.0.0-rc.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.module+"@"+tt.version, func(t *testing.T) {
+			err := p.CheckModule(tt.module)
+			if tt.version != "" {
+				err = p.CheckVersion(tt.module, tt.version)
+			}
+
+			if tt.rule == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			var deniedErr *astera.PolicyDeniedError
+			require.ErrorAs(t, err, &deniedErr)
+			require.ErrorIs(t, err, astera.ErrPolicyDenied)
+			require.Equal(t, tt.rule, deniedErr.Rule)
+		})
+	}
+
+	p, err = Parse([]byte(`{"default": "deny", "rules": [{"name": "ours", "action": "allow", "module": "github.com/ourorg"}]}`))
+	require.NoError(t, err)
+	require.NoError(t, p.CheckVersion("github.com/ourorg/tool", "v1.0.0"))
+	require.EqualError(t, p.CheckVersion("github.com/other/tool", "v1.0.0"), `github.com/other/tool@v1.0.0: denied by policy rule "default"`)
+
+	for _, invalid := range []string{
+		`{"default": "maybe"}`,
+		`{"rules": [{"action": "deny"}]}`,
+		`{"rules": [{"name": "a", "action": "deny"}, {"name": "a", "action": "allow"}]}`,
+		`{"rules": [{"name": "a", "action": "block"}]}`,
+		`{"rules": [{"name": "a", "action": "deny", "module": "github.com/[evil"}]}`,
+		`{"rules": [{"name": "a", "action": "deny", "versions": ">= banana"}]}`,
+		`{"min_release_age": {"age": "3 days"}}`,
+		`{"min_release_age": {"age": "-1h"}}`,
+		`{"min_release_age": {"age": "72h", "exempt": "github.com/[ours"}}`,
+	} {
+		_, err = Parse([]byte(invalid))
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestMinReleaseAge(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse([]byte(`{"min_release_age": {"age": "72h", "exempt": "github.com/ourorg/*"}}`))
+	require.NoError(t, err)
+
+	now := time.Now()
+	tests := []struct {
+		name     string
+		module   string
+		released time.Time
+		exact    bool
+		denied   bool
+	}{
+		{name: "young", module: "github.com/foo/lib", released: now.Add(-time.Hour), denied: true},
+		{name: "young exact", module: "github.com/foo/lib", released: now.Add(-time.Hour), exact: true, denied: true},
+		{name: "old", module: "github.com/foo/lib", released: now.Add(-73 * time.Hour)},
+		{name: "unknown", module: "github.com/foo/lib"},
+		{name: "exempt", module: "github.com/ourorg/tool", released: now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.CheckRelease(tt.module, "v1.0.0", tt.released, tt.exact)
+			if !tt.denied {
+				require.NoError(t, err)
+				return
+			}
+
+			var deniedErr *astera.PolicyDeniedError
+			require.ErrorAs(t, err, &deniedErr)
+			require.Equal(t, minReleaseAgeRule, deniedErr.Rule)
+		})
+	}
+
+	require.True(t, p.ChecksReleaseAge("github.com/foo/lib"))
+	require.False(t, p.ChecksReleaseAge("github.com/ourorg/tool"))
+
+	p.MinReleaseAge.ServeExact = true
+	require.NoError(t, p.CheckRelease("github.com/foo/lib", "v1.0.0", now, true))
+	require.Error(t, p.CheckRelease("github.com/foo/lib", "v1.0.0", now, false))
+
+	var e *Engine
+	require.False(t, e.ChecksReleaseAge("github.com/foo/lib"))
+	require.NoError(t, e.CheckRelease("github.com/foo/lib", "v1.0.0", now, true))
+}
+
+func TestEngineReload(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(path, []byte(testPolicy), 0o644))
+
+	e, err := Load(path)
+	require.NoError(t, err)
+	require.Error(t, e.CheckModule("github.com/evil/pkg"))
+
+	e.Watch(10 * time.Millisecond)
+	defer e.Stop()
+
+	// a broken file keeps the previous policy
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules": [`), 0o644))
+	require.Error(t, e.Reload())
+	require.Error(t, e.CheckModule("github.com/evil/pkg"))
+	require.NotEmpty(t, e.Report().LastError)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules": []}`), 0o644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	require.Eventually(t, func() bool {
+		return e.CheckModule("github.com/evil/pkg") == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Empty(t, e.Report().LastError)
+
+	var nilEngine *Engine
+	require.NoError(t, nilEngine.CheckVersion("github.com/evil/pkg", "v1.0.0"))
+	nilEngine.Watch(time.Second)
+	nilEngine.Stop()
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.json"))
+	require.Error(t, err)
+}
@@ -0,0 +1,184 @@
+package publish
+
+import (
+	"archive/zip"
+	"astera"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	xmod "golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/mod/sumdb/dirhash"
+	xzip "golang.org/x/mod/zip"
+)
+
+// FromDir builds the module zip from the source directory like `go mod download` would see it.
+// When modulePath is empty it is read from the go.mod in dir.
+func FromDir(dir, modulePath, version string) (*astera.Module, error) {
+	if modulePath == "" {
+		modBody, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read go.mod: %w", err)
+		}
+
+		modulePath = modfile.ModulePath(modBody)
+		if modulePath == "" {
+			return nil, fmt.Errorf("no module directive in %s", filepath.Join(dir, "go.mod"))
+		}
+	}
+
+	mv, err := moduleVersion(modulePath, version)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "publish-*.zip")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	err = xzip.CreateFromDir(tmp, mv, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to zip module: %w", err)
+	}
+
+	return fromZipFile(mv, tmp.Name())
+}
+
+// FromZip validates an uploaded module zip and builds the module from it
+func FromZip(modulePath, version string, r io.Reader) (*astera.Module, error) {
+	mv, err := moduleVersion(modulePath, version)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "publish-*.zip")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	_, err = io.Copy(tmp, io.LimitReader(r, xzip.MaxZipFile+1))
+	if err != nil {
+		return nil, err
+	}
+
+	return fromZipFile(mv, tmp.Name())
+}
+
+// Publish inserts the module refusing to overwrite an existing version. A stored partial module is
+// refused too, its zip must not come from a publish. Two racing publishes of the same version are
+// told apart by the insert.
+func Publish(repo astera.ModuleRepository, m *astera.Module) error {
+	exists, err := repo.ModuleExists(m.Name, m.Version)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return fmt.Errorf("%w: %s@%s", astera.ErrModuleAlreadyExists, m.Name, m.Version)
+	}
+
+	return repo.InsertModule(m)
+}
+
+func moduleVersion(modulePath, version string) (xmod.Version, error) {
+	if !semver.IsValid(version) || semver.Canonical(version) != version {
+		return xmod.Version{}, fmt.Errorf("%w: version %q is not canonical semver", astera.ErrInvalidResource, version)
+	}
+
+	err := xmod.Check(modulePath, version)
+	if err != nil {
+		return xmod.Version{}, fmt.Errorf("%w: %w", astera.ErrInvalidResource, err)
+	}
+
+	return xmod.Version{Path: modulePath, Version: version}, nil
+}
+
+func fromZipFile(mv xmod.Version, zipFile string) (*astera.Module, error) {
+	_, err := xzip.CheckZip(mv, zipFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", astera.ErrInvalidResource, err)
+	}
+
+	zipHash, err := dirhash.HashZip(zipFile, dirhash.DefaultHash)
+	if err != nil {
+		return nil, err
+	}
+
+	zipBody, err := os.ReadFile(zipFile)
+	if err != nil {
+		return nil, err
+	}
+
+	modBody, err := readGoMod(mv, zipBody)
+	if err != nil {
+		return nil, err
+	}
+
+	// no Origin, there is no VCS behind a published module
+	info, err := json.Marshal(&struct {
+		Version string
+		Time    string
+	}{
+		Version: mv.Version,
+		Time:    time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// stored escaped, the same way as the paths in the proxy requests
+	name, err := xmod.EscapePath(mv.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := xmod.EscapeVersion(mv.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	return &astera.Module{
+		Name:    name,
+		Source:  astera.ModuleSourcePublished,
+		Version: version,
+		ZipHash: zipHash,
+		Info:    info,
+		Mod:     modBody,
+		Zip:     zipBody,
+	}, nil
+}
+
+// readGoMod returns the go.mod from the zip, modules without one get the synthesized
+// go.mod the go command would use
+func readGoMod(mv xmod.Version, zipBody []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(zipBody), int64(len(zipBody)))
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := zr.Open(mv.Path + "@" + mv.Version + "/go.mod")
+	if os.IsNotExist(err) {
+		return []byte(fmt.Sprintf("module %s\n", modfile.AutoQuote(mv.Path))), nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
@@ -0,0 +1,98 @@
+package publish
+
+import (
+	"astera"
+	"astera/mock"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/internal/Lib\n\ngo 1.25\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib.go"), []byte("package lib\n"), 0o644))
+
+	var tt = []struct {
+		name       string
+		modulePath string
+		version    string
+		err        error
+	}{
+		{
+			name:    "module path from go.mod",
+			version: "v1.0.0",
+		},
+		{
+			name:    "not canonical version",
+			version: "v1.0",
+			err:     astera.ErrInvalidResource,
+		},
+		{
+			name:    "major version without suffix",
+			version: "v2.0.0",
+			err:     astera.ErrInvalidResource,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := FromDir(dir, tc.modulePath, tc.version)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, "example.com/internal/!lib", m.Name)
+			require.Equal(t, tc.version, m.Version)
+			require.Equal(t, astera.ModuleSourcePublished, m.Source)
+			require.Equal(t, "module example.com/internal/Lib\n\ngo 1.25\n", string(m.Mod))
+			require.Contains(t, m.ZipHash, "h1:")
+
+			// the same zip uploaded through the admin API gives the same hash
+			uploaded, err := FromZip("example.com/internal/Lib", tc.version, bytes.NewReader(m.Zip))
+			require.NoError(t, err)
+			require.Equal(t, m.ZipHash, uploaded.ZipHash)
+
+			// but not under another module path
+			_, err = FromZip("example.com/internal/other", tc.version, bytes.NewReader(m.Zip))
+			require.ErrorIs(t, err, astera.ErrInvalidResource)
+		})
+	}
+}
+
+func TestPublish(t *testing.T) {
+	t.Parallel()
+
+	inserted := 0
+	repositoryMock := &mock.Repository{
+		ModuleExistsFn: func(name string, version string) (bool, error) {
+			return version == "v1.0.0", nil
+		},
+		InsertModuleFn: func(module *astera.Module) error {
+			// v1.2.0 is published concurrently after the check
+			if module.Version == "v1.2.0" {
+				return astera.ErrModuleAlreadyExists
+			}
+
+			inserted++
+			return nil
+		},
+	}
+
+	err := Publish(repositoryMock, &astera.Module{Name: "example.com/lib", Version: "v1.0.0"})
+	require.ErrorIs(t, err, astera.ErrModuleAlreadyExists)
+
+	err = Publish(repositoryMock, &astera.Module{Name: "example.com/lib", Version: "v1.1.0"})
+	require.NoError(t, err)
+	require.Equal(t, 1, inserted)
+
+	err = Publish(repositoryMock, &astera.Module{Name: "example.com/lib", Version: "v1.2.0"})
+	require.ErrorIs(t, err, astera.ErrModuleAlreadyExists)
+}
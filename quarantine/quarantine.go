@@ -0,0 +1,146 @@
+package quarantine
+
+import (
+	"astera"
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+const defaultReloadInterval = 30 * time.Second
+
+// Cache keeps the quarantined versions of the repository in memory, so checking a version never queries
+// the database. Quarantine and Release go through the repository and reload the cache right away, the
+// changes made by other processes (astera quarantine on the same database) are picked up by the reload
+// every interval once Start is called.
+type Cache struct {
+	repository astera.QuarantineRepository
+
+	// Purge forgets the negative cache entries of a module when one of its versions is released, set it before use
+	Purge func(module string) (int64, error)
+
+	// reloadMx orders the reloads, one started after a change always wins over one started before it
+	reloadMx sync.Mutex
+
+	mx       sync.RWMutex
+	byModule map[string][]astera.Quarantine
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New loads the quarantined versions of the repository
+func New(repository astera.QuarantineRepository) (*Cache, error) {
+	c := &Cache{repository: repository}
+
+	err := c.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Reload reads the quarantined versions from the repository again
+func (c *Cache) Reload() error {
+	c.reloadMx.Lock()
+	defer c.reloadMx.Unlock()
+
+	list, err := c.repository.ListQuarantines()
+	if err != nil {
+		return err
+	}
+
+	byModule := make(map[string][]astera.Quarantine)
+	for _, q := range list {
+		byModule[q.Name] = append(byModule[q.Name], q)
+	}
+
+	c.mx.Lock()
+	c.byModule = byModule
+	c.mx.Unlock()
+
+	return nil
+}
+
+// Start reloads the cache every interval until Stop, 30s when interval is zero
+func (c *Cache) Start(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+
+	go func() {
+		defer close(c.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := c.Reload(); err != nil {
+				slog.Error("failed to reload the quarantined versions", "err", err)
+			}
+		}
+	}()
+}
+
+func (c *Cache) Stop() {
+	if c.cancel == nil {
+		return
+	}
+
+	c.cancel()
+	<-c.done
+}
+
+func (c *Cache) Quarantine(q *astera.Quarantine) error {
+	err := c.repository.Quarantine(q)
+	if err != nil {
+		return err
+	}
+
+	return c.Reload()
+}
+
+func (c *Cache) Release(name, version, by, reason string) (bool, error) {
+	released, err := c.repository.Release(name, version, by, reason)
+	if err != nil || !released {
+		return released, err
+	}
+
+	if c.Purge != nil {
+		_, err = c.Purge(name)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return true, c.Reload()
+}
+
+// Quarantined returns the quarantined versions of the module from memory
+func (c *Cache) Quarantined(name string) ([]astera.Quarantine, error) {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+
+	return slices.Clone(c.byModule[name]), nil
+}
+
+func (c *Cache) ListQuarantines() ([]astera.Quarantine, error) {
+	return c.repository.ListQuarantines()
+}
+
+func (c *Cache) QuarantineAudit(name string, limit int) ([]astera.QuarantineEvent, error) {
+	return c.repository.QuarantineAudit(name, limit)
+}
@@ -0,0 +1,91 @@
+package quarantine
+
+import (
+	"astera"
+	"astera/mock"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	stored := map[string]astera.Quarantine{}
+	loads := 0
+
+	repositoryMock := &mock.QuarantineRepository{
+		QuarantineFn: func(q *astera.Quarantine) error {
+			stored[q.Name+"@"+q.Version] = *q
+			return nil
+		},
+		ReleaseFn: func(name, version, by, reason string) (bool, error) {
+			_, ok := stored[name+"@"+version]
+			delete(stored, name+"@"+version)
+			return ok, nil
+		},
+		QuarantinedFn: func(name string) ([]astera.Quarantine, error) {
+			t.Fatal("the cache must not query the repository")
+			return nil, nil
+		},
+		ListQuarantinesFn: func() ([]astera.Quarantine, error) {
+			loads++
+
+			list := make([]astera.Quarantine, 0, len(stored))
+			for _, q := range stored {
+				list = append(list, q)
+			}
+
+			return list, nil
+		},
+	}
+
+	stored["github.com/tmwalaszek/module1@v1.0.0"] = astera.Quarantine{Name: "github.com/tmwalaszek/module1", Version: "v1.0.0"}
+
+	c, err := New(repositoryMock)
+	require.NoError(t, err)
+	require.Equal(t, 1, loads)
+
+	var purged []string
+	c.Purge = func(module string) (int64, error) {
+		purged = append(purged, module)
+		return 0, nil
+	}
+
+	// the checks are answered from memory
+	for range 3 {
+		quarantined, err := c.Quarantined("github.com/tmwalaszek/module1")
+		require.NoError(t, err)
+		require.Len(t, quarantined, 1)
+	}
+
+	require.Equal(t, 1, loads)
+
+	require.NoError(t, c.Quarantine(&astera.Quarantine{Name: "github.com/tmwalaszek/module1", Version: "v1.1.0"}))
+	quarantined, err := c.Quarantined("github.com/tmwalaszek/module1")
+	require.NoError(t, err)
+	require.Len(t, quarantined, 2)
+
+	released, err := c.Release("github.com/tmwalaszek/module1", "v1.0.0", "ops", "")
+	require.NoError(t, err)
+	require.True(t, released)
+
+	quarantined, err = c.Quarantined("github.com/tmwalaszek/module1")
+	require.NoError(t, err)
+	require.Equal(t, []astera.Quarantine{{Name: "github.com/tmwalaszek/module1", Version: "v1.1.0"}}, quarantined)
+
+	// releasing a version that isn't quarantined doesn't reload
+	released, err = c.Release("github.com/tmwalaszek/module1", "v1.0.0", "ops", "")
+	require.NoError(t, err)
+	require.False(t, released)
+	require.Equal(t, 3, loads)
+	require.Equal(t, []string{"github.com/tmwalaszek/module1"}, purged)
+
+	// a change made by another process shows up after a reload
+	delete(stored, "github.com/tmwalaszek/module1@v1.1.0")
+	require.NoError(t, c.Reload())
+
+	quarantined, err = c.Quarantined("github.com/tmwalaszek/module1")
+	require.NoError(t, err)
+	require.Empty(t, quarantined)
+}
@@ -0,0 +1,114 @@
+package astera
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// CacheStatus tells how the response was produced, it is sent back in the X-Astera-Cache header
+type CacheStatus string
+
+const (
+	CacheHit    CacheStatus = "hit"
+	CacheMiss   CacheStatus = "miss"
+	CacheStale  CacheStatus = "stale"
+	CacheBypass CacheStatus = "bypass"
+)
+
+const (
+	SourceMemory   = "memory"
+	SourceDatabase = "sqlite"
+	SourceUpstream = "upstream"
+	SourceGit      = "git"
+)
+
+type requestInfoKey struct{}
+
+// RequestInfo is attached to the request context by the HTTP layer and filled by the
+// module store, so the access log knows where the answer came from.
+// All methods are safe to call on a nil *RequestInfo.
+type RequestInfo struct {
+	ID string
+	// Client identifies the caller for rate limiting, it is the client IP or its token
+	Client string
+
+	mx       sync.Mutex
+	cache    CacheStatus
+	source   string
+	upstream string
+
+	upstreamBytes atomic.Int64
+}
+
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+func RequestInfoFromContext(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*RequestInfo)
+	return info
+}
+
+func (r *RequestInfo) RequestID() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.ID
+}
+
+func (r *RequestInfo) ClientID() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.Client
+}
+
+// SetSource records where the response came from. A miss is never downgraded to a hit,
+// a request that fetched the module and then read it back from the cache is still a miss.
+func (r *RequestInfo) SetSource(cache CacheStatus, source, upstream string) {
+	if r == nil {
+		return
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if r.cache == CacheMiss && cache == CacheHit {
+		return
+	}
+
+	r.cache = cache
+	r.source = source
+	r.upstream = upstream
+}
+
+func (r *RequestInfo) Source() (CacheStatus, string, string) {
+	if r == nil {
+		return "", "", ""
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	return r.cache, r.source, r.upstream
+}
+
+// AddUpstreamBytes counts the bytes downloaded from upstream on behalf of the request
+func (r *RequestInfo) AddUpstreamBytes(n int64) {
+	if r == nil {
+		return
+	}
+
+	r.upstreamBytes.Add(n)
+}
+
+func (r *RequestInfo) UpstreamBytes() int64 {
+	if r == nil {
+		return 0
+	}
+
+	return r.upstreamBytes.Load()
+}
@@ -0,0 +1,312 @@
+package schedule
+
+import (
+	"astera"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	day = 24 * time.Hour
+
+	// how many past windows are kept for the report
+	historySize = 14
+)
+
+// Window is a daily time range in local time, End before Start means it spans midnight
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+func (w Window) String() string {
+	return formatClock(w.Start) + "-" + formatClock(w.End)
+}
+
+func (w Window) length() time.Duration {
+	if w.End > w.Start {
+		return w.End - w.Start
+	}
+
+	return day - w.Start + w.End
+}
+
+// ParseWindows parses a comma separated list of HH:MM-HH:MM windows like "01:00-06:00,22:00-23:30"
+func ParseWindows(spec string) ([]Window, error) {
+	var windows []Window
+	for part := range strings.SplitSeq(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		start, end, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("window %q is not HH:MM-HH:MM", part)
+		}
+
+		w := Window{}
+
+		var err error
+		w.Start, err = parseClock(start)
+		if err != nil {
+			return nil, fmt.Errorf("window %q: %w", part, err)
+		}
+
+		w.End, err = parseClock(end)
+		if err != nil {
+			return nil, fmt.Errorf("window %q: %w", part, err)
+		}
+
+		if w.Start == w.End {
+			return nil, fmt.Errorf("window %q is empty", part)
+		}
+
+		windows = append(windows, w)
+	}
+
+	return windows, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+type Config struct {
+	// Windows are the times the deferred work may run, none means any time
+	Windows []Window
+	// Budget is the number of bytes the deferred work may download in a single window
+	// (a day without windows), zero means no limit
+	Budget int64
+	// Repository keeps the usage across restarts, nil keeps it in memory only
+	Repository astera.WindowUsageRepository
+}
+
+// Usage is the deferred work done in a single window occurrence
+type Usage struct {
+	Window string    `json:"window"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Bytes  int64     `json:"bytes"`
+	Budget int64     `json:"budget,omitempty"`
+}
+
+type Report struct {
+	Open bool `json:"open"`
+	// Current is the window in progress, nil outside the windows
+	Current *Usage `json:"current,omitempty"`
+	// Next is when the next window opens
+	Next    time.Time `json:"next,omitzero"`
+	History []Usage   `json:"history"`
+}
+
+// Schedule tells when the non urgent work (prefetch, mirror sync) may use the upstream link and
+// tracks how many bytes it downloaded in each window.
+// A nil *Schedule is always open.
+type Schedule struct {
+	windows    []Window
+	budget     int64
+	repository astera.WindowUsageRepository
+
+	mx      sync.Mutex
+	current *Usage
+	history []Usage
+
+	now func() time.Time
+}
+
+// New returns nil, meaning no restrictions, when there are neither windows nor a budget.
+// It picks up the usage the repository kept, so a restart doesn't refill the budget of the current window.
+func New(config Config) (*Schedule, error) {
+	if len(config.Windows) == 0 && config.Budget <= 0 {
+		return nil, nil
+	}
+
+	windows := config.Windows
+	if len(windows) == 0 {
+		// the budget is per day
+		windows = []Window{{Start: 0, End: 0}}
+	}
+
+	s := &Schedule{
+		windows:    windows,
+		budget:     config.Budget,
+		repository: config.Repository,
+		now:        time.Now,
+	}
+
+	if s.repository == nil {
+		return s, nil
+	}
+
+	usages, err := s.repository.WindowUsages(historySize + 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the window usage: %w", err)
+	}
+
+	for _, u := range usages {
+		s.history = append(s.history, Usage{Window: u.Window, Start: u.Start, End: u.End, Bytes: u.Bytes, Budget: s.budget})
+	}
+
+	// the last one may still be in progress, usage picks it up again
+	return s, nil
+}
+
+// Open reports if the deferred work may run now, it is inside a window with budget left
+func (s *Schedule) Open() bool {
+	if s == nil {
+		return true
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	u := s.usage(s.now())
+	if u == nil {
+		return false
+	}
+
+	return s.budget <= 0 || u.Bytes < s.budget
+}
+
+// Record counts bytes downloaded by the deferred work against the current window
+func (s *Schedule) Record(bytes int64) {
+	if s == nil || bytes <= 0 {
+		return
+	}
+
+	s.mx.Lock()
+
+	u := s.usage(s.now())
+	if u == nil {
+		// the work started inside the window that has ended since, charge it to the last one
+		if len(s.history) == 0 {
+			s.mx.Unlock()
+			return
+		}
+
+		u = &s.history[len(s.history)-1]
+	}
+
+	u.Bytes += bytes
+	added := astera.WindowUsage{Window: u.Window, Start: u.Start, End: u.End, Bytes: bytes}
+
+	s.mx.Unlock()
+
+	if s.repository == nil {
+		return
+	}
+
+	if err := s.repository.AddWindowUsage(added); err != nil {
+		slog.Error("failed to record the window usage", "window", added.Window, "bytes", bytes, "err", err)
+	}
+}
+
+func (s *Schedule) Report() Report {
+	if s == nil {
+		return Report{Open: true, History: []Usage{}}
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := s.now()
+	r := Report{}
+	if u := s.usage(now); u != nil {
+		current := *u
+		r.Current = &current
+		r.Open = s.budget <= 0 || u.Bytes < s.budget
+	}
+
+	// the usage loaded on start holds one more window, it may have been the current one
+	r.History = slices.Clone(s.history[max(0, len(s.history)-historySize):])
+	if r.History == nil {
+		r.History = []Usage{}
+	}
+
+	r.Next = s.next(now)
+
+	return r
+}
+
+// usage returns the usage of the window now is in, nil outside the windows. s.mx must be held.
+func (s *Schedule) usage(now time.Time) *Usage {
+	if s.current != nil && !now.Before(s.current.Start) && now.Before(s.current.End) {
+		return s.current
+	}
+
+	if s.current != nil {
+		s.history = append(s.history, *s.current)
+		if len(s.history) > historySize {
+			s.history = slices.Delete(s.history, 0, len(s.history)-historySize)
+		}
+
+		s.current = nil
+	}
+
+	for _, w := range s.windows {
+		start, end, ok := occurrence(w, now)
+		if !ok {
+			continue
+		}
+
+		// the occurrence was already in progress before a restart
+		if n := len(s.history); n > 0 && s.history[n-1].Window == w.String() && s.history[n-1].Start.Equal(start) {
+			current := s.history[n-1]
+			s.history = s.history[:n-1]
+			s.current = &current
+			return s.current
+		}
+
+		s.current = &Usage{Window: w.String(), Start: start, End: end, Budget: s.budget}
+		return s.current
+	}
+
+	return nil
+}
+
+// next returns the start of the first window opening after now
+func (s *Schedule) next(now time.Time) time.Time {
+	var next time.Time
+	for _, w := range s.windows {
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		start := midnight.Add(w.Start)
+		if !start.After(now) {
+			start = midnight.AddDate(0, 0, 1).Add(w.Start)
+		}
+
+		if next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+
+	return next
+}
+
+// occurrence returns the occurrence of w containing now
+func occurrence(w Window, now time.Time) (time.Time, time.Time, bool) {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	// the window started today or, spanning midnight, yesterday
+	for _, start := range []time.Time{midnight.Add(w.Start), midnight.AddDate(0, 0, -1).Add(w.Start)} {
+		end := start.Add(w.length())
+		if !now.Before(start) && now.Before(end) {
+			return start, end, true
+		}
+	}
+
+	return time.Time{}, time.Time{}, false
+}
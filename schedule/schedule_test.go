@@ -0,0 +1,150 @@
+package schedule
+
+import (
+	"astera"
+	"astera/mock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWindows(t *testing.T) {
+	t.Parallel()
+
+	var tt = []struct {
+		spec    string
+		windows []Window
+		err     bool
+	}{
+		{
+			spec: "",
+		},
+		{
+			spec:    "01:00-06:00",
+			windows: []Window{{Start: time.Hour, End: 6 * time.Hour}},
+		},
+		{
+			spec:    "22:30-02:00, 12:00-13:00",
+			windows: []Window{{Start: 22*time.Hour + 30*time.Minute, End: 2 * time.Hour}, {Start: 12 * time.Hour, End: 13 * time.Hour}},
+		},
+		{
+			spec: "01:00",
+			err:  true,
+		},
+		{
+			spec: "25:00-06:00",
+			err:  true,
+		},
+		{
+			spec: "06:00-06:00",
+			err:  true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.spec, func(t *testing.T) {
+			windows, err := ParseWindows(tc.spec)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.windows, windows)
+		})
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	t.Parallel()
+
+	windows, err := ParseWindows("23:00-02:00")
+	require.NoError(t, err)
+
+	s, err := New(Config{Windows: windows, Budget: 100})
+	require.NoError(t, err)
+
+	now := time.Date(2025, 3, 10, 22, 0, 0, 0, time.Local)
+	s.now = func() time.Time { return now }
+
+	require.False(t, s.Open())
+	require.Equal(t, time.Date(2025, 3, 10, 23, 0, 0, 0, time.Local), s.Report().Next)
+
+	// the window spans midnight
+	now = time.Date(2025, 3, 11, 1, 0, 0, 0, time.Local)
+	require.True(t, s.Open())
+
+	s.Record(60)
+	require.True(t, s.Open())
+
+	s.Record(60)
+	require.False(t, s.Open())
+
+	report := s.Report()
+	require.Equal(t, "23:00-02:00", report.Current.Window)
+	require.Equal(t, int64(120), report.Current.Bytes)
+	require.Equal(t, time.Date(2025, 3, 10, 23, 0, 0, 0, time.Local), report.Current.Start)
+
+	// the next window starts with a fresh budget
+	now = time.Date(2025, 3, 11, 23, 30, 0, 0, time.Local)
+	require.True(t, s.Open())
+
+	report = s.Report()
+	require.Equal(t, int64(0), report.Current.Bytes)
+	require.Len(t, report.History, 1)
+	require.Equal(t, int64(120), report.History[0].Bytes)
+
+	var disabled *Schedule
+	require.True(t, disabled.Open())
+	disabled, err = New(Config{})
+	require.NoError(t, err)
+	require.Nil(t, disabled)
+
+	// a budget alone is per day
+	daily, err := New(Config{Budget: 10})
+	require.NoError(t, err)
+	require.True(t, daily.Open())
+	daily.Record(10)
+	require.False(t, daily.Open())
+}
+
+func TestScheduleRepository(t *testing.T) {
+	t.Parallel()
+
+	windows, err := ParseWindows("23:00-02:00")
+	require.NoError(t, err)
+
+	var stored []astera.WindowUsage
+	repository := &mock.WindowUsageRepository{
+		AddWindowUsageFn: func(usage astera.WindowUsage) error {
+			stored = append(stored, usage)
+			return nil
+		},
+		WindowUsagesFn: func(limit int) ([]astera.WindowUsage, error) {
+			require.Equal(t, historySize+1, limit)
+
+			return []astera.WindowUsage{
+				{Window: "23:00-02:00", Start: time.Date(2025, 3, 9, 23, 0, 0, 0, time.Local), End: time.Date(2025, 3, 10, 2, 0, 0, 0, time.Local), Bytes: 30},
+				{Window: "23:00-02:00", Start: time.Date(2025, 3, 10, 23, 0, 0, 0, time.Local), End: time.Date(2025, 3, 11, 2, 0, 0, 0, time.Local), Bytes: 90},
+			}, nil
+		},
+	}
+
+	// restarting inside the window keeps what it already used
+	now := time.Date(2025, 3, 11, 1, 0, 0, 0, time.Local)
+	s, err := New(Config{Windows: windows, Budget: 100, Repository: repository})
+	require.NoError(t, err)
+	s.now = func() time.Time { return now }
+
+	report := s.Report()
+	require.Equal(t, int64(90), report.Current.Bytes)
+	require.Len(t, report.History, 1)
+	require.Equal(t, int64(30), report.History[0].Bytes)
+
+	s.Record(20)
+	require.False(t, s.Open())
+	require.Equal(t, []astera.WindowUsage{
+		{Window: "23:00-02:00", Start: time.Date(2025, 3, 10, 23, 0, 0, 0, time.Local), End: time.Date(2025, 3, 11, 2, 0, 0, 0, time.Local), Bytes: 20},
+	}, stored)
+}
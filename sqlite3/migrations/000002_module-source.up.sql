@@ -0,0 +1 @@
+ALTER TABLE module ADD COLUMN source TEXT NOT NULL DEFAULT 'proxy';
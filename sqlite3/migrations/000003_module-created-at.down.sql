@@ -0,0 +1 @@
+ALTER TABLE module DROP COLUMN created_at;
@@ -0,0 +1 @@
+ALTER TABLE module ADD COLUMN created_at INTEGER;
@@ -0,0 +1 @@
+DROP TABLE negative_cache;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS negative_cache (
+    name TEXT NOT NULL,
+    resource TEXT NOT NULL,
+    gone INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+
+    PRIMARY KEY (name, resource)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS job_state_next_attempt;
+DROP TABLE job;
@@ -0,0 +1 @@
+ALTER TABLE job ADD COLUMN depth INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS import_progress (
+    dir TEXT NOT NULL,
+    name TEXT NOT NULL,
+    version TEXT NOT NULL,
+    imported_at INTEGER NOT NULL,
+
+    PRIMARY KEY (dir, name, version)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS module_access (
+    name TEXT NOT NULL,
+    version TEXT NOT NULL,
+    last_access_at INTEGER NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (name, version)
+);
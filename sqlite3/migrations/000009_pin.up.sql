@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS pin (
+    module TEXT NOT NULL,
+    version TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL,
+    owner TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+
+    PRIMARY KEY (module, version)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS quarantine_audit;
+DROP TABLE IF EXISTS quarantine;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS quarantine (
+    name TEXT NOT NULL,
+    version TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    quarantined_by TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+
+    PRIMARY KEY (name, version)
+);
+
+CREATE TABLE IF NOT EXISTS quarantine_audit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    version TEXT NOT NULL,
+    action TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS quarantine_audit_name ON quarantine_audit (name);
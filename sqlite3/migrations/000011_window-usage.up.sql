@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS window_usage (
+    name TEXT NOT NULL,
+    starts_at INTEGER NOT NULL,
+    ends_at INTEGER NOT NULL,
+    bytes INTEGER NOT NULL,
+
+    PRIMARY KEY (starts_at, name)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS mirror_status (
+    module TEXT PRIMARY KEY NOT NULL,
+    rule TEXT NOT NULL,
+    synced_at INTEGER NOT NULL,
+    upstream INTEGER NOT NULL,
+    matched INTEGER NOT NULL,
+    missing INTEGER NOT NULL,
+    queued INTEGER NOT NULL,
+    error TEXT NOT NULL
+);
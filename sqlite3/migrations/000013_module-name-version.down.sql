@@ -0,0 +1 @@
+DROP INDEX IF EXISTS module_name_version;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS module_name_version ON module(name, version);
@@ -0,0 +1 @@
+ALTER TABLE module DROP COLUMN released_at;
@@ -0,0 +1,4 @@
+ALTER TABLE module ADD COLUMN released_at INTEGER;
+
+UPDATE module SET released_at = unixepoch(json_extract(CAST(info AS TEXT), '$.Time'))
+WHERE source NOT IN ('published', 'git') AND json_valid(CAST(info AS TEXT));
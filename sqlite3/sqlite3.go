@@ -2,14 +2,21 @@ package sqlite3
 
 import (
 	"astera"
+	"context"
 	"database/sql"
 	"embed"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
+	sqlite "github.com/mattn/go-sqlite3"
 )
 
 var (
@@ -17,8 +24,14 @@ var (
 	fs embed.FS
 )
 
+// ErrNotIncremental is returned by IncrementalVacuum on a database created before the incremental auto vacuum
+var ErrNotIncremental = errors.New("the database doesn't use incremental auto vacuum, convert it offline with astera gc -convert-vacuum")
+
 type DB struct {
 	db *sql.DB
+
+	// schema version after applying the migrations
+	version uint
 }
 
 func NewDB(database string) (*DB, error) {
@@ -32,6 +45,11 @@ func NewDB(database string) (*DB, error) {
 		return nil, err
 	}
 
+	err = initAutoVacuum(db)
+	if err != nil {
+		return nil, err
+	}
+
 	migrator, err := migrate.NewWithSourceInstance("iofs", d, "sqlite3://"+database)
 	if err != nil {
 		return nil, err
@@ -42,24 +60,139 @@ func NewDB(database string) (*DB, error) {
 		return nil, err
 	}
 
-	return &DB{db: db}, nil
+	version, _, err := migrator.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	srcErr, dbErr := migrator.Close()
+	if err = errors.Join(srcErr, dbErr); err != nil {
+		return nil, err
+	}
+
+	return &DB{db: db, version: version}, nil
 }
 
-// On conflict it does nothing but we should check the hash for example and report if it is different
-func (d *DB) InsertModule(module *astera.Module) error {
-	query := `INSERT INTO module (name, version, mod, info, zip_hash, zip) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING;`
+// initAutoVacuum makes a new database use the incremental auto vacuum, it can only be set before the
+// first table is created. An existing database is left as it is, see ConvertVacuum.
+func initAutoVacuum(db *sql.DB) error {
+	var tables int
+	err := db.QueryRow(`SELECT count(*) FROM sqlite_master`).Scan(&tables)
+	if err != nil || tables > 0 {
+		return err
+	}
+
+	_, err = db.Exec(`PRAGMA auto_vacuum = INCREMENTAL`)
+	if err == nil {
+		_, err = db.Exec(`VACUUM`)
+	}
+
+	return err
+}
+
+// Ping checks that the database is reachable and the schema is at the version applied on startup
+func (d *DB) Ping(ctx context.Context) error {
+	err := d.db.PingContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	var version uint
+	var dirty bool
+	query := `SELECT version, dirty FROM schema_migrations LIMIT 1`
+	err = d.db.QueryRowContext(ctx, query).Scan(&version, &dirty)
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		return fmt.Errorf("schema version %d is dirty", version)
+	}
+
+	if version != d.version {
+		return fmt.Errorf("schema version %d, expected %d", version, d.version)
+	}
 
-	_, err := d.db.Exec(query,
+	return nil
+}
+
+// CheckWritable takes the write lock and releases it without changing anything
+func (d *DB) CheckWritable(ctx context.Context) error {
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "BEGIN IMMEDIATE")
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(context.WithoutCancel(ctx), "ROLLBACK")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Close checkpoints the WAL into the main database file and closes the connections
+func (d *DB) Close() error {
+	_, err := d.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`)
+	if err != nil {
+		return errors.Join(err, d.db.Close())
+	}
+
+	return d.db.Close()
+}
+
+// insertModuleQuery stores the module, a stored partial module gets the zip
+const insertModuleQuery = `INSERT INTO module (name, version, mod, info, zip_hash, zip, source, created_at, released_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (version, name) DO UPDATE SET zip = excluded.zip, zip_hash = excluded.zip_hash
+	WHERE module.zip IS NULL AND excluded.zip IS NOT NULL;`
+
+func insertModuleArgs(module *astera.Module) []any {
+	source := module.Source
+	if source == "" {
+		source = astera.ModuleSourceProxy
+	}
+
+	// the release time is kept apart from the .info, the release age checks don't parse it
+	var released sql.NullInt64
+	if t := releaseTime(source, module.Info); !t.IsZero() {
+		released = sql.NullInt64{Int64: t.Unix(), Valid: true}
+	}
+
+	return []any{
 		module.Name,
 		module.Version,
 		module.Mod,
 		module.Info,
 		module.ZipHash,
-		module.Zip)
+		module.Zip,
+		source,
+		time.Now().Unix(),
+		released,
+	}
+}
+
+func (d *DB) InsertModule(module *astera.Module) error {
+	result, err := d.db.Exec(insertModuleQuery, insertModuleArgs(module)...)
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if inserted == 0 {
+		return fmt.Errorf("%w: %s@%s", astera.ErrModuleAlreadyExists, module.Name, module.Version)
+	}
+
 	return nil
 }
 
@@ -141,7 +274,7 @@ func (d *DB) GetModFile(name, version string) ([]byte, error) {
 func (d *DB) GetModuleZip(name, version string) ([]byte, error) {
 	query := `SELECT zip FROM module WHERE name = ? AND version = ?`
 	row := d.db.QueryRow(query, name, version)
-	var zip []byte
+	var zip sql.Null[[]byte]
 
 	err := row.Scan(&zip)
 	if err != nil {
@@ -152,7 +285,12 @@ func (d *DB) GetModuleZip(name, version string) ([]byte, error) {
 		return nil, err
 	}
 
-	return zip, nil
+	// partial module, the zip was not fetched yet
+	if !zip.Valid {
+		return nil, astera.ErrModuleNotFound
+	}
+
+	return zip.V, nil
 }
 
 // IsModule check the present of the module in the database
@@ -166,3 +304,1018 @@ func (d *DB) ModuleExists(name string, version string) (bool, error) {
 	return exists, nil
 
 }
+
+func (d *DB) HasModuleZip(name string, version string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM module WHERE name = ? AND version = ? AND zip IS NOT NULL)`
+	var exists bool
+	err := d.db.QueryRow(query, name, version).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (d *DB) SearchModules(query string, limit int) ([]string, error) {
+	// escape the LIKE wildcards, module paths can contain '_'
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+
+	rows, err := d.db.Query(`SELECT DISTINCT name FROM module WHERE name LIKE ? ESCAPE '\' ORDER BY name LIMIT ?`, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+func (d *DB) GetModuleVersions(name string) ([]astera.ModuleVersion, error) {
+	pins, err := listPins(d.db)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT m.version, m.source, m.zip_hash, length(m.mod), length(m.zip), m.created_at, a.last_access_at, COALESCE(a.hits, 0),
+		q.reason, q.quarantined_by, q.created_at
+		FROM module m LEFT JOIN module_access a ON a.name = m.name AND a.version = m.version
+		LEFT JOIN quarantine q ON q.name = m.name AND q.version = m.version WHERE m.name = ?`
+	rows, err := d.db.Query(query, name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	versions := make([]astera.ModuleVersion, 0)
+	for rows.Next() {
+		var zipHash, quarantineReason, quarantinedBy sql.NullString
+		var modSize, zipSize, createdAt, lastAccess, quarantinedAt sql.NullInt64
+
+		v := astera.ModuleVersion{Name: name}
+		err = rows.Scan(&v.Version, &v.Source, &zipHash, &modSize, &zipSize, &createdAt, &lastAccess, &v.Hits,
+			&quarantineReason, &quarantinedBy, &quarantinedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if quarantinedAt.Valid {
+			v.Quarantine = &astera.Quarantine{
+				Name:      name,
+				Version:   v.Version,
+				Reason:    quarantineReason.String,
+				By:        quarantinedBy.String,
+				CreatedAt: time.Unix(quarantinedAt.Int64, 0),
+			}
+		}
+
+		v.ZipHash = zipHash.String
+		v.ModSize = modSize.Int64
+		v.ZipSize = zipSize.Int64
+		if createdAt.Valid {
+			v.CreatedAt = time.Unix(createdAt.Int64, 0)
+		}
+		if lastAccess.Valid {
+			v.LastAccessAt = time.Unix(lastAccess.Int64, 0)
+		}
+
+		v.Pin = pinOf(pins, v.Name, v.Version)
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+func (d *DB) InsertNegative(name, resource string, entry astera.NegativeEntry) error {
+	query := `INSERT INTO negative_cache (name, resource, gone, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (name, resource) DO UPDATE SET gone = excluded.gone, expires_at = excluded.expires_at`
+
+	_, err := d.db.Exec(query, name, resource, entry.Gone, entry.ExpiresAt.Unix())
+	return err
+}
+
+func (d *DB) GetNegative(name, resource string) (*astera.NegativeEntry, error) {
+	query := `SELECT gone, expires_at FROM negative_cache WHERE name = ? AND resource = ? AND expires_at > ?`
+
+	var gone bool
+	var expiresAt int64
+	err := d.db.QueryRow(query, name, resource, time.Now().Unix()).Scan(&gone, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &astera.NegativeEntry{Gone: gone, ExpiresAt: time.Unix(expiresAt, 0)}, nil
+}
+
+// PurgeNegative also drops the expired entries of all modules, they are not counted
+func (d *DB) PurgeNegative(name string) (int64, error) {
+	_, err := d.db.Exec(`DELETE FROM negative_cache WHERE expires_at <= ?`, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := d.db.Exec(`DELETE FROM negative_cache WHERE ? = '' OR name = ?`, name, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (d *DB) EnqueueJob(job *astera.Job) (bool, error) {
+	query := `INSERT INTO job (name, version, kind, state, depth, next_attempt_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name, version) DO UPDATE SET kind = excluded.kind, state = excluded.state, attempts = 0,
+			last_error = '', depth = excluded.depth, next_attempt_at = excluded.next_attempt_at, updated_at = excluded.updated_at
+		WHERE job.state = ?`
+
+	now := time.Now().Unix()
+	res, err := d.db.Exec(query, job.Name, job.Version, job.Kind, astera.JobStatePending, job.Depth, job.NextAttempt.Unix(),
+		now, now, astera.JobStateFailed)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (d *DB) ClaimJob(now time.Time, skipKinds []string) (*astera.Job, error) {
+	// kind NOT IN ('') skips nothing, no kind is empty
+	placeholders := "?"
+	args := []any{astera.JobStateRunning, now.Unix(), astera.JobStatePending, now.Unix(), ""}
+	for _, kind := range skipKinds {
+		placeholders += ", ?"
+		args = append(args, kind)
+	}
+
+	query := `UPDATE job SET state = ?, updated_at = ? WHERE id = (
+			SELECT id FROM job WHERE state = ? AND next_attempt_at <= ? AND kind NOT IN (` + placeholders + `)
+			ORDER BY next_attempt_at, id LIMIT 1)
+		RETURNING ` + jobColumns
+
+	row := d.db.QueryRow(query, args...)
+
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return job, err
+}
+
+func (d *DB) FinishJob(name, version string) error {
+	_, err := d.db.Exec(`DELETE FROM job WHERE name = ? AND version = ?`, name, version)
+	return err
+}
+
+func (d *DB) RetryJob(id int64, attempts int, nextAttempt time.Time, lastErr string) error {
+	query := `UPDATE job SET state = ?, attempts = ?, next_attempt_at = ?, last_error = ?, updated_at = ? WHERE id = ?`
+
+	_, err := d.db.Exec(query, astera.JobStatePending, attempts, nextAttempt.Unix(), lastErr, time.Now().Unix(), id)
+	return err
+}
+
+func (d *DB) FailJob(id int64, attempts int, lastErr string) error {
+	query := `UPDATE job SET state = ?, attempts = ?, last_error = ?, updated_at = ? WHERE id = ?`
+
+	_, err := d.db.Exec(query, astera.JobStateFailed, attempts, lastErr, time.Now().Unix(), id)
+	return err
+}
+
+func (d *DB) ListJobs(state string, limit int) ([]astera.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM job WHERE ? = '' OR state = ? ORDER BY next_attempt_at, id LIMIT ?`
+
+	rows, err := d.db.Query(query, state, state, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	jobs := make([]astera.Job, 0)
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, *job)
+	}
+
+	return jobs, rows.Err()
+}
+
+func (d *DB) DeleteJob(id int64) (bool, error) {
+	res, err := d.db.Exec(`DELETE FROM job WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (d *DB) ResetRunningJobs() (int64, error) {
+	res, err := d.db.Exec(`UPDATE job SET state = ?, updated_at = ? WHERE state = ?`,
+		astera.JobStatePending, time.Now().Unix(), astera.JobStateRunning)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+const jobColumns = `id, name, version, kind, state, attempts, last_error, depth, next_attempt_at, created_at, updated_at`
+
+func scanJob(row interface{ Scan(...any) error }) (*astera.Job, error) {
+	var job astera.Job
+	var nextAttempt, createdAt, updatedAt int64
+
+	err := row.Scan(&job.ID, &job.Name, &job.Version, &job.Kind, &job.State, &job.Attempts, &job.LastError,
+		&job.Depth, &nextAttempt, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	job.NextAttempt = time.Unix(nextAttempt, 0)
+	job.CreatedAt = time.Unix(createdAt, 0)
+	job.UpdatedAt = time.Unix(updatedAt, 0)
+
+	return &job, nil
+}
+
+func (d *DB) InsertImportBatch(dir string, modules []*astera.Module) ([]error, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	insertModule, err := tx.Prepare(insertModuleQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	defer insertModule.Close()
+
+	insertProgress, err := tx.Prepare(`INSERT INTO import_progress (dir, name, version, imported_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (dir, name, version) DO UPDATE SET imported_at = excluded.imported_at`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer insertProgress.Close()
+
+	now := time.Now().Unix()
+	errs := make([]error, len(modules))
+	for i, m := range modules {
+		// a version refused by a constraint is rolled back alone, the rest of the batch is stored
+		_, err = tx.Exec(`SAVEPOINT import_version`)
+		if err != nil {
+			return nil, err
+		}
+
+		var result sql.Result
+		result, err = insertModule.Exec(insertModuleArgs(m)...)
+		if sqliteErr := (sqlite.Error{}); errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite.ErrConstraint {
+			errs[i] = fmt.Errorf("%s@%s: %w", m.Name, m.Version, err)
+
+			_, err = tx.Exec(`ROLLBACK TO import_version`)
+			if err == nil {
+				_, err = tx.Exec(`RELEASE import_version`)
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s@%s: %w", m.Name, m.Version, err)
+		}
+
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if inserted == 0 {
+			// stored meanwhile by a fetch or a publish, recorded as imported anyway
+			errs[i] = fmt.Errorf("%w: %s@%s", astera.ErrModuleAlreadyExists, m.Name, m.Version)
+		}
+
+		_, err = insertProgress.Exec(dir, m.Name, m.Version, now)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(`RELEASE import_version`)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return errs, tx.Commit()
+}
+
+func (d *DB) ImportedVersions(dir string) (map[string]bool, error) {
+	rows, err := d.db.Query(`SELECT name, version FROM import_progress WHERE dir = ?`, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	versions := make(map[string]bool)
+	for rows.Next() {
+		var name, version string
+		err = rows.Scan(&name, &version)
+		if err != nil {
+			return nil, err
+		}
+
+		versions[name+"@"+version] = true
+	}
+
+	return versions, rows.Err()
+}
+
+func (d *DB) ResetImport(dir string) error {
+	_, err := d.db.Exec(`DELETE FROM import_progress WHERE dir = ?`, dir)
+	return err
+}
+
+// notQuarantined is the condition leaving out the quarantined versions of the module table
+const notQuarantined = `NOT EXISTS (SELECT 1 FROM quarantine q WHERE q.name = module.name AND q.version = module.version)`
+
+// WalkModules streams the modules ordered by name and version along the module_name_version index, so
+// only a single row is held in memory and nothing is sorted. Every prefix is walked as a range of its own.
+func (d *DB) WalkModules(prefixes []string, fn func(*astera.Module) error) error {
+	if len(prefixes) == 0 {
+		return d.walkModules("", fn)
+	}
+
+	// the ranges of the prefixes are walked in order, a prefix covered by another one is dropped
+	sorted := slices.Sorted(slices.Values(prefixes))
+	walked := ""
+	for i, prefix := range sorted {
+		if i > 0 && strings.HasPrefix(prefix, walked) {
+			continue
+		}
+
+		walked = prefix
+
+		err := d.walkModules(prefix, fn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *DB) walkModules(prefix string, fn func(*astera.Module) error) error {
+	query := `SELECT name, version, source, zip_hash, info, mod, zip FROM module INDEXED BY module_name_version WHERE ` + notQuarantined
+	var args []any
+	if prefix != "" {
+		// the names are ASCII, '~' is the highest character they can hold
+		query += ` AND name >= ? AND name < ?`
+		args = append(args, prefix, prefix+"\x7f")
+	}
+
+	rows, err := d.db.Query(query+` ORDER BY name, version`, args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var source, zipHash sql.NullString
+		m := &astera.Module{}
+
+		err = rows.Scan(&m.Name, &m.Version, &source, &zipHash, &m.Info, &m.Mod, &m.Zip)
+		if err != nil {
+			return err
+		}
+
+		m.Source = source.String
+		m.ZipHash = zipHash.String
+
+		err = fn(m)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Catalog pages through the stored versions, the partial ones included. A page is a range of the
+// module_name_version index, it never sorts the table.
+func (d *DB) Catalog(afterName, afterVersion string, limit int) ([]astera.ModuleVersion, error) {
+	query := `SELECT name, version, source FROM module INDEXED BY module_name_version WHERE (name, version) > (?, ?) AND ` + notQuarantined +
+		` ORDER BY name, version LIMIT ?`
+	rows, err := d.db.Query(query, afterName, afterVersion, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	versions := make([]astera.ModuleVersion, 0)
+	for rows.Next() {
+		var source sql.NullString
+
+		v := astera.ModuleVersion{}
+		err = rows.Scan(&v.Name, &v.Version, &source)
+		if err != nil {
+			return nil, err
+		}
+
+		v.Source = source.String
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+func (d *DB) RecordAccess(accesses []astera.Access) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO module_access (name, version, last_access_at, hits) VALUES (?, ?, ?, ?)
+		ON CONFLICT (name, version) DO UPDATE SET hits = hits + excluded.hits,
+		last_access_at = max(last_access_at, excluded.last_access_at)`)
+	if err != nil {
+		return err
+	}
+
+	defer stmt.Close()
+
+	for _, a := range accesses {
+		_, err = stmt.Exec(a.Name, a.Version, a.At.Unix(), a.Hits)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (d *DB) DatabaseSize() (int64, error) {
+	var pageCount, freePages, pageSize int64
+
+	err := d.db.QueryRow(`SELECT page_count, freelist_count, page_size FROM pragma_page_count(), pragma_freelist_count(), pragma_page_size()`).
+		Scan(&pageCount, &freePages, &pageSize)
+	if err != nil {
+		return 0, err
+	}
+
+	return (pageCount - freePages) * pageSize, nil
+}
+
+// lastAccessExpr is the last access of a module row, its ingestion when it was never served
+const lastAccessExpr = `COALESCE(a.last_access_at, m.created_at, 0)`
+
+func (d *DB) LeastRecentlyUsed(withZip bool, accessedBefore time.Time, limit, offset int) ([]astera.ModuleVersion, error) {
+	pins, err := listPins(d.db)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT m.name, m.version, m.source, length(m.mod), length(m.zip), m.created_at, a.last_access_at, COALESCE(a.hits, 0)
+		FROM module m LEFT JOIN module_access a ON a.name = m.name AND a.version = m.version
+		WHERE m.source NOT IN (?, ?) AND (? = 0 OR m.zip IS NOT NULL) AND ` + lastAccessExpr + ` < ?
+		ORDER BY ` + lastAccessExpr + `, m.name, m.version LIMIT ? OFFSET ?`
+
+	rows, err := d.db.Query(query, astera.ModuleSourcePublished, astera.ModuleSourceGit, withZip, accessedBefore.Unix(), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	versions := make([]astera.ModuleVersion, 0)
+	for rows.Next() {
+		var modSize, zipSize, createdAt, lastAccess sql.NullInt64
+
+		v := astera.ModuleVersion{}
+		err = rows.Scan(&v.Name, &v.Version, &v.Source, &modSize, &zipSize, &createdAt, &lastAccess, &v.Hits)
+		if err != nil {
+			return nil, err
+		}
+
+		v.ModSize = modSize.Int64
+		v.ZipSize = zipSize.Int64
+		if createdAt.Valid {
+			v.CreatedAt = time.Unix(createdAt.Int64, 0)
+		}
+		if lastAccess.Valid {
+			v.LastAccessAt = time.Unix(lastAccess.Int64, 0)
+		}
+
+		v.Pin = pinOf(pins, v.Name, v.Version)
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+func (d *DB) DropZip(name, version string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	err = checkNotPinned(tx, name, version)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE module SET zip = NULL WHERE name = ? AND version = ?`, name, version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *DB) DeleteModule(name, version string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	err = checkNotPinned(tx, name, version)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM module WHERE name = ? AND version = ?`, name, version)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM module_access WHERE name = ? AND version = ?`, name, version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// IncrementalVacuum frees the pages left by the evictions. It fails with ErrNotIncremental on a database
+// created without incremental auto vacuum, the conversion is a full VACUUM better run offline.
+func (d *DB) IncrementalVacuum() error {
+	ctx := context.Background()
+
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	var mode int
+	err = conn.QueryRowContext(ctx, `PRAGMA auto_vacuum`).Scan(&mode)
+	if err != nil {
+		return err
+	}
+
+	// 2 is incremental
+	if mode != 2 {
+		return ErrNotIncremental
+	}
+
+	_, err = conn.ExecContext(ctx, `PRAGMA incremental_vacuum`)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err
+}
+
+// ConvertVacuum switches the database to the incremental auto vacuum with a full VACUUM. It rewrites
+// the whole database, needs as much free space as the database and blocks every write meanwhile.
+// It reports if the database was converted, false when it already was incremental.
+func (d *DB) ConvertVacuum(ctx context.Context) (bool, error) {
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	defer conn.Close()
+
+	var mode int
+	err = conn.QueryRowContext(ctx, `PRAGMA auto_vacuum`).Scan(&mode)
+	if err != nil || mode == 2 {
+		return false, err
+	}
+
+	_, err = conn.ExecContext(ctx, `PRAGMA auto_vacuum = INCREMENTAL`)
+	if err == nil {
+		_, err = conn.ExecContext(ctx, `VACUUM`)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	_, err = conn.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err == nil, err
+}
+
+func (d *DB) AddPin(pin *astera.Pin) error {
+	query := `INSERT INTO pin (module, version, reason, owner, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (module, version) DO UPDATE SET reason = excluded.reason, owner = excluded.owner RETURNING created_at`
+
+	var createdAt int64
+	err := d.db.QueryRow(query, pin.Module, pin.Version, pin.Reason, pin.Owner, time.Now().Unix()).Scan(&createdAt)
+	if err != nil {
+		return err
+	}
+
+	pin.CreatedAt = time.Unix(createdAt, 0)
+
+	return nil
+}
+
+func (d *DB) RemovePin(module, version string) (bool, error) {
+	res, err := d.db.Exec(`DELETE FROM pin WHERE module = ? AND version = ?`, module, version)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (d *DB) ListPins() ([]astera.Pin, error) {
+	return listPins(d.db)
+}
+
+// queryer is a *sql.DB or a *sql.Tx
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func listPins(q queryer) ([]astera.Pin, error) {
+	rows, err := q.Query(`SELECT module, version, reason, owner, created_at FROM pin ORDER BY module, version`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	pins := make([]astera.Pin, 0)
+	for rows.Next() {
+		var p astera.Pin
+		var createdAt int64
+
+		err = rows.Scan(&p.Module, &p.Version, &p.Reason, &p.Owner, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+
+		p.CreatedAt = time.Unix(createdAt, 0)
+		pins = append(pins, p)
+	}
+
+	return pins, rows.Err()
+}
+
+// pinOf returns the pin of the stored version, a version pin before a module pattern
+func pinOf(pins []astera.Pin, name, version string) *astera.Pin {
+	var matched *astera.Pin
+	for i := range pins {
+		if !pins[i].Match(name, version) {
+			continue
+		}
+
+		if pins[i].Version != "" {
+			return &pins[i]
+		}
+
+		if matched == nil {
+			matched = &pins[i]
+		}
+	}
+
+	return matched
+}
+
+// checkNotPinned guards every deletion path, the pins are read in the deleting transaction
+func checkNotPinned(tx *sql.Tx, name, version string) error {
+	pins, err := listPins(tx)
+	if err != nil {
+		return err
+	}
+
+	if pin := pinOf(pins, name, version); pin != nil {
+		return fmt.Errorf("%s@%s: %w by %s: %s", name, version, astera.ErrPinned, pin.Owner, pin.Reason)
+	}
+
+	return nil
+}
+
+func (d *DB) Quarantine(q *astera.Quarantine) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+
+	query := `INSERT INTO quarantine (name, version, reason, quarantined_by, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (name, version) DO UPDATE SET reason = excluded.reason, quarantined_by = excluded.quarantined_by
+		RETURNING created_at`
+
+	var createdAt int64
+	err = tx.QueryRow(query, q.Name, q.Version, q.Reason, q.By, now).Scan(&createdAt)
+	if err != nil {
+		return err
+	}
+
+	err = insertQuarantineEvent(tx, q.Name, q.Version, astera.QuarantineActionAdd, q.Reason, q.By, now)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	q.CreatedAt = time.Unix(createdAt, 0)
+
+	return nil
+}
+
+func (d *DB) Release(name, version, by, reason string) (bool, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM quarantine WHERE name = ? AND version = ?`, name, version)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+
+	err = insertQuarantineEvent(tx, name, version, astera.QuarantineActionRelease, reason, by, time.Now().Unix())
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func insertQuarantineEvent(tx *sql.Tx, name, version, action, reason, by string, at int64) error {
+	_, err := tx.Exec(`INSERT INTO quarantine_audit (name, version, action, reason, actor, at) VALUES (?, ?, ?, ?, ?, ?)`,
+		name, version, action, reason, by, at)
+	return err
+}
+
+func (d *DB) Quarantined(name string) ([]astera.Quarantine, error) {
+	return d.queryQuarantines(`SELECT name, version, reason, quarantined_by, created_at FROM quarantine WHERE name = ?`, name)
+}
+
+func (d *DB) ListQuarantines() ([]astera.Quarantine, error) {
+	return d.queryQuarantines(`SELECT name, version, reason, quarantined_by, created_at FROM quarantine ORDER BY name, version`)
+}
+
+func (d *DB) queryQuarantines(query string, args ...any) ([]astera.Quarantine, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	quarantines := make([]astera.Quarantine, 0)
+	for rows.Next() {
+		var q astera.Quarantine
+		var createdAt int64
+
+		err = rows.Scan(&q.Name, &q.Version, &q.Reason, &q.By, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+
+		q.CreatedAt = time.Unix(createdAt, 0)
+		quarantines = append(quarantines, q)
+	}
+
+	return quarantines, rows.Err()
+}
+
+func (d *DB) QuarantineAudit(name string, limit int) ([]astera.QuarantineEvent, error) {
+	query := `SELECT name, version, action, reason, actor, at FROM quarantine_audit
+		WHERE ? = '' OR name = ? ORDER BY id DESC LIMIT ?`
+	rows, err := d.db.Query(query, name, name, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	events := make([]astera.QuarantineEvent, 0)
+	for rows.Next() {
+		var e astera.QuarantineEvent
+		var at int64
+
+		err = rows.Scan(&e.Name, &e.Version, &e.Action, &e.Reason, &e.By, &at)
+		if err != nil {
+			return nil, err
+		}
+
+		e.At = time.Unix(at, 0)
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+func (d *DB) ReleaseTimes(name string) (map[string]time.Time, error) {
+	rows, err := d.db.Query(`SELECT version, released_at FROM module WHERE name = ?`, name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	times := make(map[string]time.Time)
+	for rows.Next() {
+		var version string
+		var released sql.NullInt64
+
+		err = rows.Scan(&version, &released)
+		if err != nil {
+			return nil, err
+		}
+
+		times[version] = releasedAt(released)
+	}
+
+	return times, rows.Err()
+}
+
+func (d *DB) ReleaseTime(name, version string) (time.Time, error) {
+	var released sql.NullInt64
+
+	err := d.db.QueryRow(`SELECT released_at FROM module WHERE name = ? AND version = ?`,
+		name, version).Scan(&released)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, astera.ErrModuleNotFound
+	}
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return releasedAt(released), nil
+}
+
+// releasedAt is zero for the versions stored without a release time
+func releasedAt(released sql.NullInt64) time.Time {
+	if !released.Valid {
+		return time.Time{}
+	}
+
+	return time.Unix(released.Int64, 0).UTC()
+}
+
+// releaseTime is zero for the versions not released upstream
+func releaseTime(source string, info []byte) time.Time {
+	if source == astera.ModuleSourcePublished || source == astera.ModuleSourceGit {
+		return time.Time{}
+	}
+
+	var i astera.Info
+	if json.Unmarshal(info, &i) != nil {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, i.Time)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+func (d *DB) AddWindowUsage(usage astera.WindowUsage) error {
+	query := `INSERT INTO window_usage (name, starts_at, ends_at, bytes) VALUES (?, ?, ?, ?)
+		ON CONFLICT (starts_at, name) DO UPDATE SET bytes = bytes + excluded.bytes`
+
+	_, err := d.db.Exec(query, usage.Window, usage.Start.Unix(), usage.End.Unix(), usage.Bytes)
+	return err
+}
+
+func (d *DB) WindowUsages(limit int) ([]astera.WindowUsage, error) {
+	query := `SELECT name, starts_at, ends_at, bytes FROM
+		(SELECT * FROM window_usage ORDER BY starts_at DESC LIMIT ?) ORDER BY starts_at`
+
+	rows, err := d.db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	usages := make([]astera.WindowUsage, 0)
+	for rows.Next() {
+		var u astera.WindowUsage
+		var start, end int64
+
+		err = rows.Scan(&u.Window, &start, &end, &u.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		u.Start, u.End = time.Unix(start, 0), time.Unix(end, 0)
+		usages = append(usages, u)
+	}
+
+	return usages, rows.Err()
+}
+
+func (d *DB) SaveMirrorStatus(status astera.MirrorStatus) error {
+	query := `INSERT INTO mirror_status (module, rule, synced_at, upstream, matched, missing, queued, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (module) DO UPDATE SET rule = excluded.rule, synced_at = excluded.synced_at, upstream = excluded.upstream,
+			matched = excluded.matched, missing = excluded.missing, queued = excluded.queued, error = excluded.error`
+
+	_, err := d.db.Exec(query, status.Module, status.Rule, status.SyncedAt.Unix(), status.Upstream, status.Matched,
+		status.Missing, status.Queued, status.Error)
+	return err
+}
+
+func (d *DB) MirrorStatuses() ([]astera.MirrorStatus, error) {
+	rows, err := d.db.Query(`SELECT module, rule, synced_at, upstream, matched, missing, queued, error FROM mirror_status ORDER BY module`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	statuses := make([]astera.MirrorStatus, 0)
+	for rows.Next() {
+		var s astera.MirrorStatus
+		var syncedAt int64
+
+		err = rows.Scan(&s.Module, &s.Rule, &syncedAt, &s.Upstream, &s.Matched, &s.Missing, &s.Queued, &s.Error)
+		if err != nil {
+			return nil, err
+		}
+
+		s.SyncedAt = time.Unix(syncedAt, 0)
+		statuses = append(statuses, s)
+	}
+
+	return statuses, rows.Err()
+}
@@ -2,9 +2,12 @@ package sqlite3
 
 import (
 	"astera"
+	"context"
+	"database/sql"
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -45,11 +48,15 @@ func TestSqlite3(t *testing.T) {
 		},
 	}
 
-	for _, m := range modules {
+	for _, m := range modules[:2] {
 		err = db.InsertModule(m)
 		require.NoError(t, err)
 	}
 
+	// the racing second insert of a version is told apart
+	err = db.InsertModule(modules[2])
+	require.ErrorIs(t, err, astera.ErrModuleAlreadyExists)
+
 	versions, err := db.GetVersionList("github.com/tmwalaszek/module1")
 	require.NoError(t, err)
 
@@ -83,4 +90,414 @@ func TestSqlite3(t *testing.T) {
 	exists, err = db.ModuleExists("github.com/tmwalaszek/module1", "v2.0.0")
 	require.NoError(t, err)
 	require.False(t, exists)
+
+	names, err := db.SearchModules("module", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"github.com/tmwalaszek/module1", "github.com/tmwalaszek/module2"}, names)
+
+	names, err = db.SearchModules("module_", 10)
+	require.NoError(t, err)
+	require.Empty(t, names)
+
+	moduleVersions, err := db.GetModuleVersions("github.com/tmwalaszek/module1")
+	require.NoError(t, err)
+	require.Len(t, moduleVersions, 1)
+	require.Equal(t, "v1.0.0", moduleVersions[0].Version)
+	require.Equal(t, astera.ModuleSourceProxy, moduleVersions[0].Source)
+	require.Equal(t, int64(3), moduleVersions[0].ZipSize)
+	require.False(t, moduleVersions[0].CreatedAt.IsZero())
+
+	err = db.InsertNegative("github.com/tmwalaszek/module3", "v1.0.0.info", astera.NegativeEntry{Gone: true, ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	err = db.InsertNegative("github.com/tmwalaszek/module3", "@latest", astera.NegativeEntry{ExpiresAt: time.Now().Add(-time.Hour)})
+	require.NoError(t, err)
+
+	negative, err := db.GetNegative("github.com/tmwalaszek/module3", "v1.0.0.info")
+	require.NoError(t, err)
+	require.True(t, negative.Gone)
+
+	negative, err = db.GetNegative("github.com/tmwalaszek/module3", "@latest")
+	require.NoError(t, err)
+	require.Nil(t, negative)
+
+	purged, err := db.PurgeNegative("github.com/tmwalaszek/module3")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), purged)
+
+	now := time.Now()
+	for _, job := range []*astera.Job{
+		{Name: "github.com/tmwalaszek/module4", Version: "v1.0.0", Kind: astera.JobKindMiss, NextAttempt: now.Add(time.Hour)},
+		{Name: "github.com/tmwalaszek/module5", Version: "v1.0.0", Kind: astera.JobKindPrefetch, NextAttempt: now},
+	} {
+		added, err := db.EnqueueJob(job)
+		require.NoError(t, err)
+		require.True(t, added)
+	}
+
+	added, err := db.EnqueueJob(&astera.Job{Name: "github.com/tmwalaszek/module5", Version: "v1.0.0", Kind: astera.JobKindMiss, NextAttempt: now})
+	require.NoError(t, err)
+	require.False(t, added)
+
+	// prefetch jobs are held back
+	job, err := db.ClaimJob(now, []string{astera.JobKindPrefetch})
+	require.NoError(t, err)
+	require.Nil(t, job)
+
+	job, err = db.ClaimJob(now, nil)
+	require.NoError(t, err)
+	require.Equal(t, "github.com/tmwalaszek/module5", job.Name)
+	require.Equal(t, astera.JobKindPrefetch, job.Kind)
+	require.Equal(t, astera.JobStateRunning, job.State)
+
+	// module4 is not due yet
+	job, err = db.ClaimJob(now, nil)
+	require.NoError(t, err)
+	require.Nil(t, job)
+
+	reset, err := db.ResetRunningJobs()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), reset)
+
+	job, err = db.ClaimJob(now, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.FailJob(job.ID, 1, "not found"))
+
+	jobs, err := db.ListJobs(astera.JobStateFailed, 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.Equal(t, "not found", jobs[0].LastError)
+	require.Equal(t, 1, jobs[0].Attempts)
+
+	// a failed job is queued again
+	added, err = db.EnqueueJob(&astera.Job{Name: "github.com/tmwalaszek/module5", Version: "v1.0.0", Kind: astera.JobKindMiss, NextAttempt: now})
+	require.NoError(t, err)
+	require.True(t, added)
+
+	jobs, err = db.ListJobs("", 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	require.Equal(t, astera.JobStatePending, jobs[0].State)
+	require.Equal(t, 0, jobs[0].Attempts)
+
+	require.NoError(t, db.FinishJob("github.com/tmwalaszek/module5", "v1.0.0"))
+
+	deleted, err := db.DeleteJob(jobs[1].ID)
+	require.NoError(t, err)
+	require.True(t, deleted)
+
+	jobs, err = db.ListJobs("", 10)
+	require.NoError(t, err)
+	require.Empty(t, jobs)
+
+	// a prefetched module without zip gets it with the next insert
+	partial := &astera.Module{
+		Name:    "github.com/tmwalaszek/module6",
+		Version: "v1.0.0",
+		Info:    []byte("info"),
+		Mod:     []byte("mod"),
+	}
+	require.NoError(t, db.InsertModule(partial))
+
+	_, err = db.GetModuleZip("github.com/tmwalaszek/module6", "v1.0.0")
+	require.ErrorIs(t, err, astera.ErrModuleNotFound)
+
+	hasZip, err := db.HasModuleZip("github.com/tmwalaszek/module6", "v1.0.0")
+	require.NoError(t, err)
+	require.False(t, hasZip)
+
+	partial.Zip = []byte("zip")
+	require.NoError(t, db.InsertModule(partial))
+
+	zipFile, err = db.GetModuleZip("github.com/tmwalaszek/module6", "v1.0.0")
+	require.NoError(t, err)
+	require.Equal(t, []byte("zip"), zipFile)
+
+	// imported versions are stored like the fetched ones, along with the progress of their directory
+	require.NoError(t, db.InsertModule(&astera.Module{Name: "github.com/tmwalaszek/module7", Version: "v1.0.0", Mod: []byte("mod")}))
+
+	importedModules := []*astera.Module{
+		{Name: "github.com/tmwalaszek/module7", Version: "v1.0.0", Source: astera.ModuleSourceImport, Mod: []byte("mod")},
+		{Name: "github.com/tmwalaszek/module7", Version: "v1.1.0", Source: astera.ModuleSourceImport, Mod: []byte("mod"), Zip: []byte("zip")},
+	}
+
+	errs, err := db.InsertImportBatch("/cache", importedModules)
+	require.NoError(t, err)
+	require.ErrorIs(t, errs[0], astera.ErrModuleAlreadyExists)
+	require.NoError(t, errs[1])
+
+	imported, err := db.ImportedVersions("/cache")
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"github.com/tmwalaszek/module7@v1.0.0": true, "github.com/tmwalaszek/module7@v1.1.0": true}, imported)
+
+	zipFile, err = db.GetModuleZip("github.com/tmwalaszek/module7", "v1.1.0")
+	require.NoError(t, err)
+	require.Equal(t, []byte("zip"), zipFile)
+
+	var walked []string
+	err = db.WalkModules(nil, func(m *astera.Module) error {
+		if m.Name == "github.com/tmwalaszek/module7" {
+			walked = append(walked, m.Version+":"+string(m.Zip))
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0:", "v1.1.0:zip"}, walked)
+
+	// a prefix covered by another one is walked once
+	walked = nil
+	err = db.WalkModules([]string{"github.com/tmwalaszek/module7", "github.com/tmwalaszek/module", "github.com/zzz"}, func(m *astera.Module) error {
+		if m.Name == "github.com/tmwalaszek/module7" {
+			walked = append(walked, m.Version)
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0", "v1.1.0"}, walked)
+
+	walked = nil
+	err = db.WalkModules([]string{"github.com/tmwalaszek/module8"}, func(m *astera.Module) error {
+		walked = append(walked, m.Name)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Empty(t, walked)
+
+	catalog, err := db.Catalog("github.com/tmwalaszek/module7", "", 10)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(catalog), 2)
+	require.Equal(t, "v1.0.0", catalog[0].Version)
+
+	catalog, err = db.Catalog("github.com/tmwalaszek/module7", "v1.0.0", 1)
+	require.NoError(t, err)
+	require.Len(t, catalog, 1)
+	require.Equal(t, "github.com/tmwalaszek/module7", catalog[0].Name)
+	require.Equal(t, "v1.1.0", catalog[0].Version)
+
+	require.NoError(t, db.ResetImport("/cache"))
+
+	imported, err = db.ImportedVersions("/cache")
+	require.NoError(t, err)
+	require.Empty(t, imported)
+
+	// the accesses of a batch add up and the never served versions are the least recently used
+	now = time.Now()
+	err = db.RecordAccess([]astera.Access{{Name: "github.com/tmwalaszek/module1", Version: "v1.0.0", Hits: 2, At: now.Add(time.Hour)}})
+	require.NoError(t, err)
+	err = db.RecordAccess([]astera.Access{{Name: "github.com/tmwalaszek/module1", Version: "v1.0.0", Hits: 3, At: now}})
+	require.NoError(t, err)
+
+	moduleVersions, err = db.GetModuleVersions("github.com/tmwalaszek/module1")
+	require.NoError(t, err)
+	require.Equal(t, int64(5), moduleVersions[0].Hits)
+	require.Equal(t, now.Add(time.Hour).Unix(), moduleVersions[0].LastAccessAt.Unix())
+
+	lru, err := db.LeastRecentlyUsed(true, now.Add(2*time.Hour), 100, 0)
+	require.NoError(t, err)
+	require.NotEmpty(t, lru)
+	require.Equal(t, "github.com/tmwalaszek/module1", lru[len(lru)-1].Name)
+	for _, v := range lru {
+		require.NotZero(t, v.ZipSize)
+	}
+
+	lru, err = db.LeastRecentlyUsed(true, now.Add(-time.Hour), 100, 0)
+	require.NoError(t, err)
+	require.Empty(t, lru)
+
+	sizeBefore, err := db.DatabaseSize()
+	require.NoError(t, err)
+	require.Positive(t, sizeBefore)
+
+	require.NoError(t, db.DropZip("github.com/tmwalaszek/module1", "v1.0.0"))
+	hasZip, err = db.HasModuleZip("github.com/tmwalaszek/module1", "v1.0.0")
+	require.NoError(t, err)
+	require.False(t, hasZip)
+
+	require.NoError(t, db.DeleteModule("github.com/tmwalaszek/module1", "v1.0.0"))
+	versions, err = db.GetVersionList("github.com/tmwalaszek/module1")
+	require.NoError(t, err)
+	require.Empty(t, versions)
+
+	require.NoError(t, db.IncrementalVacuum())
+	require.NoError(t, db.IncrementalVacuum())
+
+	// pinned versions can't be dropped or deleted
+	require.NoError(t, db.AddPin(&astera.Pin{Module: "github.com/tmwalaszek/*", Reason: "release/1.x", Owner: "ops"}))
+	require.NoError(t, db.AddPin(&astera.Pin{Module: "github.com/tmwalaszek/module2", Version: "v2.0.0", Reason: "release/2.x", Owner: "ops"}))
+	require.NoError(t, db.AddPin(&astera.Pin{Module: "github.com/tmwalaszek/module2", Version: "v2.0.0", Reason: "release/2.0", Owner: "dev"}))
+
+	pins, err := db.ListPins()
+	require.NoError(t, err)
+	require.Len(t, pins, 2)
+	require.False(t, pins[0].CreatedAt.IsZero())
+	require.Equal(t, "release/2.0", pins[1].Reason)
+
+	moduleVersions, err = db.GetModuleVersions("github.com/tmwalaszek/module2")
+	require.NoError(t, err)
+	require.Equal(t, "release/2.0", moduleVersions[0].Pin.Reason)
+
+	lru, err = db.LeastRecentlyUsed(true, now.Add(2*time.Hour), 100, 0)
+	require.NoError(t, err)
+	for _, v := range lru {
+		require.NotNil(t, v.Pin)
+	}
+
+	require.ErrorIs(t, db.DropZip("github.com/tmwalaszek/module2", "v2.0.0"), astera.ErrPinned)
+	require.ErrorIs(t, db.DeleteModule("github.com/tmwalaszek/module7", "v1.1.0"), astera.ErrPinned)
+
+	removed, err := db.RemovePin("github.com/tmwalaszek/*", "")
+	require.NoError(t, err)
+	require.True(t, removed)
+
+	removed, err = db.RemovePin("github.com/tmwalaszek/*", "")
+	require.NoError(t, err)
+	require.False(t, removed)
+
+	require.NoError(t, db.DeleteModule("github.com/tmwalaszek/module7", "v1.1.0"))
+	require.ErrorIs(t, db.DeleteModule("github.com/tmwalaszek/module2", "v2.0.0"), astera.ErrPinned)
+
+	// a quarantine stays until released and every change is audited
+	quarantine := &astera.Quarantine{Name: "github.com/tmwalaszek/module2", Version: "v2.0.0", Reason: "wrong tag", By: "sec"}
+	require.NoError(t, db.Quarantine(quarantine))
+	require.False(t, quarantine.CreatedAt.IsZero())
+
+	quarantine.Reason = "compromised release"
+	require.NoError(t, db.Quarantine(quarantine))
+
+	quarantined, err := db.Quarantined("github.com/tmwalaszek/module2")
+	require.NoError(t, err)
+	require.Len(t, quarantined, 1)
+	require.Equal(t, "compromised release", quarantined[0].Reason)
+
+	moduleVersions, err = db.GetModuleVersions("github.com/tmwalaszek/module2")
+	require.NoError(t, err)
+	require.Equal(t, "sec", moduleVersions[0].Quarantine.By)
+
+	// a quarantined version is left out of the exports and the catalog
+	err = db.WalkModules(nil, func(m *astera.Module) error {
+		require.False(t, m.Name == "github.com/tmwalaszek/module2" && m.Version == "v2.0.0")
+		return nil
+	})
+	require.NoError(t, err)
+
+	catalog, err = db.Catalog("github.com/tmwalaszek/module2", "", 10)
+	require.NoError(t, err)
+	for _, entry := range catalog {
+		require.False(t, entry.Name == "github.com/tmwalaszek/module2" && entry.Version == "v2.0.0")
+	}
+
+	released, err := db.Release("github.com/tmwalaszek/module2", "v2.0.0", "ops", "fixed upstream")
+	require.NoError(t, err)
+	require.True(t, released)
+
+	catalog, err = db.Catalog("github.com/tmwalaszek/module2", "v1.9.9", 1)
+	require.NoError(t, err)
+	require.Equal(t, "v2.0.0", catalog[0].Version)
+
+	released, err = db.Release("github.com/tmwalaszek/module2", "v2.0.0", "ops", "fixed upstream")
+	require.NoError(t, err)
+	require.False(t, released)
+
+	quarantines, err := db.ListQuarantines()
+	require.NoError(t, err)
+	require.Empty(t, quarantines)
+
+	events, err := db.QuarantineAudit("github.com/tmwalaszek/module2", 10)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	require.Equal(t, astera.QuarantineActionRelease, events[0].Action)
+	require.Equal(t, "ops", events[0].By)
+	require.Equal(t, "wrong tag", events[2].Reason)
+
+	events, err = db.QuarantineAudit("", 1)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	releasedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, db.InsertModule(&astera.Module{
+		Name:    "github.com/tmwalaszek/module3",
+		Source:  astera.ModuleSourceProxy,
+		Version: "v1.0.0",
+		Info:    []byte(`{"Version":"v1.0.0","Time":"2026-01-02T03:04:05Z"}`),
+		Mod:     []byte("mod"),
+	}))
+	require.NoError(t, db.InsertModule(&astera.Module{
+		Name:    "github.com/tmwalaszek/module3",
+		Source:  astera.ModuleSourcePublished,
+		Version: "v1.1.0",
+		Info:    []byte(`{"Version":"v1.1.0","Time":"2026-01-02T03:04:05Z"}`),
+		Mod:     []byte("mod"),
+	}))
+
+	releaseTimes, err := db.ReleaseTimes("github.com/tmwalaszek/module3")
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Time{"v1.0.0": releasedAt, "v1.1.0": {}}, releaseTimes)
+
+	releaseTime, err := db.ReleaseTime("github.com/tmwalaszek/module3", "v1.0.0")
+	require.NoError(t, err)
+	require.Equal(t, releasedAt, releaseTime)
+
+	_, err = db.ReleaseTime("github.com/tmwalaszek/module3", "v2.0.0")
+	require.ErrorIs(t, err, astera.ErrModuleNotFound)
+
+	// the usage of a window occurrence adds up
+	night := time.Date(2026, 1, 2, 23, 0, 0, 0, time.Local)
+	for _, usage := range []astera.WindowUsage{
+		{Window: "23:00-02:00", Start: night.AddDate(0, 0, -1), End: night.AddDate(0, 0, -1).Add(3 * time.Hour), Bytes: 5},
+		{Window: "23:00-02:00", Start: night, End: night.Add(3 * time.Hour), Bytes: 10},
+		{Window: "23:00-02:00", Start: night, End: night.Add(3 * time.Hour), Bytes: 20},
+	} {
+		require.NoError(t, db.AddWindowUsage(usage))
+	}
+
+	usages, err := db.WindowUsages(1)
+	require.NoError(t, err)
+	require.Equal(t, []astera.WindowUsage{{Window: "23:00-02:00", Start: night, End: night.Add(3 * time.Hour), Bytes: 30}}, usages)
+
+	usages, err = db.WindowUsages(10)
+	require.NoError(t, err)
+	require.Len(t, usages, 2)
+	require.Equal(t, int64(5), usages[0].Bytes)
+
+	// the status of a module is replaced by its next sync
+	syncedAt := time.Unix(time.Now().Unix(), 0)
+	require.NoError(t, db.SaveMirrorStatus(astera.MirrorStatus{Module: "github.com/tmwalaszek/module1", Rule: "github.com/tmwalaszek/*", Error: "timeout"}))
+	require.NoError(t, db.SaveMirrorStatus(astera.MirrorStatus{Module: "github.com/tmwalaszek/module1", Rule: "github.com/tmwalaszek/*", SyncedAt: syncedAt, Upstream: 3, Matched: 2, Missing: 1, Queued: 1}))
+
+	mirrorStatuses, err := db.MirrorStatuses()
+	require.NoError(t, err)
+	require.Equal(t, []astera.MirrorStatus{{Module: "github.com/tmwalaszek/module1", Rule: "github.com/tmwalaszek/*", SyncedAt: syncedAt, Upstream: 3, Matched: 2, Missing: 1, Queued: 1}}, mirrorStatuses)
+
+	require.NoError(t, db.Ping(context.Background()))
+	require.NoError(t, db.CheckWritable(context.Background()))
+}
+
+func TestConvertVacuum(t *testing.T) {
+	t.Parallel()
+
+	database := path.Join(t.TempDir(), "old.db")
+
+	// a database created before the incremental auto vacuum
+	old, err := sql.Open("sqlite3", database)
+	require.NoError(t, err)
+	_, err = old.Exec(`CREATE TABLE legacy (id INTEGER)`)
+	require.NoError(t, err)
+	require.NoError(t, old.Close())
+
+	db, err := NewDB(database)
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	require.ErrorIs(t, db.IncrementalVacuum(), ErrNotIncremental)
+
+	converted, err := db.ConvertVacuum(context.Background())
+	require.NoError(t, err)
+	require.True(t, converted)
+	require.NoError(t, db.IncrementalVacuum())
+
+	converted, err = db.ConvertVacuum(context.Background())
+	require.NoError(t, err)
+	require.False(t, converted)
 }
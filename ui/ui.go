@@ -0,0 +1,276 @@
+package ui
+
+import (
+	"archive/zip"
+	"astera"
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	xmod "golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+const searchLimit = 100
+
+const (
+	kindPrivate   = "private"
+	kindPublished = "published"
+	kindProxied   = "proxied"
+)
+
+var (
+	//go:embed templates/*.html
+	templatesFS embed.FS
+)
+
+// UI is a read only HTML view of the cached modules
+type UI struct {
+	repository astera.ModuleRepository
+	goPrivate  string
+
+	templates *template.Template
+	mux       *http.ServeMux
+}
+
+type page struct {
+	Title string
+	Query string
+}
+
+type searchPage struct {
+	page
+	Modules []string
+	More    bool
+}
+
+type modulePage struct {
+	page
+	Name     string
+	Kind     string
+	Versions []astera.ModuleVersion
+}
+
+type versionPage struct {
+	page
+	Name    string
+	Kind    string
+	ZipHash string
+	Pin     *astera.Pin
+	Info    []byte
+	Mod     []byte
+	Files   []zipFile
+
+	// Quarantine is nil for a served version
+	Quarantine *astera.Quarantine
+}
+
+type zipFile struct {
+	Name string
+	Size uint64
+}
+
+func New(repository astera.ModuleRepository, goPrivate string) *UI {
+	u := &UI{
+		repository: repository,
+		goPrivate:  goPrivate,
+		templates: template.Must(template.New("").Funcs(template.FuncMap{
+			"size": formatSize,
+		}).ParseFS(templatesFS, "templates/*.html")),
+		mux: http.NewServeMux(),
+	}
+
+	u.mux.HandleFunc("GET /ui/{$}", u.search)
+	u.mux.HandleFunc("GET /ui/module/{path...}", u.module)
+
+	return u
+}
+
+func (u *UI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mux.ServeHTTP(w, r)
+}
+
+func (u *UI) search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	p := &searchPage{page: page{Title: "Cached modules", Query: query}}
+	if query != "" {
+		modules, err := u.repository.SearchModules(query, searchLimit+1)
+		if err != nil {
+			u.error(w, r, err)
+			return
+		}
+
+		if len(modules) > searchLimit {
+			modules = modules[:searchLimit]
+			p.More = true
+		}
+
+		p.Modules = modules
+	}
+
+	u.render(w, r, "search", p)
+}
+
+func (u *UI) module(w http.ResponseWriter, r *http.Request) {
+	name, version, isVersion := strings.Cut(r.PathValue("path"), "/@v/")
+
+	versions, err := u.repository.GetModuleVersions(name)
+	if err != nil {
+		u.error(w, r, err)
+		return
+	}
+
+	if len(versions) == 0 {
+		http.Error(w, astera.ErrModuleNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	slices.SortFunc(versions, func(a, b astera.ModuleVersion) int {
+		return semver.Compare(b.Version, a.Version)
+	})
+
+	kind := u.kind(name, versions)
+	if !isVersion {
+		u.render(w, r, "module", &modulePage{
+			page:     page{Title: name},
+			Name:     name,
+			Kind:     kind,
+			Versions: versions,
+		})
+		return
+	}
+
+	i := slices.IndexFunc(versions, func(v astera.ModuleVersion) bool { return v.Version == version })
+	if i < 0 {
+		http.Error(w, astera.ErrModuleNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	p := &versionPage{
+		page:    page{Title: name + "@" + version},
+		Name:    name,
+		Kind:    kind,
+		ZipHash: versions[i].ZipHash,
+		Pin:     versions[i].Pin,
+
+		Quarantine: versions[i].Quarantine,
+	}
+
+	p.Info, err = u.repository.GetVersionInfo(name, version)
+	if err != nil && !errors.Is(err, astera.ErrModuleNotFound) {
+		u.error(w, r, err)
+		return
+	}
+
+	p.Mod, err = u.repository.GetModFile(name, version)
+	if err != nil && !errors.Is(err, astera.ErrModuleNotFound) {
+		u.error(w, r, err)
+		return
+	}
+
+	if versions[i].ZipSize > 0 {
+		p.Files, err = u.zipFiles(name, version)
+		if err != nil {
+			u.error(w, r, err)
+			return
+		}
+	}
+
+	u.render(w, r, "version", p)
+}
+
+func (u *UI) zipFiles(name, version string) ([]zipFile, error) {
+	body, err := u.repository.GetModuleZip(name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]zipFile, 0, len(zr.File))
+	for _, f := range zr.File {
+		// every file is under the module@version/ prefix
+		_, fileName, _ := strings.Cut(f.Name, "@"+version+"/")
+		files = append(files, zipFile{Name: fileName, Size: f.UncompressedSize64})
+	}
+
+	return files, nil
+}
+
+// kind tells if the module is private (GOPRIVATE, fetched with git), published or proxied
+func (u *UI) kind(name string, versions []astera.ModuleVersion) string {
+	modulePath, err := xmod.UnescapePath(name)
+	if err != nil {
+		modulePath = name
+	}
+
+	if xmod.MatchPrefixPatterns(u.goPrivate, modulePath) {
+		return kindPrivate
+	}
+
+	for _, v := range versions {
+		if v.Source == astera.ModuleSourcePublished {
+			return kindPublished
+		}
+
+		if v.Source == astera.ModuleSourceGit {
+			return kindPrivate
+		}
+	}
+
+	return kindProxied
+}
+
+func (u *UI) render(w http.ResponseWriter, r *http.Request, name string, data any) {
+	buf := &bytes.Buffer{}
+	err := u.templates.ExecuteTemplate(buf, name, data)
+	if err != nil {
+		u.error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		slog.Error("failed to write response body", "path", r.URL.Path, "err", err)
+	}
+}
+
+func (u *UI) error(w http.ResponseWriter, r *http.Request, err error) {
+	slog.Error("ui request failed", "path", r.URL.Path,
+		"request_id", astera.RequestInfoFromContext(r.Context()).RequestID(), "err", err)
+	http.Error(w, "internal server error", http.StatusInternalServerError)
+}
+
+func formatSize(size any) string {
+	var n float64
+	switch v := size.(type) {
+	case int64:
+		n = float64(v)
+	case uint64:
+		n = float64(v)
+	}
+
+	units := []string{"B", "KB", "MB", "GB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
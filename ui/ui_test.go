@@ -0,0 +1,95 @@
+package ui
+
+import (
+	"archive/zip"
+	"astera"
+	"astera/mock"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUI(t *testing.T) {
+	t.Parallel()
+
+	zipBody := &bytes.Buffer{}
+	zw := zip.NewWriter(zipBody)
+	f, err := zw.Create("github.com/tmwalaszek/module1@v1.0.0/module.go")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("package module1\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	repositoryMock := &mock.Repository{
+		SearchModulesFn: func(query string, limit int) ([]string, error) {
+			return []string{"github.com/tmwalaszek/module1"}, nil
+		},
+		GetModuleVersionsFn: func(name string) ([]astera.ModuleVersion, error) {
+			if name != "github.com/tmwalaszek/module1" {
+				return nil, nil
+			}
+
+			return []astera.ModuleVersion{
+				{Name: name, Version: "v1.0.0", Source: astera.ModuleSourceProxy, ZipSize: int64(zipBody.Len()), CreatedAt: time.Now(),
+					Quarantine: &astera.Quarantine{Reason: "wrong tag", By: "sec"}},
+				{Name: name, Version: "v1.1.0", Source: astera.ModuleSourceImport, Pin: &astera.Pin{Module: name, Version: "v1.1.0", Reason: "release/1.1", Owner: "ops"}},
+			}, nil
+		},
+		GetVersionInfoFn: func(name, version string) ([]byte, error) {
+			return []byte(`{"Version":"v1.0.0"}`), nil
+		},
+		GetModFileFn: func(name, version string) ([]byte, error) {
+			return []byte("module github.com/tmwalaszek/module1\n"), nil
+		},
+		GetModuleZipFn: func(name, version string) ([]byte, error) {
+			return zipBody.Bytes(), nil
+		},
+	}
+
+	var tt = []struct {
+		path     string
+		code     int
+		contains []string
+	}{
+		{
+			path:     "/ui/?q=module1",
+			code:     http.StatusOK,
+			contains: []string{`href="/ui/module/github.com/tmwalaszek/module1"`},
+		},
+		{
+			path:     "/ui/module/github.com/tmwalaszek/module1",
+			code:     http.StatusOK,
+			contains: []string{"v1.1.0", "unknown", kindProxied, `title="release/1.1">pinned by ops`},
+		},
+		{
+			path:     "/ui/module/github.com/tmwalaszek/module1/@v/v1.0.0",
+			code:     http.StatusOK,
+			contains: []string{"module.go", "module github.com/tmwalaszek/module1", "quarantined</span> by sec"},
+		},
+		{
+			path: "/ui/module/github.com/tmwalaszek/module1/@v/v2.0.0",
+			code: http.StatusNotFound,
+		},
+		{
+			path: "/ui/module/github.com/tmwalaszek/module2",
+			code: http.StatusNotFound,
+		},
+	}
+
+	u := New(repositoryMock, "")
+	for _, tc := range tt {
+		t.Run(tc.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			u.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			require.Equal(t, tc.code, rec.Code)
+			for _, c := range tc.contains {
+				require.Contains(t, rec.Body.String(), c)
+			}
+		})
+	}
+}